@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"social/internal/store"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// statsMaxRange bounds the days one stats request may cover.
+	statsMaxRange = 366
+	statsMaxTop   = 50
+	// stats of past days no longer change, while those including today are
+	// only cached briefly.
+	statsExpTime     = time.Hour * 24
+	statsLiveExpTime = time.Minute * 5
+)
+
+var (
+	ErrInvalidStatsRange = fmt.Errorf("from must not be after to, and the range must cover at most %d days", statsMaxRange)
+	ErrInvalidStatsTop   = fmt.Errorf("top must be between 1 and %d", statsMaxTop)
+)
+
+// GetPlatformStats godoc
+//
+//	@Summary		Fetches platform statistics
+//	@Description	Fetches daily signups, activations, active users, posts and comments between two UTC days, with the monthly active users and the top posters and tags of the range. Defaults to the last 30 days
+//	@Tags			admin
+//	@Produce		json
+//	@Param			from	query		string	false	"First day, YYYY-MM-DD"
+//	@Param			to		query		string	false	"Last day, YYYY-MM-DD"
+//	@Param			top		query		int		false	"Top posters and tags to list"
+//	@Success		200		{object}	store.PlatformStats
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/stats [get]
+func (app *application) getPlatformStatsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	to := today
+	if v := qs.Get("to"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			app.statusBadRequest(w, r, err)
+			return
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if v := qs.Get("from"); v != "" {
+		f, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			app.statusBadRequest(w, r, err)
+			return
+		}
+		from = f
+	}
+
+	if from.After(to) || to.Sub(from) >= statsMaxRange*24*time.Hour {
+		app.statusBadRequest(w, r, ErrInvalidStatsRange)
+		return
+	}
+
+	top := 10
+	if v := qs.Get("top"); v != "" {
+		t, err := strconv.Atoi(v)
+		if err != nil {
+			app.statusBadRequest(w, r, err)
+			return
+		}
+		top = t
+	}
+
+	if top < 1 || top > statsMaxTop {
+		app.statusBadRequest(w, r, ErrInvalidStatsTop)
+		return
+	}
+
+	exp := statsExpTime
+	if !to.Before(today) {
+		exp = statsLiveExpTime
+	}
+
+	stats, err := app.getPlatformStats(r.Context(), from, to, top, exp)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, stats); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getPlatformStats(ctx context.Context, from, to time.Time, top int, exp time.Duration) (*store.PlatformStats, error) {
+	if !app.config.redisCfg.enabled {
+		stats, err := app.store.Stats.Get(ctx, from, to, top)
+		return &stats, err
+	}
+
+	key := fmt.Sprintf("%s-%s-%d", from.Format(time.DateOnly), to.Format(time.DateOnly), top)
+
+	stats, err := app.cacheStorage.Stats.Get(ctx, key)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	if stats == nil {
+		computed, err := app.store.Stats.Get(ctx, from, to, top)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = &computed
+
+		if err := app.cacheStorage.Stats.Set(ctx, key, stats, exp); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
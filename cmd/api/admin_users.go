@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"social/internal/mailer"
+	"social/internal/store"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// impersonationTokenExp keeps impersonation tokens short lived, they
+	// cannot be revoked otherwise.
+	impersonationTokenExp = time.Minute * 15
+	passwordResetExp      = time.Hour * 24
+)
+
+var (
+	ErrManageHigherRole  = errors.New("cannot manage a user with an equal or higher role")
+	ErrManageSelf        = errors.New("cannot change your own account through the admin API")
+	ErrUserNotActive     = errors.New("user has not activated their account")
+	ErrImpersonatedAdmin = errors.New("impersonation tokens cannot use the admin API")
+)
+
+type SetUserRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
+// ListUsers godoc
+//
+//	@Summary		Lists users
+//	@Description	Lists users newest first, including those that did not activate their account, filtered by role, activation, suspension, creation day range and a search on username or email
+//	@Tags			admin
+//	@Produce		json
+//	@Param			role			query		string	false	"Role name"
+//	@Param			active			query		bool	false	"Activated accounts only, or not activated only"
+//	@Param			suspended		query		bool	false	"Suspended accounts only, or not suspended only"
+//	@Param			created_from	query		string	false	"First creation day, YYYY-MM-DD"
+//	@Param			created_to		query		string	false	"Last creation day, YYYY-MM-DD"
+//	@Param			q				query		string	false	"Part of the username or email"
+//	@Param			limit			query		int		false	"Page size"
+//	@Param			offset			query		int		false	"Page offset"
+//	@Success		200				{array}		store.User
+//	@Failure		400				{object}	error
+//	@Failure		403				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users [get]
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := store.UserListQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	users, err := app.store.User.List(r.Context(), q)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, users); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// AdminGetUser godoc
+//
+//	@Summary		Fetches a user
+//	@Description	Fetches a user, including one that did not activate their account
+//	@Tags			admin
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID} [get]
+func (app *application) adminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, user); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// AdminActivateUser godoc
+//
+//	@Summary		Activates a user
+//	@Description	Activates a user without their invitation token, which stops working
+//	@Tags			admin
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/activate [put]
+func (app *application) adminActivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.User.ActivateById(r.Context(), user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("user.activate", "user", user.ID,
+		map[string]bool{"is_active": user.IsActive}, map[string]bool{"is_active": true}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetUserRole godoc
+//
+//	@Summary		Changes the role of a user
+//	@Description	Changes the role of a user with a lower role than the admin. Admins cannot change their own role
+//	@Tags			admin
+//	@Accept			json
+//	@Param			userID	path	int					true	"User ID"
+//	@Param			payload	body	SetUserRolePayload	true	"Role payload"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/role [put]
+func (app *application) setUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload SetUserRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.checkManageable(ctx, &user); err != nil {
+		app.forbiddenResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.User.SetRole(ctx, user.ID, payload.Role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.evictUser(ctx, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditEvent("user.role", "user", user.ID,
+		map[string]string{"role": user.Role.Name}, map[string]string{"role": payload.Role}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForcePasswordReset godoc
+//
+//	@Summary		Forces a password reset
+//	@Description	Replaces the password of a user, signs them out of every session and emails them a link to choose a new one
+//	@Tags			admin
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/password-reset [post]
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.checkManageable(ctx, &user); err != nil {
+		app.forbiddenResponse(w, r, err)
+		return
+	}
+
+	// nobody knows the replacement password, so the reset link is the only
+	// way back into the account
+	if err := user.Password.Set(uuid.New().String()); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := app.store.User.ForcePasswordReset(ctx, &user, hashToken, passwordResetExp); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.evictUser(ctx, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditEvent("user.password_reset", "user", user.ID, nil, nil))
+
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresAt string
+	}{
+		Username:  user.Username,
+		ResetURL:  fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken),
+		ExpiresAt: time.Now().Add(passwordResetExp).UTC().Format(time.RFC1123),
+	}
+	isProdEnv := app.config.env == "production"
+
+	if err := app.mailer.Send(mailer.UserPasswordResetTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImpersonateUser godoc
+//
+//	@Summary		Creates an impersonation token
+//	@Description	Creates a short lived token acting as a user with a lower role. The token carries the admin in its act claim and every request made with it is logged
+//	@Tags			admin
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		201		{string}	string	"Token"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/impersonate [post]
+func (app *application) impersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	admin := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.checkManageable(ctx, &user); err != nil {
+		app.forbiddenResponse(w, r, err)
+		return
+	}
+
+	if !user.IsActive {
+		app.statusBadRequest(w, r, ErrUserNotActive)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+		"act": map[string]any{"sub": admin.ID},
+		"exp": now.Add(impersonationTokenExp).Unix(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.iss,
+	}
+
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditEvent("user.impersonate", "user", user.ID, nil,
+		map[string]string{"expires_at": now.Add(impersonationTokenExp).UTC().Format(time.RFC3339)}))
+
+	if err := app.JSONResponse(w, http.StatusCreated, token); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// adminTargetUser loads the user of the userID path parameter, writing the
+// error response when it fails.
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (store.User, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return store.User{}, false
+	}
+
+	user, err := app.store.User.GetAny(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return store.User{}, false
+	}
+
+	return user, true
+}
+
+// checkManageable rejects changes an admin makes to their own account or to
+// users with an equal or higher role.
+func (app *application) checkManageable(ctx context.Context, user *store.User) error {
+	admin := ctx.Value(userCtxKey).(store.User)
+
+	if admin.ID == user.ID {
+		return ErrManageSelf
+	}
+
+	if user.Role.Level >= admin.Role.Level {
+		return ErrManageHigherRole
+	}
+
+	return nil
+}
+
+// rejectImpersonation keeps impersonation tokens out of the routes it
+// wraps.
+func (app *application) rejectImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(impersonatorCtxKey).(int64); ok {
+			app.forbiddenResponse(w, r, ErrImpersonatedAdmin)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -9,12 +9,17 @@ import (
 	"os"
 	"os/signal"
 	"social/docs"
+	"social/internal/audit"
 	"social/internal/auth"
+	"social/internal/contentfilter"
 	env "social/internal/env"
 	"social/internal/mailer"
+	"social/internal/ranking"
 	"social/internal/ratelimiter"
 	"social/internal/store"
 	"social/internal/store/cache"
+	"social/internal/stream"
+	"social/internal/webhooks"
 	"syscall"
 	"time"
 
@@ -33,6 +38,15 @@ type application struct {
 	mailer        mailer.Client
 	authenticator auth.Authenticator
 	rateLimiter   ratelimiter.Limiter
+	ranker        *ranking.Ranker
+	contentFilter *contentfilter.Chain
+	auditLog      audit.Store
+	auditQueue    chan audit.Event
+	streams       *stream.Hub
+	activeUsers   activeUsers
+
+	webhooks          webhooks.Store
+	webhookDispatcher *webhooks.Dispatcher
 }
 
 type config struct {
@@ -45,6 +59,19 @@ type config struct {
 	auth        authConfig
 	redisCfg    redisConfig
 	rateLimiter ratelimiter.Config
+	scheduler   schedulerConfig
+	posts       postsConfig
+	tags        tagsConfig
+	timeline    timelineConfig
+	filter      contentFilterConfig
+	retention   retentionConfig
+	digest      digestConfig
+	webhooks    webhookConfig
+	outbox      outboxConfig
+}
+
+type postsConfig struct {
+	maxPinned int
 }
 
 type redisConfig struct {
@@ -98,7 +125,7 @@ func (app *application) mount() http.Handler {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:5174")},
 		// AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
@@ -108,10 +135,10 @@ func (app *application) mount() http.Handler {
 	r.Use(app.RateLimiterMiddleware)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(requestLogger)
 	r.Use(middleware.Recoverer)
 
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(timeoutMiddleware(60*time.Second, "/v1/stream"))
 
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/health", app.healthCheckHandler)
@@ -125,25 +152,176 @@ func (app *application) mount() http.Handler {
 
 			r.Post("/", app.createPostHandler)
 			r.Route("/{postID}", func(r chi.Router) {
-				r.Use(app.postsContextMiddleware)
+				// deleted posts and comments only resolve for restoring
+				r.Put("/restore", app.restorePostHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.postsContextMiddleware)
+
+					r.Get("/", app.getPostHandler)
+					r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+					r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+
+					r.With(app.requireRole("moderator")).Put("/hide", app.hidePostHandler)
+					r.With(app.requireRole("moderator")).Delete("/hide", app.unhidePostHandler)
+
+					r.Get("/comments", app.listCommentsHandler)
+					r.Post("/comments", app.postCommentHandler)
+					r.Route("/comments/{commentID}", func(r chi.Router) {
+						r.Put("/restore", app.restoreCommentHandler)
+
+						r.Group(func(r chi.Router) {
+							r.Use(app.commentsContextMiddleware)
+
+							r.Get("/", app.getCommentHandler)
+							r.Patch("/", app.checkCommentOwnership("moderator", app.updateCommentHandler))
+							r.Delete("/", app.checkCommentOwnership("admin", app.deleteCommentHandler))
+							r.Get("/replies", app.getCommentRepliesHandler)
+							r.Put("/like", app.likeCommentHandler)
+							r.Delete("/like", app.unlikeCommentHandler)
+
+							r.With(app.requireRole("moderator")).Put("/hide", app.hideCommentHandler)
+							r.With(app.requireRole("moderator")).Delete("/hide", app.unhideCommentHandler)
+						})
+					})
+
+					r.Get("/reactions", app.getPostReactionsHandler)
+					r.Put("/reactions/{kind}", app.reactToPostHandler)
+					r.Delete("/reactions/{kind}", app.deletePostReactionHandler)
+
+					r.Post("/reposts", app.repostHandler)
+					r.Delete("/reposts", app.undoRepostHandler)
+					r.Post("/quotes", app.quotePostHandler)
+
+					r.Put("/bookmark", app.bookmarkPostHandler)
+					r.Delete("/bookmark", app.removeBookmarkHandler)
+
+					r.Put("/pin", app.pinPostHandler)
+					r.Delete("/pin", app.unpinPostHandler)
+				})
+			})
+		})
+
+		r.With(app.AuthTokenMiddleware).Post("/reports", app.createReportHandler)
+
+		r.Route("/moderation", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.requireRole("moderator"))
+
+			r.Get("/cases", app.getModerationCasesHandler)
+			r.Route("/cases/{caseID}", func(r chi.Router) {
+				r.Get("/", app.getModerationCaseHandler)
+				r.Put("/claim", app.claimModerationCaseHandler)
+				r.Put("/resolve", app.resolveModerationCaseHandler)
+			})
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.requireRole("admin"))
+			r.Use(app.rejectImpersonation)
+
+			r.Get("/stats", app.getPlatformStatsHandler)
+
+			r.Get("/audit", app.getAuditEventsHandler)
+			r.Get("/audit/verify", app.verifyAuditLogHandler)
+
+			r.Get("/users", app.listUsersHandler)
+			r.Route("/users/{userID}", func(r chi.Router) {
+				r.Get("/", app.adminGetUserHandler)
+				r.Put("/activate", app.adminActivateUserHandler)
+				r.Put("/role", app.setUserRoleHandler)
+				r.Post("/password-reset", app.forcePasswordResetHandler)
+				r.Post("/impersonate", app.impersonateUserHandler)
+			})
+		})
+
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getNotificationsHandler)
+			r.Get("/unread", app.getUnreadNotificationsHandler)
+			r.Put("/read", app.markAllNotificationsReadHandler)
+			r.Put("/{notificationID}/read", app.markNotificationReadHandler)
+			r.Get("/preferences", app.getNotificationPreferencesHandler)
+			r.Put("/preferences", app.updateNotificationPreferencesHandler)
+		})
+
+		r.Route("/stream", func(r chi.Router) {
+			r.With(app.AuthTokenMiddleware).Post("/tickets", app.createStreamTicketHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.streamAuthMiddleware)
+
+				r.Get("/", app.streamHandler)
+				r.Get("/ws", app.streamWebSocketHandler)
+			})
+		})
+
+		// signed links of digest emails: GET shows a confirmation and only
+		// POST, from it or from one-click unsubscribe, unsubscribes
+		r.Get("/digests/unsubscribe", app.confirmUnsubscribeDigestHandler)
+		r.Post("/digests/unsubscribe", app.unsubscribeDigestLinkHandler)
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
 
-				r.Get("/", app.getPostHandler)
-				r.Delete("/", app.deletePostHandler)
-				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+			r.Get("/", app.getWebhooksHandler)
+			r.Post("/", app.createWebhookHandler)
+			r.Route("/{webhookID}", func(r chi.Router) {
+				r.Use(app.webhooksContextMiddleware)
 
-				r.Post("/comments", app.postCommentHandler)
+				r.Get("/", app.getWebhookHandler)
+				r.Delete("/", app.deleteWebhookHandler)
+				r.Get("/deliveries", app.getWebhookDeliveriesHandler)
+				r.Post("/deliveries/{deliveryID}/redeliver", app.redeliverWebhookHandler)
 			})
 		})
 
+		r.Route("/search", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/posts", app.searchPostsHandler)
+		})
+
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/trending", app.getTrendingTagsHandler)
+			r.Get("/{tag}/posts", app.getTagPostsHandler)
+			r.Put("/{tag}/follow", app.followTagHandler)
+			r.Delete("/{tag}/follow", app.unfollowTagHandler)
+		})
+
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
 
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+
+				r.Get("/tags", app.getFollowedTagsHandler)
+				r.Get("/bookmarks", app.getBookmarksHandler)
+				r.Get("/bookmarks/collections", app.getBookmarkCollectionsHandler)
+				r.Post("/bookmarks/collections", app.createBookmarkCollectionHandler)
+				r.Delete("/bookmarks/collections/{collectionID}", app.deleteBookmarkCollectionHandler)
+
+				r.Get("/digest", app.getDigestSubscriptionHandler)
+				r.Put("/digest", app.subscribeDigestHandler)
+				r.Delete("/digest", app.unsubscribeDigestHandler)
+			})
+
 			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 				r.Get("/", app.getUserHandler)
+				r.Get("/posts", app.getUserPostsHandler)
 
 				r.Put("/follow", app.followUserHandler)
 				r.Put("/unfollow", app.unfollowUserHandler)
+
+				r.Route("/suspensions", func(r chi.Router) {
+					r.Use(app.requireRole("moderator"))
+					r.Get("/", app.getUserSuspensionsHandler)
+					r.Post("/", app.suspendUserHandler)
+					r.Delete("/", app.liftUserSuspensionHandler)
+				})
 			})
 
 			r.Group(func(r chi.Router) {
@@ -156,6 +334,8 @@ func (app *application) mount() http.Handler {
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/appeal", app.appealSuspensionHandler)
+			r.Put("/password-reset", app.resetPasswordHandler)
 		})
 	})
 
@@ -174,6 +354,12 @@ func (app *application) run(mux http.Handler) error {
 		ReadTimeout:  time.Second * 10,
 		IdleTimeout:  time.Minute, // tempo que a conexão espera pela próxima requisição quando keep alive é igual a true
 	}
+	// open streams would otherwise hold the shutdown until its timeout
+	srv.RegisterOnShutdown(app.streams.Close)
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	app.startBackgroundJobs(jobsCtx)
 
 	shutdown := make(chan error)
 	go func() {
@@ -185,6 +371,7 @@ func (app *application) run(mux http.Handler) error {
 		defer cancel()
 
 		app.logger.Infow("signal caught", "signal", s.String())
+		stopJobs()
 
 		shutdown <- srv.Shutdown(ctx)
 	}()
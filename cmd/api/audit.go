@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"social/internal/audit"
+	"social/internal/store"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// auditQueueSize is how many events of unauthenticated requests wait to be
+// recorded before more are dropped.
+const auditQueueSize = 256
+
+// audit records an action made through a request. The actor defaults to
+// the authenticated user, and impersonated requests name the admin behind
+// them. Failing to record never fails the request, but is logged.
+func (app *application) audit(r *http.Request, e audit.Event) {
+	app.recordAudit(r.Context(), requestAuditEvent(r, e))
+}
+
+// auditLater queues an action of an unauthenticated request, like a failed
+// login, for runAuditQueue to record. Anyone can make those, so they never
+// wait on the chain lock of the log, and are dropped while the queue is full.
+func (app *application) auditLater(r *http.Request, e audit.Event) {
+	e = requestAuditEvent(r, e)
+
+	select {
+	case app.auditQueue <- e:
+	default:
+		app.logger.Warnw("audit queue full, dropping event", "action", e.Action, "ip", e.IP)
+	}
+}
+
+// runAuditQueue records the queued events one at a time until ctx is
+// cancelled.
+func (app *application) runAuditQueue(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-app.auditQueue:
+			app.recordAudit(ctx, e)
+		}
+	}
+}
+
+// requestAuditEvent fills the actor, impersonator, IP and request ID of an
+// event from the request.
+func requestAuditEvent(r *http.Request, e audit.Event) audit.Event {
+	ctx := r.Context()
+
+	if e.ActorID == nil {
+		if user, ok := ctx.Value(userCtxKey).(store.User); ok {
+			e.ActorID = &user.ID
+		}
+	}
+
+	if impersonatorID, ok := ctx.Value(impersonatorCtxKey).(int64); ok {
+		e.ImpersonatorID = &impersonatorID
+	}
+
+	e.IP = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		e.IP = host
+	}
+	e.RequestID = middleware.GetReqID(ctx)
+
+	return e
+}
+
+// emailHash identifies an email in the log without storing it, for failed
+// logins with emails that belong to no one.
+func emailHash(email string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(hash[:])
+}
+
+// auditEvent builds the event of an action on the target, with its state
+// before and after the action when it has one.
+func auditEvent(action, targetType string, targetID int64, before, after any) audit.Event {
+	return audit.Event{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   strconv.FormatInt(targetID, 10),
+		Before:     audit.JSON(before),
+		After:      audit.JSON(after),
+	}
+}
+
+// recordAudit records an event as is, for actions made outside a request.
+func (app *application) recordAudit(ctx context.Context, e audit.Event) {
+	if err := app.auditLog.Append(ctx, &e); err != nil {
+		app.logger.Errorw("error recording audit event", "action", e.Action, "target_type", e.TargetType,
+			"target", e.TargetID, "error", err)
+	}
+}
+
+// GetAuditEvents godoc
+//
+//	@Summary		Fetches audit events
+//	@Description	Fetches audit events newest first, with the fields changed by each, filtered by actor (or impersonator), action, target and creation day range
+//	@Tags			admin
+//	@Produce		json
+//	@Param			actor_id	query		int		false	"Actor or impersonator ID"
+//	@Param			action		query		string	false	"Action, like user.role"
+//	@Param			target_type	query		string	false	"Target type, like user or post"
+//	@Param			target_id	query		string	false	"Target ID"
+//	@Param			from		query		string	false	"First day, YYYY-MM-DD"
+//	@Param			to			query		string	false	"Last day, YYYY-MM-DD"
+//	@Param			limit		query		int		false	"Page size"
+//	@Param			offset		query		int		false	"Page offset"
+//	@Success		200			{array}		audit.Event
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/audit [get]
+func (app *application) getAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := audit.Query{Limit: 50}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	events, err := app.auditLog.List(r.Context(), q)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, events); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// VerifyAuditLog godoc
+//
+//	@Summary		Verifies the audit log
+//	@Description	Recomputes the hash chain of the audit log, reporting the first event that was altered or follows a removed one
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	audit.VerifyResult
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/audit/verify [get]
+func (app *application) verifyAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := app.auditLog.Verify(r.Context())
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, result); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
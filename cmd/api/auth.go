@@ -4,9 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
-	"social/internal/mailer"
+	"social/internal/audit"
 	"social/internal/store"
 	"time"
 
@@ -73,7 +72,9 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	hash := sha256.Sum256([]byte(plainToken))
 	hashToken := hex.EncodeToString(hash[:])
 
-	if err := app.store.User.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp); err != nil {
+	// the welcome email is sent from the outbox, once the user is committed
+	registered := store.NewOutboxEvent(store.OutboxUserRegistered, UserRegisteredMessage{UserID: &user.ID})
+	if err := app.store.User.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp, registered); err != nil {
 		switch err {
 		case store.ErrDuplicateEmail:
 		case store.ErrDuplicateUsername:
@@ -89,28 +90,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Token: plainToken,
 	}
 
-	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
-	isProdEnv := app.config.env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
-	}
-
-	err := app.mailer.Send(mailer.UserWelcomeTemplate, payload.Username, payload.Email, vars, !isProdEnv)
-	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
-
-		if err := app.store.User.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
-		}
-
-		app.statusInternalServerError(w, r, err)
-		return
-	}
-
 	if err := app.JSONResponse(w, http.StatusCreated, userWithToken); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
@@ -134,6 +113,7 @@ type CreateUserTokenPayload struct {
 //	@Failure		404		{object}	error
 //	@Failure		500		{object}	error
 //	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/authentication/token [post]
 func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -152,6 +132,8 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		switch err {
 		case store.ErrNotFound:
+			app.auditLater(r, audit.Event{Action: "auth.login_failed", TargetType: "email_hash", TargetID: emailHash(payload.Email),
+				After: audit.JSON(map[string]string{"reason": "unknown email"})})
 			app.statusUnauthorized(w, r, err)
 		default:
 			app.statusInternalServerError(w, r, err)
@@ -160,10 +142,17 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	if !user.Password.Equal(payload.Password) {
+		app.auditLater(r, auditEvent("auth.login_failed", "user", user.ID, nil, map[string]string{"reason": "invalid password"}))
 		app.statusUnauthorized(w, r, ErrorInvalidPass)
 		return
 	}
 
+	if user.IsSuspended(time.Now()) {
+		app.auditLater(r, auditEvent("auth.login_failed", "user", user.ID, nil, map[string]string{"reason": "suspended"}))
+		app.forbiddenResponse(w, r, suspendedError(&user))
+		return
+	}
+
 	claims := jwt.MapClaims{
 		"sub": user.ID,
 		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
@@ -179,8 +168,71 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	login := auditEvent("auth.login", "user", user.ID, nil, nil)
+	login.ActorID = &user.ID
+	app.audit(r, login)
+
 	if err := app.JSONResponse(w, http.StatusCreated, token); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
 }
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6,max=72"`
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Resets a password
+//	@Description	Sets a new password with the token of a password reset email
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body	ResetPasswordPayload	true	"Reset token and new password"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/authentication/password-reset [put]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	var user store.User
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.User.ResetPassword(ctx, payload.Token, &user); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.evictUser(ctx, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	event := auditEvent("auth.password_reset", "user", user.ID, nil, nil)
+	event.ActorID = &user.ID
+	app.audit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"social/internal/store"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type BookmarkPostPayload struct {
+	CollectionID *int64 `json:"collection_id"`
+}
+
+type CreateBookmarkCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// BookmarkPost godoc
+//
+//	@Summary		Bookmarks a post
+//	@Description	Saves a post for later, optionally in one of the user's collections
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Param			postID	path	int					true	"Post ID"
+//	@Param			payload	body	BookmarkPostPayload	false	"Collection"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/bookmark [put]
+func (app *application) bookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload BookmarkPostPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if post.RepostOfID != nil {
+		app.statusBadRequest(w, r, ErrRepostTarget)
+		return
+	}
+
+	if err := app.store.Bookmark.Save(ctx, user.ID, post.ID, payload.CollectionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveBookmark godoc
+//
+//	@Summary		Removes a bookmark
+//	@Description	Removes a post from the user's bookmarks
+//	@Tags			bookmarks
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/bookmark [delete]
+func (app *application) removeBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Bookmark.Remove(ctx, user.ID, post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBookmarks godoc
+//
+//	@Summary		Lists bookmarks
+//	@Description	Lists the authenticated user's bookmarks, newest first
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			collection_id	query		int	false	"Collection ID"
+//	@Param			limit			query		int	false	"Page size"
+//	@Param			offset			query		int	false	"Page offset"
+//	@Success		200				{array}		store.Bookmark
+//	@Failure		400				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks [get]
+func (app *application) getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginatedQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	var collectionID *int64
+	if param := r.URL.Query().Get("collection_id"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			app.statusBadRequest(w, r, err)
+			return
+		}
+		collectionID = &id
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	bookmarks, err := app.store.Bookmark.GetByUser(ctx, user.ID, collectionID, pq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, bookmarks); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// GetBookmarkCollections godoc
+//
+//	@Summary		Lists bookmark collections
+//	@Description	Lists the authenticated user's bookmark collections
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Success		200	{array}		store.BookmarkCollection
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks/collections [get]
+func (app *application) getBookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	collections, err := app.store.Bookmark.GetCollections(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, collections); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// CreateBookmarkCollection godoc
+//
+//	@Summary		Creates a bookmark collection
+//	@Description	Creates a named collection to organize bookmarks
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateBookmarkCollectionPayload	true	"Collection"
+//	@Success		201		{object}	store.BookmarkCollection
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks/collections [post]
+func (app *application) createBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBookmarkCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	collection := &store.BookmarkCollection{
+		UserID: user.ID,
+		Name:   payload.Name,
+	}
+
+	if err := app.store.Bookmark.CreateCollection(ctx, collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicatedKey):
+			app.statusConflict(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusCreated, collection); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// DeleteBookmarkCollection godoc
+//
+//	@Summary		Deletes a bookmark collection
+//	@Description	Deletes a collection; its bookmarks are kept uncategorized
+//	@Tags			bookmarks
+//	@Param			collectionID	path	int	true	"Collection ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks/collections/{collectionID} [delete]
+func (app *application) deleteBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collectionID, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Bookmark.DeleteCollection(ctx, user.ID, collectionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
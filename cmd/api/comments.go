@@ -1,14 +1,45 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"social/internal/contentfilter"
 	"social/internal/store"
+	"social/internal/webhooks"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
 )
 
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+const defaultReplyDepth = 2
+
+var ErrInvalidReplyDepth = fmt.Errorf("depth must be between 0 and %d", store.MaxReplyDepth)
+
 type CreateCommentPayload struct {
+	Content  string `json:"content" validate:"required,max=200"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+type UpdateCommentPayload struct {
 	Content string `json:"content" validate:"required,max=200"`
 }
 
+type CommentLikesResponse struct {
+	LikeCount int64 `json:"like_count"`
+	Liked     bool  `json:"liked"`
+}
+
+type CommentsPage struct {
+	Comments   []store.Comment `json:"comments"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
 func (app *application) postCommentHandler(w http.ResponseWriter, r *http.Request) {
 	var payload CreateCommentPayload
 	if err := readJSON(w, r, &payload); err != nil {
@@ -23,20 +54,440 @@ func (app *application) postCommentHandler(w http.ResponseWriter, r *http.Reques
 
 	post := getPostFromCtx(r)
 	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if post.RepostOfID != nil {
+		app.statusBadRequest(w, r, ErrRepostTarget)
+		return
+	}
+
+	filtered, err := app.filterContent(ctx, &user, "", payload.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrContentRejected):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
 
 	comment := store.Comment{
-		UserID:  1,
-		PostID:  post.ID,
-		Content: payload.Content,
+		UserID:   user.ID,
+		Username: user.Username,
+		PostID:   post.ID,
+		ParentID: payload.ParentID,
+		Content:  payload.Content,
 	}
 
 	if err := app.store.Comment.Create(ctx, &comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidParentComment):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if filtered.Verdict == contentfilter.Hold {
+		comment.HiddenAt, err = app.holdContent(ctx, store.ReportTargetComment, comment.ID, user.ID, filtered)
+		if err != nil {
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+	}
+
+	if post.Status == store.PostStatusPublished && comment.HiddenAt == nil {
+		app.processMentions(ctx, user.ID, post.ID, &comment.ID, comment.Content)
+		app.notifyComment(ctx, post, &comment)
+		app.emitWebhook(ctx, webhooks.EventCommentCreated, []int64{user.ID, post.UserID}, CommentCreatedEvent{
+			CommentID: comment.ID,
+			PostID:    post.ID,
+			ParentID:  comment.ParentID,
+			UserID:    user.ID,
+			Content:   comment.Content,
+		})
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, comment); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// ListComments godoc
+//
+//	@Summary		Fetches the comments of a post
+//	@Description	Pages through the top-level comments of a post with a cursor
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			sort	query		string	false	"new, old or top"
+//	@Param			cursor	query		string	false	"Cursor of the next page"
+//	@Param			limit	query		int		false	"Page size"
+//	@Param			depth	query		int		false	"Reply levels to load (0-5)"
+//	@Success		200		{object}	CommentsPage
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [get]
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	cq, err := store.CursorQuery{Limit: 20, Sort: "new"}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	depth, err := parseReplyDepth(r, 0)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	comments, next, err := app.store.Comment.ListByPost(ctx, post.ID, user.ID, depth, cq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	page := CommentsPage{
+		Comments:   comments,
+		NextCursor: next,
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, page); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
+}
+
+// GetComment godoc
+//
+//	@Summary		Fetches a comment
+//	@Description	Fetches a comment of a post by ID
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID		path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Success		200			{object}	store.Comment
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [get]
+func (app *application) getCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
 
 	if err := app.JSONResponse(w, http.StatusOK, comment); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
 }
+
+// UpdateComment godoc
+//
+//	@Summary		Edits a comment
+//	@Description	Edits a comment; allowed for its author and moderators
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int						true	"Post ID"
+//	@Param			commentID	path		int						true	"Comment ID"
+//	@Param			payload		body		UpdateCommentPayload	true	"Comment"
+//	@Success		200			{object}	store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	comment := getCommentFromCtx(r)
+	comment.Content = payload.Content
+	ctx := r.Context()
+
+	filtered, err := app.filterEdit(ctx, comment.UserID, store.ReportTargetComment, comment.ID, "", comment.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrContentRejected):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Comment.Update(ctx, comment, contentHold(filtered)); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if filtered.Verdict == contentfilter.Hold {
+		app.logContentHold(ctx, store.ReportTargetComment, comment.ID, comment.UserID, filtered)
+	}
+
+	if post.Status == store.PostStatusPublished && comment.HiddenAt == nil {
+		app.processMentions(ctx, comment.UserID, post.ID, &comment.ID, comment.Content)
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, comment); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// DeleteComment godoc
+//
+//	@Summary		Deletes a comment
+//	@Description	Soft-deletes a comment and its replies; allowed for its author and admins
+//	@Tags			comments
+//	@Param			postID		path	int	true	"Post ID"
+//	@Param			commentID	path	int	true	"Comment ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Comment.Delete(ctx, comment.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("comment.delete", "comment", comment.ID, map[string]any{
+		"user_id": comment.UserID,
+		"post_id": comment.PostID,
+		"content": comment.Content,
+	}, nil))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCommentReplies godoc
+//
+//	@Summary		Fetches replies to a comment
+//	@Description	Fetches the replies to a comment in chronological order, with nested replies up to depth
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID		path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Param			depth		query		int	false	"Reply levels to load (1-5)"
+//	@Param			limit		query		int	false	"Page size"
+//	@Param			offset		query		int	false	"Page offset"
+//	@Success		200			{array}		store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/replies [get]
+func (app *application) getCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	depth, err := parseReplyDepth(r, 1)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	pq, err := store.PaginatedQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	comment := getCommentFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	replies, err := app.store.Comment.GetReplies(ctx, comment.ID, user.ID, depth, pq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, replies); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// LikeComment godoc
+//
+//	@Summary		Likes a comment
+//	@Description	Likes a comment as the authenticated user
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID		path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Success		200			{object}	CommentLikesResponse
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/like [put]
+func (app *application) likeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	count, err := app.store.Comment.Like(ctx, comment.ID, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, CommentLikesResponse{LikeCount: count, Liked: true}); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// UnlikeComment godoc
+//
+//	@Summary		Removes a like from a comment
+//	@Description	Removes the authenticated user's like from a comment
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID		path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Success		200			{object}	CommentLikesResponse
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/like [delete]
+func (app *application) unlikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	count, err := app.store.Comment.Unlike(ctx, comment.ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, CommentLikesResponse{LikeCount: count}); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.statusBadRequest(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		comment, err := app.store.Comment.GetById(ctx, commentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.statusNotFound(w, r, err)
+			default:
+				app.statusInternalServerError(w, r, err)
+			}
+			return
+		}
+
+		post := getPostFromCtx(r)
+		if comment.PostID != post.ID || comment.DeletedAt != nil {
+			app.statusNotFound(w, r, store.ErrNotFound)
+			return
+		}
+
+		if comment.HiddenAt != nil {
+			user := ctx.Value(userCtxKey).(store.User)
+			visible, err := app.canSeeHidden(ctx, &user, comment.UserID)
+			if err != nil {
+				app.statusInternalServerError(w, r, err)
+				return
+			}
+
+			if !visible {
+				app.statusNotFound(w, r, store.ErrNotFound)
+				return
+			}
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, &comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
+
+// parseReplyDepth reads the depth query parameter, bounded by
+// store.MaxReplyDepth.
+func parseReplyDepth(r *http.Request, fallback int) (int, error) {
+	param := r.URL.Query().Get("depth")
+	if param == "" {
+		return fallback, nil
+	}
+
+	depth, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, err
+	}
+
+	if depth < 0 || depth > store.MaxReplyDepth {
+		return 0, ErrInvalidReplyDepth
+	}
+
+	return depth, nil
+}
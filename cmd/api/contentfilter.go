@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"social/internal/contentfilter"
+	"social/internal/store"
+	"time"
+)
+
+var ErrContentRejected = errors.New("content rejected")
+
+type contentFilterConfig struct {
+	enabled            bool
+	rejectWords        []string
+	holdWords          []string
+	deniedDomains      []string
+	maxLinks           int
+	maxLinkPercent     int
+	repeatWindow       time.Duration
+	maxRepeats         int
+	newAccountAge      time.Duration
+	newAccountWindow   time.Duration
+	newAccountMaxPosts int
+}
+
+// newContentFilter builds the filter chain posts and comments go through.
+// Rejections come first so the chain stops early on them; it returns nil,
+// which allows everything, when filtering is disabled.
+func newContentFilter(cfg contentFilterConfig, history contentfilter.History) *contentfilter.Chain {
+	if !cfg.enabled {
+		return nil
+	}
+
+	return contentfilter.NewChain(
+		contentfilter.NewWordList(contentfilter.Reject, cfg.rejectWords),
+		contentfilter.NewDomainDenyList(cfg.deniedDomains),
+		contentfilter.NewWordList(contentfilter.Hold, cfg.holdWords),
+		contentfilter.LinkDensity{
+			MaxLinks: cfg.maxLinks,
+			MaxRatio: float64(cfg.maxLinkPercent) / 100,
+		},
+		contentfilter.RepeatedContent{
+			History:    history,
+			Window:     cfg.repeatWindow,
+			MaxRepeats: cfg.maxRepeats,
+		},
+		contentfilter.NewAccountVelocity{
+			History:      history,
+			AccountAge:   cfg.newAccountAge,
+			Window:       cfg.newAccountWindow,
+			MaxPerWindow: cfg.newAccountMaxPosts,
+		},
+	)
+}
+
+// filterContent runs what the user is about to store through the content
+// filters. Rejections are returned as errors wrapping ErrContentRejected
+// with the reason, which is meant for the user.
+func (app *application) filterContent(ctx context.Context, user *store.User, title, body string) (contentfilter.Result, error) {
+	return app.checkContent(ctx, user, contentfilter.Content{Title: title, Body: body})
+}
+
+// filterEdit runs an edit of a stored post or comment through the content
+// filters like filterContent. The author's history is checked without the
+// edited item, whoever makes the edit.
+func (app *application) filterEdit(ctx context.Context, authorID int64, targetType string, targetID int64, title, body string) (contentfilter.Result, error) {
+	author, err := app.getUser(ctx, authorID)
+	if err != nil {
+		return contentfilter.Result{}, err
+	}
+
+	return app.checkContent(ctx, &author, contentfilter.Content{
+		Title:      title,
+		Body:       body,
+		EditedType: targetType,
+		EditedID:   targetID,
+	})
+}
+
+func (app *application) checkContent(ctx context.Context, author *store.User, c contentfilter.Content) (contentfilter.Result, error) {
+	c.AuthorID = author.ID
+	c.AuthorCreatedAt, _ = time.Parse(time.RFC3339, author.CreatedAt)
+
+	res, err := app.contentFilter.Check(ctx, c)
+	if err != nil {
+		return contentfilter.Result{}, err
+	}
+
+	if res.Verdict == contentfilter.Reject {
+		return res, fmt.Errorf("%w: %s", ErrContentRejected, res.Reason())
+	}
+
+	return res, nil
+}
+
+// holdContent hides a post or comment the filters held and queues it for
+// moderators, returning when it was hidden.
+func (app *application) holdContent(ctx context.Context, targetType string, targetID, authorID int64, res contentfilter.Result) (*string, error) {
+	hiddenAt, err := app.store.Moderation.Hold(ctx, targetType, targetID, authorID, res.Reason())
+	if err != nil {
+		return nil, err
+	}
+
+	app.logContentHold(ctx, targetType, targetID, authorID, res)
+
+	return &hiddenAt, nil
+}
+
+// contentHold is what an update has to hold for a filter result, nil when
+// the result does not hold the content.
+func contentHold(res contentfilter.Result) *store.ContentHold {
+	if res.Verdict != contentfilter.Hold {
+		return nil
+	}
+
+	return &store.ContentHold{Reason: res.Reason()}
+}
+
+// logContentHold records that a post or comment was held for review.
+func (app *application) logContentHold(ctx context.Context, targetType string, targetID, authorID int64, res contentfilter.Result) {
+	app.logger.Infow("content held for review", "type", targetType, "id", targetID, "reason", res.Reason())
+	app.recordAudit(ctx, auditEvent("content.hold", targetType, targetID, nil, map[string]any{
+		"author_id": authorID,
+		"reason":    res.Reason(),
+	}))
+}
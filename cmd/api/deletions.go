@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"social/internal/audit"
+	"social/internal/store"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// purgeBatchSize bounds how many posts or comments one purge transaction
+// removes.
+const purgeBatchSize = 500
+
+var ErrCannotRestore = errors.New("only admins can restore content they did not delete themselves")
+
+type retentionConfig struct {
+	deletedRetention time.Duration
+	purgeInterval    time.Duration
+}
+
+// canRestore reports whether the user may restore deleted content: authors
+// can undo their own deletions, admins can undo any.
+func (app *application) canRestore(ctx context.Context, user *store.User, ownerID int64, deletedBy *int64) (bool, error) {
+	if user.ID == ownerID && deletedBy != nil && *deletedBy == ownerID {
+		return true, nil
+	}
+
+	return app.checkRolePrecedence(ctx, user, "admin")
+}
+
+// RestorePost godoc
+//
+//	@Summary		Restores a deleted post
+//	@Description	Restores a post that was deleted and not purged yet. Authors can restore posts they deleted, admins any post
+//	@Tags			posts
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/restore [put]
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	post, err := app.store.Post.GetById(ctx, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if post.DeletedAt == nil {
+		app.statusNotFound(w, r, store.ErrNotFound)
+		return
+	}
+
+	allowed, err := app.canRestore(ctx, &user, post.UserID, post.DeletedBy)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if !allowed {
+		app.forbiddenResponse(w, r, ErrCannotRestore)
+		return
+	}
+
+	if err := app.store.Post.Restore(ctx, post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		case errors.Is(err, store.ErrDuplicatedKey):
+			app.statusConflict(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("post.restore", "post", post.ID,
+		map[string]any{"deleted_at": post.DeletedAt, "deleted_by": post.DeletedBy}, nil))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreComment godoc
+//
+//	@Summary		Restores a deleted comment
+//	@Description	Restores a comment that was deleted and not purged yet, with its replies. Authors can restore comments they deleted, admins any comment
+//	@Tags			comments
+//	@Param			postID		path	int	true	"Post ID"
+//	@Param			commentID	path	int	true	"Comment ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/restore [put]
+func (app *application) restoreCommentHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+	post := getPostFromCtx(r)
+
+	comment, err := app.store.Comment.GetById(ctx, commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if comment.PostID != post.ID || comment.DeletedAt == nil {
+		app.statusNotFound(w, r, store.ErrNotFound)
+		return
+	}
+
+	allowed, err := app.canRestore(ctx, &user, comment.UserID, comment.DeletedBy)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if !allowed {
+		app.forbiddenResponse(w, r, ErrCannotRestore)
+		return
+	}
+
+	if err := app.store.Comment.Restore(ctx, comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("comment.restore", "comment", comment.ID,
+		map[string]any{"deleted_at": comment.DeletedAt, "deleted_by": comment.DeletedBy}, nil))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HidePost godoc
+//
+//	@Summary		Hides a post
+//	@Description	Hides a post from everyone but its author and moderators, without deleting it
+//	@Tags			moderation
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/hide [put]
+func (app *application) hidePostHandler(w http.ResponseWriter, r *http.Request) {
+	app.setPostHidden(w, r, true)
+}
+
+// UnhidePost godoc
+//
+//	@Summary		Unhides a post
+//	@Description	Makes a hidden post visible again
+//	@Tags			moderation
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/hide [delete]
+func (app *application) unhidePostHandler(w http.ResponseWriter, r *http.Request) {
+	app.setPostHidden(w, r, false)
+}
+
+func (app *application) setPostHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	post := getPostFromCtx(r)
+
+	if err := app.store.Post.SetHidden(r.Context(), post.ID, hidden); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("post.hide", "post", post.ID,
+		map[string]bool{"hidden": post.HiddenAt != nil}, map[string]bool{"hidden": hidden}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HideComment godoc
+//
+//	@Summary		Hides a comment
+//	@Description	Hides a comment and its replies from everyone but its author and moderators, without deleting it
+//	@Tags			moderation
+//	@Param			postID		path	int	true	"Post ID"
+//	@Param			commentID	path	int	true	"Comment ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/hide [put]
+func (app *application) hideCommentHandler(w http.ResponseWriter, r *http.Request) {
+	app.setCommentHidden(w, r, true)
+}
+
+// UnhideComment godoc
+//
+//	@Summary		Unhides a comment
+//	@Description	Makes a hidden comment visible again
+//	@Tags			moderation
+//	@Param			postID		path	int	true	"Post ID"
+//	@Param			commentID	path	int	true	"Comment ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/hide [delete]
+func (app *application) unhideCommentHandler(w http.ResponseWriter, r *http.Request) {
+	app.setCommentHidden(w, r, false)
+}
+
+func (app *application) setCommentHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	comment := getCommentFromCtx(r)
+
+	if err := app.store.Comment.SetHidden(r.Context(), comment.ID, hidden); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("comment.hide", "comment", comment.ID,
+		map[string]bool{"hidden": comment.HiddenAt != nil}, map[string]bool{"hidden": hidden}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeDeleted permanently removes the posts and comments deleted longer
+// than the retention period ago.
+func (app *application) purgeDeleted(ctx context.Context) {
+	before := time.Now().Add(-app.config.retention.deletedRetention)
+
+	purge := func(kind string, fn func(context.Context, time.Time, int) (int64, error)) {
+		for {
+			purged, err := fn(ctx, before, purgeBatchSize)
+			if err != nil {
+				app.logger.Errorw("error purging deleted content", "kind", kind, "error", err)
+				return
+			}
+
+			if purged > 0 {
+				app.logger.Infow("deleted content purged", "kind", kind, "count", purged)
+				app.recordAudit(ctx, audit.Event{
+					Action:     "content.purge",
+					TargetType: kind,
+					After:      audit.JSON(map[string]any{"count": purged, "deleted_before": before.UTC()}),
+				})
+			}
+
+			if purged < purgeBatchSize {
+				return
+			}
+		}
+	}
+
+	purge("posts", app.store.Post.Purge)
+	purge("comments", app.store.Comment.Purge)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"social/internal/mailer"
+	"social/internal/store"
+	"strconv"
+	"time"
+)
+
+const (
+	digestFollowers     = 5
+	digestPosts         = 5
+	digestNotifications = 5
+)
+
+var ErrInvalidUnsubscribeLink = errors.New("invalid unsubscribe link")
+
+// unsubscribeConfirmation is the page of the unsubscribe link. Its form
+// posts back to the link, so only the confirmation unsubscribes and link
+// scanners opening the emails do not.
+var unsubscribeConfirmation = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe from digests</title></head>
+<body>
+<form method="post">
+<p>Stop receiving email digests from GopherSocial?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+type digestConfig struct {
+	enabled   bool
+	interval  time.Duration
+	batchSize int
+	// secret signs the unsubscribe links.
+	secret string
+	// unsubscribeURL is where the unsubscribe links of the emails point.
+	unsubscribeURL string
+}
+
+type DigestPayload struct {
+	Frequency string `json:"frequency" validate:"required,oneof=daily weekly"`
+}
+
+type digestPost struct {
+	store.DigestPost
+	URL string
+}
+
+// unsubscribeSignature signs the unsubscribe link of a user, so the link
+// works without signing in but only for that user.
+func (app *application) unsubscribeSignature(userID int64) string {
+	mac := hmac.New(sha256.New, []byte(app.config.digest.secret))
+	fmt.Fprintf(mac, "digest-unsubscribe:%d", userID)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (app *application) unsubscribeURL(userID int64) string {
+	q := url.Values{}
+	q.Set("user", strconv.FormatInt(userID, 10))
+	q.Set("sig", app.unsubscribeSignature(userID))
+
+	return app.config.digest.unsubscribeURL + "?" + q.Encode()
+}
+
+// sendDigests emails the digests that are due, batch by batch. A digest is
+// marked as sent before it is emailed, so a failed email is skipped rather
+// than sent twice.
+func (app *application) sendDigests(ctx context.Context) {
+	for {
+		due, err := app.store.Digest.ClaimDue(ctx, time.Now(), app.config.digest.batchSize)
+		if err != nil {
+			app.logger.Errorw("error claiming due digests", "error", err)
+			return
+		}
+
+		for _, d := range due {
+			if err := app.sendDigest(ctx, &d); err != nil {
+				app.logger.Errorw("error sending digest", "user", d.UserID, "error", err)
+			}
+		}
+
+		if len(due) == 0 || len(due) < app.config.digest.batchSize {
+			return
+		}
+	}
+}
+
+func (app *application) sendDigest(ctx context.Context, d *store.DueDigest) error {
+	digest := store.Digest{}
+
+	followers, count, err := app.store.Digest.GetNewFollowers(ctx, d.UserID, d.Since, digestFollowers)
+	if err != nil {
+		return err
+	}
+	digest.NewFollowers, digest.NewFollowerCount = followers, count
+
+	digest.TopPosts, err = app.store.Digest.GetTopPosts(ctx, d.UserID, d.Since, digestPosts)
+	if err != nil {
+		return err
+	}
+
+	counts, err := app.store.Notification.GetUnreadCounts(ctx, d.UserID)
+	if err != nil {
+		return err
+	}
+	for _, c := range counts {
+		digest.Unread += c
+	}
+
+	if digest.Unread > 0 {
+		page := store.PaginatedQuery{Limit: digestNotifications}
+		digest.Notifications, err = app.store.Notification.GetGroups(ctx, d.UserID, true, page)
+		if err != nil {
+			return err
+		}
+	}
+
+	if digest.Empty() {
+		return nil
+	}
+
+	posts := make([]digestPost, 0, len(digest.TopPosts))
+	for _, p := range digest.TopPosts {
+		posts = append(posts, digestPost{DigestPost: p, URL: fmt.Sprintf("%s/posts/%d", app.config.frontendURL, p.ID)})
+	}
+
+	vars := struct {
+		Username         string
+		Frequency        string
+		NewFollowers     []store.DigestFollower
+		NewFollowerCount int64
+		TopPosts         []digestPost
+		Unread           int64
+		Notifications    []store.NotificationGroup
+		NotificationsURL string
+		UnsubscribeURL   string
+	}{
+		Username:         d.Username,
+		Frequency:        d.Frequency,
+		NewFollowers:     digest.NewFollowers,
+		NewFollowerCount: digest.NewFollowerCount,
+		TopPosts:         posts,
+		Unread:           digest.Unread,
+		Notifications:    digest.Notifications,
+		NotificationsURL: app.config.frontendURL + "/notifications",
+		UnsubscribeURL:   app.unsubscribeURL(d.UserID),
+	}
+	isProdEnv := app.config.env == "production"
+
+	return app.mailer.Send(mailer.DigestTemplate, d.Username, d.Email, vars, !isProdEnv, mailer.ListUnsubscribe(vars.UnsubscribeURL)...)
+}
+
+// GetDigestSubscription godoc
+//
+//	@Summary		Fetches the digest subscription
+//	@Description	Fetches the email digest subscription of the current user
+//	@Tags			digests
+//	@Produce		json
+//	@Success		200	{object}	store.DigestSubscription
+//	@Failure		404	{object}	error	"Not subscribed"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/digest [get]
+func (app *application) getDigestSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	sub, err := app.store.Digest.Get(ctx, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, sub); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// SubscribeDigest godoc
+//
+//	@Summary		Subscribes to email digests
+//	@Description	Subscribes the current user to daily or weekly email digests of their new followers, top posts from the people they follow and unread notifications, or changes the frequency. The first digest comes one period later
+//	@Tags			digests
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DigestPayload	true	"Digest frequency"
+//	@Success		200		{object}	store.DigestSubscription
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/digest [put]
+func (app *application) subscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DigestPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	sub, err := app.store.Digest.Subscribe(ctx, user.ID, payload.Frequency)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, sub); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// UnsubscribeDigest godoc
+//
+//	@Summary		Unsubscribes from email digests
+//	@Description	Stops the email digests of the current user
+//	@Tags			digests
+//	@Success		204
+//	@Failure		404	{object}	error	"Not subscribed"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/digest [delete]
+func (app *application) unsubscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Digest.Unsubscribe(ctx, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ConfirmUnsubscribeDigest godoc
+//
+//	@Summary		Shows the confirmation of an unsubscribe link
+//	@Description	Serves the page of the signed link of a digest email, whose form unsubscribes with a POST to the same link
+//	@Tags			digests
+//	@Produce		html
+//	@Param			user	query	int		true	"User ID"
+//	@Param			sig		query	string	true	"Link signature"
+//	@Success		200
+//	@Failure		403	{object}	error
+//	@Router			/digests/unsubscribe [get]
+func (app *application) confirmUnsubscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.unsubscribeLinkUser(r); !ok {
+		app.forbiddenResponse(w, r, ErrInvalidUnsubscribeLink)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := unsubscribeConfirmation.Execute(w, nil); err != nil {
+		app.logger.Errorw("error rendering unsubscribe confirmation", "error", err)
+	}
+}
+
+// UnsubscribeDigestLink godoc
+//
+//	@Summary		Unsubscribes from email digests with a link
+//	@Description	Stops the email digests of a user from the signed link of a digest email, without signing in. Mail clients post to it for one-click unsubscription. Unsubscribing twice succeeds
+//	@Tags			digests
+//	@Param			user	query	int		true	"User ID"
+//	@Param			sig		query	string	true	"Link signature"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/digests/unsubscribe [post]
+func (app *application) unsubscribeDigestLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.unsubscribeLinkUser(r)
+	if !ok {
+		app.forbiddenResponse(w, r, ErrInvalidUnsubscribeLink)
+		return
+	}
+
+	if err := app.store.Digest.Unsubscribe(r.Context(), userID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unsubscribeLinkUser returns the user of a signed unsubscribe link, and
+// false when the request does not carry a valid one.
+func (app *application) unsubscribeLinkUser(r *http.Request) (int64, bool) {
+	q := r.URL.Query()
+
+	userID, err := strconv.ParseInt(q.Get("user"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return userID, hmac.Equal([]byte(q.Get("sig")), []byte(app.unsubscribeSignature(userID)))
+}
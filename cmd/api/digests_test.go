@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"social/internal/store"
+	"testing"
+	"time"
+)
+
+// memoryDigests records the users who unsubscribed.
+type memoryDigests struct {
+	unsubscribed []int64
+}
+
+func (d *memoryDigests) Get(context.Context, int64) (store.DigestSubscription, error) {
+	return store.DigestSubscription{}, store.ErrNotFound
+}
+
+func (d *memoryDigests) Subscribe(_ context.Context, userID int64, frequency string) (store.DigestSubscription, error) {
+	return store.DigestSubscription{UserID: userID, Frequency: frequency}, nil
+}
+
+func (d *memoryDigests) Unsubscribe(_ context.Context, userID int64) error {
+	d.unsubscribed = append(d.unsubscribed, userID)
+	return nil
+}
+
+func (d *memoryDigests) ClaimDue(context.Context, time.Time, int) ([]store.DueDigest, error) {
+	return nil, nil
+}
+
+func (d *memoryDigests) GetNewFollowers(context.Context, int64, time.Time, int) ([]store.DigestFollower, int64, error) {
+	return nil, 0, nil
+}
+
+func (d *memoryDigests) GetTopPosts(context.Context, int64, time.Time, int) ([]store.DigestPost, error) {
+	return nil, nil
+}
+
+func TestUnsubscribeDigestLink(t *testing.T) {
+	app := newTestApplication(t, config{digest: digestConfig{secret: "secret", unsubscribeURL: "http://api/v1/digests/unsubscribe"}})
+	digests := &memoryDigests{}
+	app.store.Digest = digests
+	mux := app.mount()
+
+	link, err := url.Parse(app.unsubscribeURL(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should reject a signature of another user", func(t *testing.T) {
+		q := link.Query()
+		q.Set("user", "2")
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/digests/unsubscribe?"+q.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should reject a link without signature", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/digests/unsubscribe?user=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+	t.Run("should only confirm on GET", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/digests/unsubscribe?"+link.RawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if len(digests.unsubscribed) != 0 {
+			t.Errorf("unsubscribed %v on GET, want nobody", digests.unsubscribed)
+		}
+	})
+
+	t.Run("should unsubscribe on POST", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/digests/unsubscribe?"+link.RawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+		if len(digests.unsubscribed) != 1 || digests.unsubscribed[0] != 1 {
+			t.Errorf("unsubscribed %v, want [1]", digests.unsubscribed)
+		}
+	})
+}
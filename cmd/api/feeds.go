@@ -1,20 +1,31 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"social/internal/ranking"
 	"social/internal/store"
+	"time"
+)
+
+const (
+	// rankedFeedPoolSize is how many of the latest feed posts are ranked;
+	// older posts are only reachable in chronological mode.
+	rankedFeedPoolSize = 200
+	affinityWindow     = time.Hour * 24 * 30
 )
 
 // GetFeed godoc
 //
 //	@Summary		Fetches posts
-//	@Description	Fetches posts related to the user
+//	@Description	Fetches posts related to the user, newest first or ranked with mode=ranked
 //	@Tags			feed
 //	@Produce		json
-//	@Success		200	{object}	store.PostWithMetadata
-//	@Failure		400	{object}	error
-//	@Failure		401	{object}	error
-//	@Failure		500	{object}	error
+//	@Param			mode	query		string	false	"chronological or ranked"
+//	@Success		200		{object}	store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
@@ -22,6 +33,7 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		Limit:  10,
 		Offset: 2,
 		Sort:   "desc",
+		Mode:   "chronological",
 	}
 	fq, err := fq.Parse(r)
 	if err != nil {
@@ -35,8 +47,14 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
 
-	feed, err := app.store.Post.GetUserFeed(ctx, int64(1), fq)
+	var feed []store.PostWithMetadata
+	if fq.Mode == "ranked" {
+		feed, err = app.getRankedFeed(ctx, user.ID, fq)
+	} else {
+		feed, err = app.getChronologicalFeed(ctx, user.ID, fq)
+	}
 	if err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
@@ -47,3 +65,91 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 }
+
+// getChronologicalFeed serves unfiltered, newest-first pages from the cached
+// timelines when they are enabled and the SQL feed query otherwise.
+func (app *application) getChronologicalFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	if app.timelinesEnabled() && fq.Sort == "desc" && fq.Search == "" && len(fq.Tags) == 0 {
+		feed, ok, err := app.getTimelineFeed(ctx, userID, fq)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return feed, nil
+		}
+	}
+
+	return app.store.Post.GetUserFeed(ctx, userID, fq)
+}
+
+// getRankedFeed ranks the latest posts of the user's feed and returns the
+// requested page of the ranking.
+func (app *application) getRankedFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	pool := fq
+	pool.Limit = rankedFeedPoolSize
+	pool.Offset = 0
+	pool.Sort = "desc"
+
+	posts, err := app.store.Post.GetUserFeed(ctx, userID, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	authorIDs := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		authorIDs = append(authorIDs, p.UserID)
+	}
+
+	affinity, err := app.store.Post.GetAuthorAffinity(ctx, userID, authorIDs, time.Now().Add(-affinityWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]store.PostWithMetadata, len(posts))
+	candidates := make([]ranking.Candidate, 0, len(posts))
+	for _, p := range posts {
+		byID[p.ID] = p
+		candidates = append(candidates, feedCandidate(p, affinity[p.UserID]))
+	}
+
+	ranked := app.ranker.Rank(candidates)
+
+	start := min(fq.Offset, len(ranked))
+	end := min(start+fq.Limit, len(ranked))
+
+	feed := make([]store.PostWithMetadata, 0, end-start)
+	for _, s := range ranked[start:end] {
+		feed = append(feed, byID[s.PostID])
+	}
+
+	return feed, nil
+}
+
+// feedCandidate turns a feed post into a ranking candidate. A repost is
+// dated by when it was reposted, like in the chronological feed.
+func feedCandidate(p store.PostWithMetadata, affinity int64) ranking.Candidate {
+	activityAt := p.CreatedAt
+	switch {
+	case p.RepostedBy != nil:
+		activityAt = p.RepostedBy.RepostedAt
+	case p.PublishAt != nil:
+		activityAt = *p.PublishAt
+	}
+
+	publishedAt, _ := time.Parse(time.RFC3339, activityAt)
+
+	var reactions int64
+	for _, count := range p.Reactions {
+		reactions += count
+	}
+
+	return ranking.Candidate{
+		PostID:      p.ID,
+		AuthorID:    p.UserID,
+		PublishedAt: publishedAt,
+		Reactions:   reactions,
+		Comments:    p.CommentCount,
+		Affinity:    affinity,
+	}
+}
@@ -3,13 +3,18 @@ package main
 import (
 	"expvar"
 	"runtime"
+	"social/internal/audit"
 	"social/internal/auth"
 	"social/internal/db"
 	env "social/internal/env"
 	"social/internal/mailer"
+	"social/internal/ranking"
 	ratelimiter "social/internal/ratelimiter"
 	"social/internal/store"
 	"social/internal/store/cache"
+	"social/internal/stream"
+	"social/internal/webhooks"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -79,6 +84,60 @@ func main() {
 			TimeFrame:            time.Second * 5,
 			Enabled:              env.GetBool("RATE_LIMITER_ENABLED", true),
 		},
+		scheduler: schedulerConfig{
+			enabled:   env.GetBool("SCHEDULER_ENABLED", true),
+			interval:  time.Second * time.Duration(env.GetInt("SCHEDULER_INTERVAL_SECONDS", 30)),
+			batchSize: env.GetInt("SCHEDULER_BATCH_SIZE", 100),
+		},
+		posts: postsConfig{
+			maxPinned: env.GetInt("MAX_PINNED_POSTS", 3),
+		},
+		timeline: timelineConfig{
+			enabled:         env.GetBool("TIMELINE_CACHE_ENABLED", true),
+			maxLength:       env.GetInt("TIMELINE_MAX_LENGTH", 800),
+			fanOutThreshold: env.GetInt("TIMELINE_FANOUT_THRESHOLD", 10000),
+		},
+		tags: tagsConfig{
+			trendingWindow:   time.Minute * time.Duration(env.GetInt("TRENDING_WINDOW_MINUTES", 60)),
+			trendingBaseline: time.Hour * time.Duration(env.GetInt("TRENDING_BASELINE_HOURS", 24*7)),
+			refreshInterval:  time.Second * time.Duration(env.GetInt("TRENDING_REFRESH_SECONDS", 300)),
+		},
+		filter: contentFilterConfig{
+			enabled:            env.GetBool("CONTENT_FILTER_ENABLED", true),
+			rejectWords:        strings.Split(env.GetString("CONTENT_FILTER_REJECT_WORDS", ""), ","),
+			holdWords:          strings.Split(env.GetString("CONTENT_FILTER_HOLD_WORDS", ""), ","),
+			deniedDomains:      strings.Split(env.GetString("CONTENT_FILTER_DENIED_DOMAINS", ""), ","),
+			maxLinks:           env.GetInt("CONTENT_FILTER_MAX_LINKS", 3),
+			maxLinkPercent:     env.GetInt("CONTENT_FILTER_MAX_LINK_PERCENT", 60),
+			repeatWindow:       time.Hour * time.Duration(env.GetInt("CONTENT_FILTER_REPEAT_WINDOW_HOURS", 24)),
+			maxRepeats:         env.GetInt("CONTENT_FILTER_MAX_REPEATS", 2),
+			newAccountAge:      time.Hour * time.Duration(env.GetInt("CONTENT_FILTER_NEW_ACCOUNT_HOURS", 24)),
+			newAccountWindow:   time.Hour,
+			newAccountMaxPosts: env.GetInt("CONTENT_FILTER_NEW_ACCOUNT_MAX_POSTS", 5),
+		},
+		retention: retentionConfig{
+			deletedRetention: time.Hour * 24 * time.Duration(env.GetInt("DELETED_RETENTION_DAYS", 30)),
+			purgeInterval:    time.Minute * time.Duration(env.GetInt("PURGE_INTERVAL_MINUTES", 60)),
+		},
+		digest: digestConfig{
+			enabled:        env.GetBool("DIGEST_ENABLED", true),
+			interval:       time.Minute * time.Duration(env.GetInt("DIGEST_INTERVAL_MINUTES", 15)),
+			batchSize:      env.GetInt("DIGEST_BATCH_SIZE", 100),
+			secret:         env.GetString("DIGEST_SECRET", "example"),
+			unsubscribeURL: env.GetString("DIGEST_UNSUBSCRIBE_URL", "http://localhost:8081/v1/digests/unsubscribe"),
+		},
+		webhooks: webhookConfig{
+			enabled:      env.GetBool("WEBHOOKS_ENABLED", true),
+			interval:     time.Second * time.Duration(env.GetInt("WEBHOOKS_INTERVAL_SECONDS", 10)),
+			batchSize:    env.GetInt("WEBHOOKS_BATCH_SIZE", 100),
+			timeout:      time.Second * time.Duration(env.GetInt("WEBHOOKS_TIMEOUT_SECONDS", 10)),
+			allowPrivate: env.GetBool("WEBHOOKS_ALLOW_PRIVATE", false),
+		},
+		outbox: outboxConfig{
+			interval:  time.Second * time.Duration(env.GetInt("OUTBOX_INTERVAL_SECONDS", 2)),
+			batchSize: env.GetInt("OUTBOX_BATCH_SIZE", 100),
+			retention: time.Hour * 24 * time.Duration(env.GetInt("OUTBOX_RETENTION_DAYS", 7)),
+		},
 	}
 
 	logger := zap.Must(zap.NewProduction()).Sugar()
@@ -114,6 +173,14 @@ func main() {
 	)
 
 	cacheStore := cache.NewRedisStorage(redis)
+
+	webhookStore := webhooks.NewPostgresStore(db)
+	webhookClient := webhooks.NewHTTPClient(cfg.webhooks.timeout, cfg.webhooks.allowPrivate && cfg.env != "production")
+
+	var streamBackend stream.Backend = stream.NewLocalBackend(streamHistory)
+	if cfg.redisCfg.enabled {
+		streamBackend = stream.NewRedisBackend(redis, streamHistory)
+	}
 	store := store.NewPostgresStorage(db)
 
 	mailtrap, err := mailer.NewMailTrapClient(cfg.mail.mailTrap.apiKey, cfg.mail.fromEmail)
@@ -135,6 +202,14 @@ func main() {
 		mailer:        mailtrap,
 		authenticator: jwtAuthenticator,
 		rateLimiter:   rateLimiter,
+		ranker:        ranking.New(ranking.DefaultScorers()...),
+		contentFilter: newContentFilter(cfg.filter, store.Post),
+		auditLog:      audit.NewPostgresStore(db),
+		auditQueue:    make(chan audit.Event, auditQueueSize),
+		streams:       stream.NewHub(streamBackend),
+
+		webhooks:          webhookStore,
+		webhookDispatcher: webhooks.NewDispatcher(webhookStore, webhookClient),
 	}
 
 	mux := app.mount()
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"social/internal/entities"
+	"social/internal/mailer"
+	"social/internal/store"
+)
+
+const mentionExcerptLength = 140
+
+// mergeHashtags adds the #hashtags found in content to the given tags,
+// lowercasing them all.
+func mergeHashtags(tags []string, content string) []string {
+	return entities.MergeTags(tags, entities.Hashtags(entities.Parse(content)))
+}
+
+// processMentions records the @mentions of a published post or comment,
+// dropping the ones an edit removed, and e-mails the users mentioned for the
+// first time. Failures are only logged:
+// the content is already saved and mentions must not fail the request.
+func (app *application) processMentions(ctx context.Context, authorID, postID int64, commentID *int64, content string) {
+	usernames := entities.Mentions(entities.Parse(content))
+
+	mentioned, err := app.store.Mention.Create(ctx, authorID, postID, commentID, usernames)
+	if err != nil {
+		app.logger.Errorw("error saving mentions", "post", postID, "error", err)
+		return
+	}
+
+	if len(mentioned) == 0 {
+		return
+	}
+
+	groupKey := store.PostGroupKey(postID)
+	if commentID != nil {
+		groupKey = store.CommentGroupKey(*commentID)
+	}
+	for _, user := range mentioned {
+		app.notify(ctx, &store.Notification{
+			UserID:    user.ID,
+			Type:      store.NotificationMention,
+			ActorID:   authorID,
+			PostID:    &postID,
+			CommentID: commentID,
+			GroupKey:  groupKey,
+		})
+	}
+
+	author, err := app.store.User.GetById(ctx, authorID)
+	if err != nil {
+		app.logger.Errorw("error fetching mention author", "user", authorID, "error", err)
+		return
+	}
+
+	excerpt := []rune(content)
+	if len(excerpt) > mentionExcerptLength {
+		excerpt = append(excerpt[:mentionExcerptLength], '…')
+	}
+
+	vars := struct {
+		Username       string
+		AuthorUsername string
+		InComment      bool
+		Excerpt        string
+		PostURL        string
+	}{
+		AuthorUsername: author.Username,
+		InComment:      commentID != nil,
+		Excerpt:        string(excerpt),
+		PostURL:        fmt.Sprintf("%s/posts/%d", app.config.frontendURL, postID),
+	}
+	isProdEnv := app.config.env == "production"
+
+	// the mailer retries with backoff, so keep it off the request path
+	go func() {
+		for _, user := range mentioned {
+			vars.Username = user.Username
+			if err := app.mailer.Send(mailer.UserMentionTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+				app.logger.Errorw("error sending mention email", "user", user.ID, "error", err)
+			}
+		}
+	}()
+}
@@ -5,11 +5,16 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 	"social/internal/store"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-redis/redis/v8"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -19,12 +24,16 @@ var (
 	ErrorMalformedAuthHeader = errors.New("authorization header is malformed")
 	ErrorInvalidCredentials  = errors.New("invalid credentials")
 	ErrorBearerTokenMissing  = errors.New("missing bearer token from header")
+	ErrorTokenRevoked        = errors.New("token was issued before the last password reset")
 )
 
 type userCtx string
 
 var (
 	userCtxKey userCtx = "userCtx"
+	// impersonatorCtxKey holds the ID of the admin acting as the user when
+	// the request carries an impersonation token.
+	impersonatorCtxKey userCtx = "impersonatorCtx"
 )
 
 func (app *application) basicAuthMiddleware() func(http.Handler) http.Handler {
@@ -104,6 +113,25 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if tokenRevoked(jwtToken, &user) {
+			app.statusUnauthorized(w, r, ErrorTokenRevoked)
+			return
+		}
+
+		if user.IsSuspended(time.Now()) {
+			app.forbiddenResponse(w, r, suspendedError(&user))
+			return
+		}
+
+		if impersonatorID, ok := impersonatorFromClaims(claims); ok {
+			app.logger.Infow("impersonated request",
+				"impersonator", impersonatorID, "user", user.ID, "method", r.Method, "path", r.URL.Path)
+
+			ctx = context.WithValue(ctx, impersonatorCtxKey, impersonatorID)
+		} else {
+			app.recordActivity(ctx, user.ID)
+		}
+
 		ctx = context.WithValue(ctx, userCtxKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -135,6 +163,65 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 	})
 }
 
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := ctx.Value(userCtxKey).(store.User)
+		comment := getCommentFromCtx(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(ctx, &user, requiredRole)
+		if err != nil {
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r, ErrorInvalidCredentials)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireRole lets through users with the given role or a higher one.
+func (app *application) requireRole(requiredRole string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			user := ctx.Value(userCtxKey).(store.User)
+
+			allowed, err := app.checkRolePrecedence(ctx, &user, requiredRole)
+			if err != nil {
+				app.statusInternalServerError(w, r, err)
+				return
+			}
+
+			if !allowed {
+				app.forbiddenResponse(w, r, ErrorInvalidCredentials)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// canSeeHidden reports whether the user may view content hidden by
+// moderators: its author and moderators can.
+func (app *application) canSeeHidden(ctx context.Context, user *store.User, authorID int64) (bool, error) {
+	if user.ID == authorID {
+		return true, nil
+	}
+
+	return app.checkRolePrecedence(ctx, user, "moderator")
+}
+
 func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, requiredRole string) (bool, error) {
 	role, err := app.store.Role.GetByName(ctx, requiredRole)
 	if err != nil {
@@ -170,6 +257,103 @@ func (app *application) getUser(ctx context.Context, userID int64) (store.User,
 	return *user, nil
 }
 
+// tokenRevoked reports whether the token was issued before the password of
+// the user was last reset. Issue times are in whole seconds, so tokens issued
+// in the second of the reset are revoked too.
+func tokenRevoked(token *jwt.Token, user *store.User) bool {
+	if user.PasswordChangedAt == nil {
+		return false
+	}
+
+	changedAt, err := time.Parse(time.RFC3339, *user.PasswordChangedAt)
+	if err != nil {
+		return false
+	}
+
+	issuedAt, err := token.Claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return true
+	}
+
+	return !issuedAt.After(changedAt)
+}
+
+// impersonatorFromClaims returns the subject of the act claim that marks
+// impersonation tokens.
+func impersonatorFromClaims(claims jwt.MapClaims) (int64, bool) {
+	act, ok := claims["act"].(map[string]any)
+	if !ok {
+		return 0, false
+	}
+
+	sub, ok := act["sub"].(float64)
+	if !ok {
+		return 0, false
+	}
+
+	return int64(sub), true
+}
+
+// recordActivity counts the user as active today. Redis deduplicates the
+// writes across instances when enabled, and each instance remembers the users
+// it recorded otherwise; failures are logged and never fail the request.
+func (app *application) recordActivity(ctx context.Context, userID int64) {
+	now := time.Now()
+
+	if app.config.redisCfg.enabled {
+		first, err := app.cacheStorage.Users.MarkActive(ctx, userID, now)
+		if err != nil {
+			app.logger.Warnw("error marking user active", "user", userID, "error", err)
+		}
+		if err == nil && !first {
+			return
+		}
+	} else if !app.activeUsers.mark(userID, now) {
+		return
+	}
+
+	if err := app.store.User.RecordActivity(ctx, userID, now); err != nil {
+		app.activeUsers.unmark(userID)
+		app.logger.Warnw("error recording user activity", "user", userID, "error", err)
+	}
+}
+
+// activeUsers holds the users recorded as active on the current UTC day by
+// this instance. The zero value is ready to use.
+type activeUsers struct {
+	mu    sync.Mutex
+	day   string
+	users map[int64]struct{}
+}
+
+// mark adds the user to the day of at, reporting whether they were not in it
+// yet. A new day starts over.
+func (a *activeUsers) mark(userID int64, at time.Time) bool {
+	day := at.UTC().Format(time.DateOnly)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if day != a.day {
+		a.day, a.users = day, make(map[int64]struct{})
+	}
+
+	if _, ok := a.users[userID]; ok {
+		return false
+	}
+	a.users[userID] = struct{}{}
+
+	return true
+}
+
+// unmark removes the user, so their activity is recorded again.
+func (a *activeUsers) unmark(userID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.users, userID)
+}
+
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(app.config.rateLimiter.Enabled)
@@ -183,3 +367,43 @@ func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// pathLogFormatter logs requests by their path only. Query strings stay out
+// of the access logs since some carry secrets, like stream tickets and the
+// signatures of unsubscribe links.
+type pathLogFormatter struct {
+	*middleware.DefaultLogFormatter
+}
+
+func (f *pathLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	logged := r.WithContext(r.Context())
+	logged.RequestURI = r.URL.EscapedPath()
+
+	return f.DefaultLogFormatter.NewLogEntry(logged)
+}
+
+// requestLogger is middleware.Logger without the query strings.
+var requestLogger = middleware.RequestLogger(&pathLogFormatter{
+	&middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags)},
+})
+
+// timeoutMiddleware cancels requests after timeout, except the streams
+// under the skipped path prefixes which are meant to stay open.
+func timeoutMiddleware(timeout time.Duration, skip ...string) func(http.Handler) http.Handler {
+	withTimeout := middleware.Timeout(timeout)
+
+	return func(next http.Handler) http.Handler {
+		timed := withTimeout(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range skip {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			timed.ServeHTTP(w, r)
+		})
+	}
+}
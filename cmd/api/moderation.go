@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"social/internal/mailer"
+	"social/internal/store"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateReportPayload struct {
+	TargetType string `json:"target_type" validate:"required,oneof=post comment user"`
+	TargetID   int64  `json:"target_id" validate:"required,gte=1"`
+	Reason     string `json:"reason" validate:"required,oneof=spam harassment hate violence nudity misinformation other"`
+	Details    string `json:"details" validate:"max=500"`
+}
+
+type ResolveCasePayload struct {
+	Resolution  string `json:"resolution" validate:"required,oneof=dismiss hide delete warn suspend"`
+	Note        string `json:"note" validate:"max=500"`
+	SuspendDays int    `json:"suspend_days" validate:"gte=0,lte=3650"`
+}
+
+// CreateReport godoc
+//
+//	@Summary		Reports a post, comment or user
+//	@Description	Files a report that joins the open moderation case of its target. A user can report a target once per case
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateReportPayload	true	"Report payload"
+//	@Success		201		{object}	store.Report
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/reports [post]
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	report := &store.Report{
+		ReporterID: user.ID,
+		TargetType: payload.TargetType,
+		TargetID:   payload.TargetID,
+		Reason:     payload.Reason,
+		Details:    payload.Details,
+	}
+
+	if err := app.store.Moderation.Report(ctx, report); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		case errors.Is(err, store.ErrDuplicatedKey):
+			app.statusConflict(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusCreated, report); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// GetModerationCases godoc
+//
+//	@Summary		Fetches the moderation queue
+//	@Description	Fetches the moderation cases with a status, most reported first
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			status	query		string	false	"Case status (open, claimed, resolved)"
+//	@Param			limit	query		int		false	"Page size"
+//	@Param			offset	query		int		false	"Page offset"
+//	@Success		200		{array}		store.ModerationCase
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/cases [get]
+func (app *application) getModerationCasesHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginatedQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = store.CaseStatusOpen
+	case store.CaseStatusOpen, store.CaseStatusClaimed, store.CaseStatusResolved:
+	default:
+		app.statusBadRequest(w, r, fmt.Errorf("invalid case status %q", status))
+		return
+	}
+
+	cases, err := app.store.Moderation.GetCases(r.Context(), status, pq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, cases); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// GetModerationCase godoc
+//
+//	@Summary		Fetches a moderation case
+//	@Description	Fetches a moderation case with its reports and the moderator actions taken on it
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			caseID	path		int	true	"Case ID"
+//	@Success		200		{object}	store.ModerationCase
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/cases/{caseID} [get]
+func (app *application) getModerationCaseHandler(w http.ResponseWriter, r *http.Request) {
+	caseID, err := strconv.ParseInt(chi.URLParam(r, "caseID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	c, err := app.store.Moderation.GetCase(r.Context(), caseID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, c); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// ClaimModerationCase godoc
+//
+//	@Summary		Claims a moderation case
+//	@Description	Assigns an open case to the current moderator
+//	@Tags			moderation
+//	@Param			caseID	path	int	true	"Case ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/cases/{caseID}/claim [put]
+func (app *application) claimModerationCaseHandler(w http.ResponseWriter, r *http.Request) {
+	caseID, err := strconv.ParseInt(chi.URLParam(r, "caseID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Moderation.Claim(ctx, caseID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrCaseNotOpen):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("moderation.claim", "case", caseID, nil, nil))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResolveModerationCase godoc
+//
+//	@Summary		Resolves a moderation case
+//	@Description	Applies a resolution to the target of a case claimed by the current moderator and closes it.
+//	@Description	Suspensions last suspend_days, or until lifted when it is zero
+//	@Tags			moderation
+//	@Accept			json
+//	@Param			caseID	path	int					true	"Case ID"
+//	@Param			payload	body	ResolveCasePayload	true	"Resolution payload"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/cases/{caseID}/resolve [put]
+func (app *application) resolveModerationCaseHandler(w http.ResponseWriter, r *http.Request) {
+	caseID, err := strconv.ParseInt(chi.URLParam(r, "caseID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	var payload ResolveCasePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	c, err := app.store.Moderation.GetCase(ctx, caseID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if c.Status != store.CaseStatusClaimed || c.AssigneeID == nil || *c.AssigneeID != user.ID {
+		app.statusBadRequest(w, r, store.ErrCaseNotClaimed)
+		return
+	}
+
+	suspension, suspended, err := app.prepareResolution(ctx, &c, &user, payload)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidResolution):
+			app.statusBadRequest(w, r, err)
+		case errors.Is(err, ErrSuspendHigherRole):
+			app.forbiddenResponse(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Moderation.Resolve(ctx, c.ID, user.ID, payload.Resolution, payload.Note, suspension); err != nil {
+		switch {
+		case errors.Is(err, store.ErrCaseNotClaimed), errors.Is(err, store.ErrInvalidResolution):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if suspension != nil {
+		app.noticeSuspension(ctx, &suspended, suspension)
+	}
+
+	app.audit(r, auditEvent("moderation.resolve", "case", c.ID, map[string]string{"status": c.Status}, map[string]any{
+		"status":      store.CaseStatusResolved,
+		"resolution":  payload.Resolution,
+		"note":        payload.Note,
+		"target_type": c.TargetType,
+		"target_id":   c.TargetID,
+	}))
+
+	if payload.Resolution == store.ResolutionWarn {
+		app.sendModerationWarning(ctx, &c, payload.Note)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// prepareResolution checks a resolution applies to the target of a case
+// before Resolve carries it out. Hide and delete only apply to content;
+// suspensions are returned with the user they suspend, who must be below
+// the moderator's role.
+func (app *application) prepareResolution(ctx context.Context, c *store.ModerationCase, moderator *store.User, payload ResolveCasePayload) (*store.Suspension, store.User, error) {
+	switch payload.Resolution {
+	case store.ResolutionHide, store.ResolutionDelete:
+		if c.TargetType != store.ReportTargetPost && c.TargetType != store.ReportTargetComment {
+			return nil, store.User{}, store.ErrInvalidResolution
+		}
+
+	case store.ResolutionSuspend:
+		user, err := app.getSuspendable(ctx, moderator, c.TargetUserID)
+		if err != nil {
+			return nil, store.User{}, err
+		}
+
+		suspension := &store.Suspension{
+			UserID:      c.TargetUserID,
+			CaseID:      &c.ID,
+			ModeratorID: &moderator.ID,
+			Reason:      payload.Note,
+		}
+		if payload.SuspendDays > 0 {
+			endsAt := time.Now().AddDate(0, 0, payload.SuspendDays).Format(time.RFC3339)
+			suspension.EndsAt = &endsAt
+		}
+
+		return suspension, user, nil
+	}
+
+	return nil, store.User{}, nil
+}
+
+// sendModerationWarning e-mails the owner of the target of a case. Like
+// mention e-mails it is sent in the background and failures are only logged.
+func (app *application) sendModerationWarning(ctx context.Context, c *store.ModerationCase, note string) {
+	user, err := app.store.User.GetById(ctx, c.TargetUserID)
+	if err != nil {
+		app.logger.Errorw("error fetching warned user", "user", c.TargetUserID, "error", err)
+		return
+	}
+
+	vars := struct {
+		Username   string
+		TargetType string
+		Note       string
+	}{
+		Username:   user.Username,
+		TargetType: c.TargetType,
+		Note:       note,
+	}
+	isProdEnv := app.config.env == "production"
+
+	go func() {
+		if err := app.mailer.Send(mailer.ModerationWarningTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+			app.logger.Errorw("error sending moderation warning", "user", user.ID, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"social/internal/store"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type NotificationsPage struct {
+	Unread int64                     `json:"unread"`
+	Groups []store.NotificationGroup `json:"groups"`
+}
+
+type UnreadNotificationsResponse struct {
+	Total  int64            `json:"total"`
+	ByType map[string]int64 `json:"by_type"`
+}
+
+// notify records a notification. Failures are only logged: notifications
+// must not fail the action they are about.
+func (app *application) notify(ctx context.Context, n *store.Notification) {
+	if err := app.store.Notification.Create(ctx, n); err != nil {
+		app.logger.Errorw("error creating notification", "type", n.Type, "user", n.UserID, "error", err)
+		return
+	}
+
+	// skipped notifications are not created
+	if n.ID != 0 {
+		app.pushNotification(ctx, n)
+	}
+}
+
+// withdrawNotification removes the notification of an undone action.
+func (app *application) withdrawNotification(ctx context.Context, userID int64, notificationType string, actorID int64, groupKey string) {
+	if err := app.store.Notification.Remove(ctx, userID, notificationType, actorID, groupKey); err != nil {
+		app.logger.Errorw("error removing notification", "type", notificationType, "user", userID, "error", err)
+	}
+}
+
+// notifyComment tells the author of the post about a new comment, and the
+// author of the parent comment about a reply.
+func (app *application) notifyComment(ctx context.Context, post *store.Post, comment *store.Comment) {
+	var parentAuthorID int64
+	if comment.ParentID != nil {
+		parent, err := app.store.Comment.GetById(ctx, *comment.ParentID)
+		if err != nil {
+			app.logger.Errorw("error fetching parent comment", "comment", *comment.ParentID, "error", err)
+		} else {
+			parentAuthorID = parent.UserID
+			app.notify(ctx, &store.Notification{
+				UserID:    parent.UserID,
+				Type:      store.NotificationReply,
+				ActorID:   comment.UserID,
+				PostID:    &post.ID,
+				CommentID: &comment.ID,
+				GroupKey:  store.CommentGroupKey(parent.ID),
+			})
+		}
+	}
+
+	if post.UserID != parentAuthorID {
+		app.notify(ctx, &store.Notification{
+			UserID:    post.UserID,
+			Type:      store.NotificationComment,
+			ActorID:   comment.UserID,
+			PostID:    &post.ID,
+			CommentID: &comment.ID,
+			GroupKey:  store.PostGroupKey(post.ID),
+		})
+	}
+}
+
+// GetNotifications godoc
+//
+//	@Summary		Fetches notifications
+//	@Description	Fetches the notifications of the current user grouped by type and target, latest first, with the unread count
+//	@Tags			notifications
+//	@Produce		json
+//	@Param			unread	query		bool	false	"Unread notifications only"
+//	@Param			limit	query		int		false	"Page size"
+//	@Param			offset	query		int		false	"Page offset"
+//	@Success		200		{object}	NotificationsPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications [get]
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginatedQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	unreadOnly := false
+	if v := r.URL.Query().Get("unread"); v != "" {
+		unreadOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			app.statusBadRequest(w, r, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	groups, err := app.store.Notification.GetGroups(ctx, user.ID, unreadOnly, pq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	counts, err := app.store.Notification.GetUnreadCounts(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	page := NotificationsPage{Groups: groups}
+	for _, c := range counts {
+		page.Unread += c
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, page); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// GetUnreadNotifications godoc
+//
+//	@Summary		Counts unread notifications
+//	@Description	Counts the unread notifications of the current user, in total and by type
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	UnreadNotificationsResponse
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/unread [get]
+func (app *application) getUnreadNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	counts, err := app.store.Notification.GetUnreadCounts(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	res := UnreadNotificationsResponse{ByType: counts}
+	for _, c := range counts {
+		res.Total += c
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, res); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// MarkNotificationRead godoc
+//
+//	@Summary		Marks a notification as read
+//	@Description	Marks a notification and the rest of its group as read
+//	@Tags			notifications
+//	@Param			notificationID	path	int	true	"Notification ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/{notificationID}/read [put]
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Notification.MarkRead(ctx, user.ID, notificationID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkAllNotificationsRead godoc
+//
+//	@Summary		Marks every notification as read
+//	@Description	Marks every notification of the current user as read
+//	@Tags			notifications
+//	@Success		204
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/read [put]
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if _, err := app.store.Notification.MarkAllRead(ctx, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNotificationPreferences godoc
+//
+//	@Summary		Fetches notification preferences
+//	@Description	Tells for every notification type whether the current user gets it
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	map[string]bool
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [get]
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	prefs, err := app.store.Notification.GetPreferences(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, prefs); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// UpdateNotificationPreferences godoc
+//
+//	@Summary		Updates notification preferences
+//	@Description	Turns notification types on or off, leaving the types missing from the payload as they are
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		map[string]bool	true	"Enabled state by type"
+//	@Success		200		{object}	map[string]bool
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [put]
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]bool
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	for notificationType := range payload {
+		if !slices.Contains(store.NotificationTypes, notificationType) {
+			app.statusBadRequest(w, r, fmt.Errorf("%w: %s", store.ErrInvalidNotificationType, notificationType))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Notification.SetPreferences(ctx, user.ID, payload); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	prefs, err := app.store.Notification.GetPreferences(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, prefs); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"social/internal/mailer"
+	"social/internal/store"
+	"social/internal/webhooks"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// outboxLease is how long a claimed batch belongs to this instance.
+	// Another instance claims its events again once it runs out, so the
+	// relay stops starting events outboxLeaseMargin before that, leaving
+	// the last one time to finish; the events it did not get to are relayed
+	// after the lease.
+	outboxLease       = time.Minute * 2
+	outboxLeaseMargin = time.Second * 30
+	// outboxMaxAttempts is how many times an event is relayed before it is
+	// given up on.
+	outboxMaxAttempts = 10
+	outboxMaxBackoff  = time.Hour
+	outboxPurgeBatch  = 1000
+)
+
+type outboxConfig struct {
+	interval  time.Duration
+	batchSize int
+	// retention is how long handled and dead events are kept before being
+	// purged.
+	retention time.Duration
+}
+
+// UserRegisteredMessage is the outbox payload of a registration. UserID
+// points at the ID of the user being created and is marshaled once it is
+// set. The activation token is not part of it: outbox rows outlive the
+// registration, and tokens are only stored hashed.
+type UserRegisteredMessage struct {
+	UserID *int64 `json:"user_id"`
+}
+
+type FollowMessage struct {
+	UserID     int64 `json:"user_id"`
+	FollowerID int64 `json:"follower_id"`
+}
+
+// outboxConsumer handles the outbox events of some types. Handlers are
+// called at least once per event and get its idempotency key; an event is
+// retried until every consumer handled it, skipping the ones that did.
+type outboxConsumer struct {
+	name   string
+	types  []string
+	handle func(ctx context.Context, key string, e store.OutboxEvent) error
+}
+
+func (app *application) outboxConsumers() []outboxConsumer {
+	return []outboxConsumer{
+		{
+			name:   "mailer",
+			types:  []string{store.OutboxUserRegistered},
+			handle: app.mailOutboxEvent,
+		},
+		{
+			name:   "notifications",
+			types:  []string{store.OutboxUserFollowed, store.OutboxUserUnfollowed},
+			handle: app.notifyOutboxEvent,
+		},
+		{
+			name:   "timelines",
+			types:  []string{store.OutboxPostPublished, store.OutboxPostRemoved},
+			handle: app.timelineOutboxEvent,
+		},
+		{
+			name:   "webhooks",
+			types:  []string{store.OutboxUserRegistered, store.OutboxUserFollowed, store.OutboxUserUnfollowed},
+			handle: app.webhookOutboxEvent,
+		},
+	}
+}
+
+// relayOutbox hands the due outbox events to their consumers, batch by
+// batch, for as long as each batch's lease allows.
+func (app *application) relayOutbox(ctx context.Context) {
+	for {
+		claimedAt := time.Now()
+		events, err := app.store.Outbox.ClaimDue(ctx, claimedAt, app.config.outbox.batchSize, outboxLease)
+		if err != nil {
+			app.logger.Errorw("error claiming outbox events", "error", err)
+			return
+		}
+
+		deadline := claimedAt.Add(outboxLease - outboxLeaseMargin)
+		for i, e := range events {
+			if time.Now().After(deadline) {
+				app.logger.Warnw("outbox lease running out, leaving events for later", "events", len(events)-i)
+				return
+			}
+
+			app.relayOutboxEvent(ctx, e)
+		}
+
+		if len(events) == 0 || len(events) < app.config.outbox.batchSize {
+			return
+		}
+	}
+}
+
+func (app *application) relayOutboxEvent(ctx context.Context, e store.OutboxEvent) {
+	consumed, err := app.store.Outbox.GetConsumers(ctx, e.Key)
+	if err != nil {
+		app.logger.Errorw("error fetching outbox consumers", "event", e.ID, "error", err)
+		return
+	}
+
+	var errs []error
+	for _, c := range app.outboxConsumers() {
+		if consumed[c.name] || !slices.Contains(c.types, e.Type) {
+			continue
+		}
+
+		if err := c.handle(ctx, e.Key, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+
+		if err := app.store.Outbox.MarkConsumed(ctx, e.Key, c.name); err != nil {
+			// the consumer runs again on retry, which it tolerates
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		if err := app.store.Outbox.Complete(ctx, e.ID); err != nil {
+			app.logger.Errorw("error completing outbox event", "event", e.ID, "error", err)
+		}
+		return
+	}
+
+	err = errors.Join(errs...)
+
+	var retryAt *time.Time
+	if attempts := e.Attempts + 1; attempts < outboxMaxAttempts {
+		at := time.Now().Add(outboxBackoff(attempts))
+		retryAt = &at
+		app.logger.Warnw("outbox event failed, retrying", "event", e.ID, "type", e.Type, "attempts", attempts, "error", err)
+	} else {
+		app.logger.Errorw("outbox event failed, giving up", "event", e.ID, "type", e.Type, "attempts", attempts, "error", err)
+	}
+
+	if err := app.store.Outbox.Fail(ctx, e.ID, err.Error(), retryAt); err != nil {
+		app.logger.Errorw("error failing outbox event", "event", e.ID, "error", err)
+	}
+}
+
+// outboxBackoff doubles the wait after each failed attempt, from a second.
+func outboxBackoff(attempts int) time.Duration {
+	wait := time.Second << min(attempts-1, 30)
+	return min(wait, outboxMaxBackoff)
+}
+
+// purgeOutbox deletes the events handled longer than the retention period
+// ago.
+func (app *application) purgeOutbox(ctx context.Context) {
+	before := time.Now().Add(-app.config.outbox.retention)
+
+	for {
+		purged, err := app.store.Outbox.Purge(ctx, before, outboxPurgeBatch)
+		if err != nil {
+			app.logger.Errorw("error purging outbox events", "error", err)
+			return
+		}
+
+		if purged < outboxPurgeBatch {
+			return
+		}
+	}
+}
+
+// mailOutboxEvent sends the welcome email of a user who did not activate
+// their account yet, with an invitation of its own.
+func (app *application) mailOutboxEvent(ctx context.Context, key string, e store.OutboxEvent) error {
+	var msg UserRegisteredMessage
+	if err := json.Unmarshal(e.Payload, &msg); err != nil {
+		return err
+	}
+
+	user, err := app.store.User.GetAny(ctx, *msg.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if user.IsActive {
+		return nil
+	}
+
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := app.store.User.Invite(ctx, user.ID, hashToken, app.config.mail.exp); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken),
+	}
+	isProdEnv := app.config.env == "production"
+
+	return app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
+}
+
+// notifyOutboxEvent creates or withdraws the follow notification. The
+// notification is dated by the event, so a retry neither marks it unread
+// again nor pushes it twice.
+func (app *application) notifyOutboxEvent(ctx context.Context, key string, e store.OutboxEvent) error {
+	var msg FollowMessage
+	if err := json.Unmarshal(e.Payload, &msg); err != nil {
+		return err
+	}
+
+	if e.Type == store.OutboxUserUnfollowed {
+		return app.store.Notification.Remove(ctx, msg.UserID, store.NotificationFollow, msg.FollowerID, store.NotificationFollow)
+	}
+
+	n := &store.Notification{
+		UserID:    msg.UserID,
+		Type:      store.NotificationFollow,
+		ActorID:   msg.FollowerID,
+		GroupKey:  store.NotificationFollow,
+		CreatedAt: e.CreatedAt,
+	}
+	if err := app.store.Notification.Create(ctx, n); err != nil {
+		return err
+	}
+
+	if n.ID != 0 {
+		app.pushNotification(ctx, n)
+	}
+
+	return nil
+}
+
+// timelineOutboxEvent fans a published post out, or takes a removed one off
+// the timelines. A post hidden or deleted before its event is relayed is not
+// fanned out.
+func (app *application) timelineOutboxEvent(ctx context.Context, key string, e store.OutboxEvent) error {
+	var msg store.PostMessage
+	if err := json.Unmarshal(e.Payload, &msg); err != nil {
+		return err
+	}
+
+	if e.Type == store.OutboxPostRemoved {
+		return app.removeFromTimelines(ctx, &msg)
+	}
+
+	post, err := app.store.Post.GetById(ctx, msg.PostID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if post.Status != store.PostStatusPublished || post.HiddenAt != nil || post.DeletedAt != nil {
+		return nil
+	}
+
+	return app.fanOutPost(ctx, &post)
+}
+
+// webhookOutboxEvent enqueues the webhook event under the idempotency key,
+// so retries create no duplicate deliveries.
+func (app *application) webhookOutboxEvent(ctx context.Context, key string, e store.OutboxEvent) error {
+	var (
+		eventType string
+		userIDs   []int64
+		data      any
+	)
+
+	switch e.Type {
+	case store.OutboxUserRegistered:
+		var msg UserRegisteredMessage
+		if err := json.Unmarshal(e.Payload, &msg); err != nil {
+			return err
+		}
+
+		user, err := app.store.User.GetAny(ctx, *msg.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				return nil
+			default:
+				return err
+			}
+		}
+
+		eventType, userIDs = webhooks.EventUserRegistered, []int64{user.ID}
+		data = UserRegisteredEvent{UserID: user.ID, Username: user.Username}
+	case store.OutboxUserFollowed, store.OutboxUserUnfollowed:
+		var msg FollowMessage
+		if err := json.Unmarshal(e.Payload, &msg); err != nil {
+			return err
+		}
+
+		eventType, userIDs = webhooks.EventUserFollowed, []int64{msg.UserID, msg.FollowerID}
+		if e.Type == store.OutboxUserUnfollowed {
+			eventType = webhooks.EventUserUnfollowed
+		}
+		data = FollowEvent{UserID: msg.UserID, FollowerID: msg.FollowerID}
+	default:
+		return nil
+	}
+
+	event, err := webhooks.NewEvent(eventType, userIDs, data)
+	if err != nil {
+		return err
+	}
+	event.ID = key
+
+	_, err = app.webhookDispatcher.Publish(ctx, event)
+
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"social/internal/mailer"
+	"social/internal/store"
+	"testing"
+	"time"
+)
+
+// memoryOutbox records what the relay did with its events.
+type memoryOutbox struct {
+	consumed  map[string]bool
+	completed bool
+	retryAt   *time.Time
+	failed    bool
+}
+
+func (o *memoryOutbox) ClaimDue(context.Context, time.Time, int, time.Duration) ([]store.OutboxEvent, error) {
+	return nil, nil
+}
+
+func (o *memoryOutbox) GetConsumers(context.Context, string) (map[string]bool, error) {
+	consumed := make(map[string]bool)
+	for c := range o.consumed {
+		consumed[c] = true
+	}
+
+	return consumed, nil
+}
+
+func (o *memoryOutbox) MarkConsumed(_ context.Context, _, consumer string) error {
+	o.consumed[consumer] = true
+	return nil
+}
+
+func (o *memoryOutbox) Complete(context.Context, int64) error {
+	o.completed = true
+	return nil
+}
+
+func (o *memoryOutbox) Fail(_ context.Context, _ int64, _ string, retryAt *time.Time) error {
+	o.failed, o.retryAt = true, retryAt
+	return nil
+}
+
+func (o *memoryOutbox) Purge(context.Context, time.Time, int) (int64, error) {
+	return 0, nil
+}
+
+type failingMailer struct {
+	err  error
+	sent int
+}
+
+func (m *failingMailer) Send(string, string, string, any, bool, ...mailer.Header) error {
+	m.sent++
+	return m.err
+}
+
+func TestRelayOutboxEvent(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	outbox := &memoryOutbox{consumed: make(map[string]bool)}
+	app.store.Outbox = outbox
+
+	mail := &failingMailer{err: errors.New("smtp unavailable")}
+	app.mailer = mail
+
+	userID := int64(1)
+	payload, err := json.Marshal(UserRegisteredMessage{UserID: &userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := store.OutboxEvent{ID: 1, Key: "key", Type: store.OutboxUserRegistered, Payload: payload}
+
+	t.Run("should retry the consumers that failed", func(t *testing.T) {
+		app.relayOutboxEvent(context.Background(), e)
+
+		if !outbox.failed || outbox.retryAt == nil || outbox.completed {
+			t.Fatalf("event failed = %v, retryAt = %v, completed = %v, want a retry", outbox.failed, outbox.retryAt, outbox.completed)
+		}
+		if outbox.consumed["mailer"] || !outbox.consumed["webhooks"] {
+			t.Errorf("consumed = %v, want only webhooks", outbox.consumed)
+		}
+	})
+
+	t.Run("should complete without running the consumers again", func(t *testing.T) {
+		mail.err = nil
+		outbox.failed = false
+		e.Attempts++
+
+		app.relayOutboxEvent(context.Background(), e)
+
+		if !outbox.completed || outbox.failed {
+			t.Fatalf("event completed = %v, failed = %v, want completed", outbox.completed, outbox.failed)
+		}
+		if mail.sent != 2 || !outbox.consumed["mailer"] {
+			t.Errorf("mails sent = %d, consumed = %v, want the mailer to run once more", mail.sent, outbox.consumed)
+		}
+	})
+
+	t.Run("should give up after the last attempt", func(t *testing.T) {
+		outbox.consumed = make(map[string]bool)
+		mail.err = errors.New("smtp unavailable")
+		e.Attempts = outboxMaxAttempts - 1
+
+		app.relayOutboxEvent(context.Background(), e)
+
+		if !outbox.failed || outbox.retryAt != nil {
+			t.Errorf("event failed = %v, retryAt = %v, want dead", outbox.failed, outbox.retryAt)
+		}
+	})
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{10, 512 * time.Second},
+		{13, outboxMaxBackoff},
+		{40, outboxMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
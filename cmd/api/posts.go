@@ -5,8 +5,11 @@ import (
 	"errors"
 	"net/http"
 	"slices"
+	"social/internal/contentfilter"
 	"social/internal/store"
+	"social/internal/webhooks"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -15,10 +18,21 @@ type postKey string
 
 const postCtx postKey = "post"
 
+var (
+	ErrPublishAtRequired       = errors.New("publish_at is required for scheduled posts")
+	ErrPublishAtInPast         = errors.New("publish_at must be in the future")
+	ErrInvalidStatusTransition = errors.New("invalid post status transition")
+	ErrNotPostOwner            = errors.New("only the author can do this")
+	ErrCannotPinUnpublished    = errors.New("only published posts can be pinned")
+)
+
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title     string     `json:"title" validate:"required,max=100"`
+	Content   string     `json:"content" validate:"required,max=1000"`
+	Tags      []string   `json:"tags"`
+	Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
+	Language  string     `json:"language" validate:"omitempty,oneof=simple english portuguese spanish french german italian"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,14 +47,42 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	status := payload.Status
+	if status == "" {
+		status = store.PostStatusPublished
+		if payload.PublishAt != nil {
+			status = store.PostStatusScheduled
+		}
+	}
+
+	publishAt, err := resolvePublishAt(status, payload.PublishAt)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
 	ctx := r.Context()
 	user := ctx.Value(userCtxKey).(store.User)
 
+	filtered, err := app.filterContent(ctx, &user, payload.Title, payload.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrContentRejected):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  user.ID,
+		Title:     payload.Title,
+		Content:   payload.Content,
+		Tags:      mergeHashtags(payload.Tags, payload.Content),
+		UserID:    user.ID,
+		Status:    status,
+		PublishAt: publishAt,
+		Language:  payload.Language,
 	}
 
 	if err := app.store.Post.Create(ctx, post); err != nil {
@@ -48,6 +90,19 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if filtered.Verdict == contentfilter.Hold {
+		post.HiddenAt, err = app.holdContent(ctx, store.ReportTargetPost, post.ID, user.ID, filtered)
+		if err != nil {
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+	}
+
+	if post.Status == store.PostStatusPublished && post.HiddenAt == nil {
+		app.processMentions(ctx, user.ID, post.ID, nil, post.Content)
+		app.emitWebhook(ctx, webhooks.EventPostCreated, []int64{post.UserID}, newPostCreatedEvent(post))
+	}
+
 	if err := app.JSONResponse(w, http.StatusOK, post); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
@@ -58,43 +113,101 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 	ctx := r.Context()
 
-	comments, err := app.store.Comment.GetByPostId(ctx, post.ID)
+	depth, err := parseReplyDepth(r, defaultReplyDepth)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	user := ctx.Value(userCtxKey).(store.User)
+	firstPage := store.CursorQuery{Limit: 10, Sort: "new"}
+
+	comments, next, err := app.store.Comment.ListByPost(ctx, post.ID, user.ID, depth, firstPage)
 	if err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
 
 	post.Comments = comments
+	post.CommentsNextCursor = next
 
-	if err := app.JSONResponse(w, http.StatusOK, post); err != nil {
+	post.Reactions, err = app.store.Reaction.GetCounts(ctx, post.ID)
+	if err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
-}
 
-func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "postID")
-	postID, err := strconv.ParseInt(idParam, 10, 64)
+	post.ViewerReaction, err = app.store.Reaction.GetUserReaction(ctx, post.ID, user.ID)
 	if err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
-	ctx := r.Context()
-	_, err = app.store.Comment.DeleteByPostId(ctx, postID)
+
+	post.Bookmarked, err = app.store.Bookmark.IsBookmarked(ctx, user.ID, post.ID)
 	if err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
 
-	rowsAffected, err := app.store.Post.Delete(ctx, postID)
-	if err != nil {
+	originalID := post.RepostOfID
+	if originalID == nil {
+		originalID = post.QuoteOfID
+	}
+
+	if originalID != nil {
+		original, err := app.store.Post.GetById(ctx, *originalID)
+		switch {
+		case err == nil:
+			if original.Status == store.PostStatusPublished && original.HiddenAt == nil {
+				post.Original = &original
+			}
+		case !errors.Is(err, store.ErrNotFound):
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, post); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
-	if rowsAffected == 0 {
-		app.statusNotFound(w, r, errors.New("no id found to delete"))
+}
+
+// DeletePost godoc
+//
+//	@Summary		Deletes a post
+//	@Description	Soft-deletes a post with its comments; allowed for its author and admins. Deleted posts can be restored until they are purged
+//	@Tags			posts
+//	@Param			postID	path		int	true	"Post ID"
+//	@Success		200		{object}	map[string]string
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID} [delete]
+func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Post.Delete(ctx, post.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
 		return
 	}
+
+	app.audit(r, auditEvent("post.delete", "post", post.ID, map[string]any{
+		"user_id": post.UserID,
+		"title":   post.Title,
+		"content": post.Content,
+	}, nil))
+
+	app.emitWebhook(ctx, webhooks.EventPostDeleted, []int64{post.UserID}, PostDeletedEvent{PostID: post.ID, UserID: post.UserID})
+
 	response := map[string]string{
 		"success": "successfully deleted",
 	}
@@ -103,10 +216,57 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 }
 
 type PatchPostPayload struct {
-	ID      int64    `json:"id"`
-	Title   string   `json:"title" validate:"max=100"`
-	Content string   `json:"content" validate:"max=1000"`
-	Tags    []string `json:"tags"`
+	ID        int64      `json:"id"`
+	Title     string     `json:"title" validate:"max=100"`
+	Content   string     `json:"content" validate:"max=1000"`
+	Tags      []string   `json:"tags"`
+	Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published archived"`
+	PublishAt *time.Time `json:"publish_at"`
+	Language  string     `json:"language" validate:"omitempty,oneof=simple english portuguese spanish french german italian"`
+}
+
+// mapUpdatedStatus applies a status change, refusing to move a post that has
+// already gone live back to draft or scheduled.
+func (p *PatchPostPayload) mapUpdatedStatus(post *store.Post) error {
+	if p.Status == "" && p.PublishAt == nil {
+		return nil
+	}
+
+	status := p.Status
+	if status == "" {
+		status = post.Status
+	}
+
+	wasLive := post.Status == store.PostStatusPublished || post.Status == store.PostStatusArchived
+	if wasLive && (status == store.PostStatusDraft || status == store.PostStatusScheduled) {
+		return ErrInvalidStatusTransition
+	}
+
+	publishAt := p.PublishAt
+	if publishAt == nil && post.PublishAt != nil && status == store.PostStatusScheduled {
+		t, err := time.Parse(time.RFC3339, *post.PublishAt)
+		if err != nil {
+			return err
+		}
+		publishAt = &t
+	}
+
+	resolved, err := resolvePublishAt(status, publishAt)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case wasLive:
+		// keep the time the post originally went live
+	case status == store.PostStatusPublished:
+		post.PublishAt = nil
+	default:
+		post.PublishAt = resolved
+	}
+	post.Status = status
+
+	return nil
 }
 
 func (p *PatchPostPayload) mapUpdatedFields(post *store.Post) {
@@ -116,6 +276,9 @@ func (p *PatchPostPayload) mapUpdatedFields(post *store.Post) {
 	if p.Content != post.Content {
 		post.Content = p.Content
 	}
+	if p.Language != "" {
+		post.Language = p.Language
+	}
 	for _, newTag := range p.Tags {
 		if !slices.Contains(post.Tags, newTag) {
 			post.Tags = append(post.Tags, newTag)
@@ -130,12 +293,40 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		app.statusInternalServerError(w, r, err)
 		return
 	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
 	persistedPost := getPostFromCtx(r)
 	ctx := r.Context()
 
+	if persistedPost.RepostOfID != nil {
+		app.statusBadRequest(w, r, ErrCannotEditRepost)
+		return
+	}
+
+	wasPublished := persistedPost.Status == store.PostStatusPublished
+	if err := payload.mapUpdatedStatus(persistedPost); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
 	payload.mapUpdatedFields(persistedPost)
+	persistedPost.Tags = mergeHashtags(persistedPost.Tags, persistedPost.Content)
+
+	filtered, err := app.filterEdit(ctx, persistedPost.UserID, store.ReportTargetPost, persistedPost.ID, persistedPost.Title, persistedPost.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrContentRejected):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
 
-	if err := app.store.Post.Update(ctx, persistedPost); err != nil {
+	if err := app.store.Post.Update(ctx, persistedPost, contentHold(filtered)); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.statusNotFound(w, r, err)
@@ -145,9 +336,103 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if filtered.Verdict == contentfilter.Hold {
+		app.logContentHold(ctx, store.ReportTargetPost, persistedPost.ID, persistedPost.UserID, filtered)
+	}
+
+	if persistedPost.Status == store.PostStatusPublished && persistedPost.HiddenAt == nil {
+		app.processMentions(ctx, persistedPost.UserID, persistedPost.ID, nil, persistedPost.Content)
+		if !wasPublished {
+			app.emitWebhook(ctx, webhooks.EventPostCreated, []int64{persistedPost.UserID}, newPostCreatedEvent(persistedPost))
+		}
+	}
+
 	app.JSONResponse(w, http.StatusOK, persistedPost)
 }
 
+// PinPost godoc
+//
+//	@Summary		Pins a post
+//	@Description	Pins one of the authenticated user's published posts to the top of their timeline
+//	@Tags			posts
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/pin [put]
+func (app *application) pinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if post.UserID != user.ID {
+		app.forbiddenResponse(w, r, ErrNotPostOwner)
+		return
+	}
+
+	if post.Status != store.PostStatusPublished {
+		app.statusBadRequest(w, r, ErrCannotPinUnpublished)
+		return
+	}
+
+	if post.RepostOfID != nil {
+		app.statusBadRequest(w, r, ErrRepostTarget)
+		return
+	}
+
+	if err := app.store.Post.Pin(ctx, post.ID, user.ID, app.config.posts.maxPinned); err != nil {
+		switch {
+		case errors.Is(err, store.ErrPinLimitReached):
+			app.statusBadRequest(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnpinPost godoc
+//
+//	@Summary		Unpins a post
+//	@Description	Removes a post from the top of the authenticated user's timeline
+//	@Tags			posts
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/pin [delete]
+func (app *application) unpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if post.UserID != user.ID {
+		app.forbiddenResponse(w, r, ErrNotPostOwner)
+		return
+	}
+
+	if err := app.store.Post.Unpin(ctx, post.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		paramId := chi.URLParam(r, "postID")
@@ -169,6 +454,32 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			}
 			return
 		}
+
+		if post.DeletedAt != nil {
+			app.statusNotFound(w, r, store.ErrNotFound)
+			return
+		}
+
+		// Drafts and scheduled or archived posts are only visible to their author.
+		user := ctx.Value(userCtxKey).(store.User)
+		if post.Status != store.PostStatusPublished && post.UserID != user.ID {
+			app.statusNotFound(w, r, store.ErrNotFound)
+			return
+		}
+
+		if post.HiddenAt != nil {
+			visible, err := app.canSeeHidden(ctx, &user, post.UserID)
+			if err != nil {
+				app.statusInternalServerError(w, r, err)
+				return
+			}
+
+			if !visible {
+				app.statusNotFound(w, r, store.ErrNotFound)
+				return
+			}
+		}
+
 		ctx = context.WithValue(ctx, postCtx, &post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -178,3 +489,24 @@ func getPostFromCtx(r *http.Request) *store.Post {
 	post := r.Context().Value(postCtx).(*store.Post)
 	return post
 }
+
+// resolvePublishAt validates the publish time for the given status and
+// returns it in the format stored on store.Post. Only scheduled posts keep
+// theirs; published posts go live now, whatever time the client sent.
+func resolvePublishAt(status string, publishAt *time.Time) (*string, error) {
+	if status != store.PostStatusScheduled {
+		return nil, nil
+	}
+
+	if publishAt == nil {
+		return nil, ErrPublishAtRequired
+	}
+
+	if !publishAt.After(time.Now()) {
+		return nil, ErrPublishAtInPast
+	}
+
+	formatted := publishAt.UTC().Format(time.RFC3339)
+
+	return &formatted, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"social/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var ErrInvalidReactionKind = fmt.Errorf("invalid reaction kind, must be one of %v", store.ReactionKinds)
+
+type PostReactionsResponse struct {
+	Reactions      store.ReactionCounts `json:"reactions"`
+	ViewerReaction string               `json:"viewer_reaction,omitempty"`
+}
+
+// ReactToPost godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Sets the authenticated user's reaction on a post, replacing any previous one
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			kind	path		string	true	"Reaction kind"
+//	@Success		200		{object}	PostReactionsResponse
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions/{kind} [put]
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	if !slices.Contains(store.ReactionKinds, kind) {
+		app.statusBadRequest(w, r, ErrInvalidReactionKind)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if post.RepostOfID != nil {
+		app.statusBadRequest(w, r, ErrRepostTarget)
+		return
+	}
+
+	if err := app.store.Reaction.React(ctx, post.ID, user.ID, kind); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if post.Status == store.PostStatusPublished {
+		app.notify(ctx, &store.Notification{
+			UserID:   post.UserID,
+			Type:     store.NotificationReaction,
+			ActorID:  user.ID,
+			PostID:   &post.ID,
+			GroupKey: store.PostGroupKey(post.ID),
+		})
+	}
+
+	app.writePostReactions(w, r, post.ID, kind)
+}
+
+// DeletePostReaction godoc
+//
+//	@Summary		Removes a reaction from a post
+//	@Description	Removes the authenticated user's reaction of the given kind
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			kind	path		string	true	"Reaction kind"
+//	@Success		200		{object}	PostReactionsResponse
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions/{kind} [delete]
+func (app *application) deletePostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	if !slices.Contains(store.ReactionKinds, kind) {
+		app.statusBadRequest(w, r, ErrInvalidReactionKind)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Reaction.Unreact(ctx, post.ID, user.ID, kind); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.withdrawNotification(ctx, post.UserID, store.NotificationReaction, user.ID, store.PostGroupKey(post.ID))
+
+	app.writePostReactions(w, r, post.ID, "")
+}
+
+// GetPostReactions godoc
+//
+//	@Summary		Lists who reacted to a post
+//	@Description	Lists the users that reacted to a post, optionally filtered by kind
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			kind	query		string	false	"Reaction kind"
+//	@Param			limit	query		int		false	"Page size"
+//	@Param			offset	query		int		false	"Page offset"
+//	@Success		200		{array}		store.Reaction
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions [get]
+func (app *application) getPostReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && !slices.Contains(store.ReactionKinds, kind) {
+		app.statusBadRequest(w, r, ErrInvalidReactionKind)
+		return
+	}
+
+	pq, err := store.PaginatedQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+
+	reactions, err := app.store.Reaction.GetByPostId(r.Context(), post.ID, kind, pq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, reactions); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) writePostReactions(w http.ResponseWriter, r *http.Request, postID int64, viewerReaction string) {
+	counts, err := app.store.Reaction.GetCounts(r.Context(), postID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	response := PostReactionsResponse{
+		Reactions:      counts,
+		ViewerReaction: viewerReaction,
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, response); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"social/internal/contentfilter"
+	"social/internal/store"
+)
+
+var (
+	ErrCannotShareUnpublished = errors.New("only published posts can be shared")
+	ErrCannotEditRepost       = errors.New("reposts cannot be edited")
+	ErrRepostTarget           = errors.New("reposts cannot be reacted to, commented on, bookmarked or pinned, use the shared post")
+)
+
+type CreateQuotePayload struct {
+	Content  string   `json:"content" validate:"required,max=1000"`
+	Tags     []string `json:"tags"`
+	Language string   `json:"language" validate:"omitempty,oneof=simple english portuguese spanish french german italian"`
+}
+
+// RepostPost godoc
+//
+//	@Summary		Reposts a post
+//	@Description	Shares a post with the authenticated user's followers
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int	true	"Post ID"
+//	@Success		201		{object}	store.Post
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"Post already reposted"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reposts [post]
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	if post.Status != store.PostStatusPublished {
+		app.statusBadRequest(w, r, ErrCannotShareUnpublished)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	repost, err := app.store.Post.Repost(ctx, post.SharedPostID(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicatedKey):
+			app.statusConflict(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusCreated, repost); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// UndoRepost godoc
+//
+//	@Summary		Removes a repost
+//	@Description	Removes the authenticated user's repost of a post
+//	@Tags			posts
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reposts [delete]
+func (app *application) undoRepostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Post.Unrepost(ctx, post.SharedPostID(), user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// QuotePost godoc
+//
+//	@Summary		Quotes a post
+//	@Description	Shares a post with commentary from the authenticated user
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int					true	"Post ID"
+//	@Param			payload	body		CreateQuotePayload	true	"Quote"
+//	@Success		201		{object}	store.Post
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/quotes [post]
+func (app *application) quotePostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateQuotePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	original := getPostFromCtx(r)
+	if original.Status != store.PostStatusPublished {
+		app.statusBadRequest(w, r, ErrCannotShareUnpublished)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+	quoteOf := original.SharedPostID()
+
+	filtered, err := app.filterContent(ctx, &user, "", payload.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrContentRejected):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	post := &store.Post{
+		Content:   payload.Content,
+		Tags:      mergeHashtags(payload.Tags, payload.Content),
+		UserID:    user.ID,
+		Status:    store.PostStatusPublished,
+		QuoteOfID: &quoteOf,
+		Language:  payload.Language,
+	}
+
+	if err := app.store.Post.Create(ctx, post); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if filtered.Verdict == contentfilter.Hold {
+		post.HiddenAt, err = app.holdContent(ctx, store.ReportTargetPost, post.ID, user.ID, filtered)
+		if err != nil {
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+	} else {
+		app.processMentions(ctx, user.ID, post.ID, nil, post.Content)
+	}
+
+	if err := app.JSONResponse(w, http.StatusCreated, post); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"social/internal/webhooks"
+	"time"
+)
+
+type schedulerConfig struct {
+	enabled   bool
+	interval  time.Duration
+	batchSize int
+}
+
+// runJob calls fn every interval until ctx is cancelled.
+func (app *application) runJob(ctx context.Context, name string, interval time.Duration, fn func(context.Context)) {
+	app.logger.Infow("background job started", "job", name, "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			app.logger.Infow("background job stopped", "job", name)
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}
+
+// startBackgroundJobs launches the periodic jobs of this instance. Every job
+// must be safe to run concurrently from several API instances.
+func (app *application) startBackgroundJobs(ctx context.Context) {
+	if app.config.scheduler.enabled {
+		go app.runJob(ctx, "post-scheduler", app.config.scheduler.interval, app.publishScheduledPosts)
+	}
+
+	if app.config.redisCfg.enabled {
+		go app.runJob(ctx, "trending-tags", app.config.tags.refreshInterval, app.refreshTrendingTags)
+	}
+
+	go app.runJob(ctx, "purge-deleted", app.config.retention.purgeInterval, app.purgeDeleted)
+
+	go app.runJob(ctx, "outbox-relay", app.config.outbox.interval, app.relayOutbox)
+	go app.runJob(ctx, "purge-outbox", app.config.retention.purgeInterval, app.purgeOutbox)
+
+	if app.config.webhooks.enabled {
+		go app.runJob(ctx, "webhooks", app.config.webhooks.interval, app.deliverWebhooks)
+	}
+
+	if app.config.digest.enabled {
+		go app.runJob(ctx, "digests", app.config.digest.interval, app.sendDigests)
+	}
+
+	go app.runStreams(ctx)
+	go app.runAuditQueue(ctx)
+}
+
+func (app *application) publishScheduledPosts(ctx context.Context) {
+	for {
+		posts, err := app.store.Post.PublishScheduled(ctx, app.config.scheduler.batchSize)
+		if err != nil {
+			app.logger.Errorw("error publishing scheduled posts", "error", err)
+			return
+		}
+
+		for _, post := range posts {
+			app.logger.Infow("scheduled post published", "post", post.ID, "user", post.UserID)
+			if post.HiddenAt != nil {
+				continue
+			}
+
+			app.processMentions(ctx, post.UserID, post.ID, nil, post.Content)
+			app.emitWebhook(ctx, webhooks.EventPostCreated, []int64{post.UserID}, newPostCreatedEvent(&post))
+		}
+
+		if len(posts) == 0 || len(posts) < app.config.scheduler.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"social/internal/store"
+)
+
+// SearchPosts godoc
+//
+//	@Summary		Searches posts
+//	@Description	Full-text search over published posts, most relevant first. Supports "phrases", prefix*, -exclusions and OR.
+//	@Tags			search
+//	@Produce		json
+//	@Param			q		query		string	true	"Search query"
+//	@Param			lang	query		string	false	"Language ranked first, english by default"
+//	@Param			limit	query		int		false	"Page size"
+//	@Param			offset	query		int		false	"Page offset"
+//	@Success		200		{array}		store.PostSearchResult
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search/posts [get]
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := store.PostSearchQuery{Language: store.DefaultSearchLanguage, Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	results, err := app.store.Post.Search(r.Context(), q)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidSearchQuery):
+			app.statusBadRequest(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, results); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
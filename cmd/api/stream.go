@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"social/internal/store"
+	"social/internal/stream"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// streamHistory is how many events of each user are kept for clients
+	// resuming with Last-Event-ID.
+	streamHistory = 100
+	// streamHeartbeat keeps idle connections from being closed by proxies.
+	streamHeartbeat = time.Second * 25
+	// streamTimeout bounds the calls made to the backend while streaming.
+	streamTimeout = time.Second * 5
+	// streamTicketExp is how long a client has to open its stream with a
+	// ticket.
+	streamTicketExp = time.Second * 30
+)
+
+var (
+	ErrInvalidStreamTicket = errors.New("stream ticket is invalid or expired")
+	ErrForbiddenOrigin     = errors.New("origin is not allowed to open streams")
+)
+
+type StreamTicket struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type NewPostsSignal struct {
+	PostID   int64 `json:"post_id"`
+	AuthorID int64 `json:"author_id"`
+}
+
+// runStreams delivers the events published by every instance to the streams
+// of this one, restarting when the backend connection drops.
+func (app *application) runStreams(ctx context.Context) {
+	for {
+		err := app.streams.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		app.logger.Errorw("stream delivery stopped, restarting", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// pushNotification tells the connected clients of the user about a new
+// notification. Failures are only logged, the notification is stored.
+func (app *application) pushNotification(ctx context.Context, n *store.Notification) {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	if err := app.streams.Publish(ctx, n.UserID, stream.EventNotification, n); err != nil {
+		app.logger.Errorw("error publishing notification", "notification", n.ID, "user", n.UserID, "error", err)
+	}
+}
+
+// signalNewPost tells the connected followers that their feed has a new
+// post. Followers of accounts too large to fan out are not signalled, they
+// pull the posts when they read their feed.
+func (app *application) signalNewPost(ctx context.Context, post *store.Post, followers []int64) {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	signal := NewPostsSignal{PostID: post.ID, AuthorID: post.UserID}
+	if err := app.streams.Signal(ctx, followers, stream.EventNewPosts, signal); err != nil {
+		app.logger.Errorw("error signalling new post", "post", post.ID, "error", err)
+	}
+}
+
+// CreateStreamTicket godoc
+//
+//	@Summary		Creates a stream ticket
+//	@Description	Issues a single-use ticket opening /stream or /stream/ws within 30 seconds, for browsers that cannot set the Authorization header on EventSource and WebSocket requests
+//	@Tags			stream
+//	@Produce		json
+//	@Success		201	{object}	StreamTicket
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/stream/tickets [post]
+func (app *application) createStreamTicketHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	plainTicket := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainTicket))
+	hashTicket := hex.EncodeToString(hash[:])
+
+	if err := app.store.StreamTicket.Create(ctx, user.ID, hashTicket, streamTicketExp); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	ticket := StreamTicket{Ticket: plainTicket, ExpiresAt: time.Now().Add(streamTicketExp)}
+	if err := app.JSONResponse(w, http.StatusCreated, ticket); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// streamAuthMiddleware authenticates streams with the Authorization header
+// or, for browsers, with a ticket in the query. Tickets are single-use and
+// short-lived so the URLs holding them are worthless once the stream opened.
+func (app *application) streamAuthMiddleware(next http.Handler) http.Handler {
+	withToken := app.AuthTokenMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plainTicket := r.URL.Query().Get("ticket")
+		if plainTicket == "" || r.Header.Get("Authorization") != "" {
+			withToken.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+
+		hash := sha256.Sum256([]byte(plainTicket))
+		userID, err := app.store.StreamTicket.Consume(ctx, hex.EncodeToString(hash[:]))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.statusUnauthorized(w, r, ErrInvalidStreamTicket)
+			default:
+				app.statusInternalServerError(w, r, err)
+			}
+			return
+		}
+
+		user, err := app.getUser(ctx, userID)
+		if err != nil {
+			app.statusUnauthorized(w, r, err)
+			return
+		}
+
+		if user.IsSuspended(time.Now()) {
+			app.forbiddenResponse(w, r, suspendedError(&user))
+			return
+		}
+
+		ctx = context.WithValue(ctx, userCtxKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkStreamOrigin refuses WebSocket handshakes from pages other than the
+// frontend. Browsers attach cookies and tickets of the visitor to the
+// connections any site opens, which the Origin header tells apart; clients
+// outside browsers send none.
+func (app *application) checkStreamOrigin(_ *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	allowed, err := url.Parse(app.config.frontendURL)
+	if err != nil {
+		return err
+	}
+
+	o, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(o.Scheme, allowed.Scheme) || !strings.EqualFold(o.Host, allowed.Host) {
+		return ErrForbiddenOrigin
+	}
+
+	return nil
+}
+
+// clearDeadlines lets a streaming connection outlive the server timeouts.
+func clearDeadlines(w http.ResponseWriter) error {
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	return nil
+}
+
+// lastEventID is where a reconnecting client resumes. EventSource sends the
+// Last-Event-ID header by itself, other clients may use the query.
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+
+	return r.URL.Query().Get("last_event_id")
+}
+
+// missedEvents subscribes the user and returns the events published after
+// lastID. Subscribing first makes sure no event falls between the two.
+func (app *application) missedEvents(ctx context.Context, userID int64, lastID string) (*stream.Subscription, []stream.Event, error) {
+	sub := app.streams.Subscribe(userID)
+	if lastID == "" {
+		return sub, nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	missed, err := app.streams.Replay(ctx, userID, lastID)
+	if err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+
+	return sub, missed, nil
+}
+
+// Stream godoc
+//
+//	@Summary		Streams events
+//	@Description	Pushes new notifications and new post signals as Server-Sent Events. Notifications carry an id to resume from with Last-Event-ID; a comment line is sent as heartbeat
+//	@Tags			stream
+//	@Produce		text/event-stream
+//	@Param			ticket			query	string	false	"Stream ticket, for clients that cannot set the Authorization header"
+//	@Param			last_event_id	query	string	false	"Resume after this event, when the Last-Event-ID header cannot be set"
+//	@Success		200
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/stream [get]
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := clearDeadlines(w); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	lastID := lastEventID(r)
+	sub, missed, err := app.missedEvents(ctx, user.ID, lastID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	// keeps nginx from buffering the stream
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(e stream.Event) error {
+		if err := stream.WriteSSE(w, e); err != nil {
+			return err
+		}
+		if e.ID != "" {
+			lastID = e.ID
+		}
+
+		return rc.Flush()
+	}
+
+	for _, e := range missed {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// dropped or shutting down, the client resumes elsewhere
+				return
+			}
+			if e.ID != "" && !stream.After(e.ID, lastID) {
+				// already sent by the replay
+				continue
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// StreamWebSocket godoc
+//
+//	@Summary		Streams events over a WebSocket
+//	@Description	Pushes the events of /stream as JSON text messages over a WebSocket, with ping frames as heartbeat. Handshakes from pages other than the frontend are refused
+//	@Tags			stream
+//	@Param			ticket			query	string	false	"Stream ticket, for clients that cannot set the Authorization header"
+//	@Param			last_event_id	query	string	false	"Resume after this event"
+//	@Success		101
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/stream/ws [get]
+func (app *application) streamWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := clearDeadlines(w); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	lastID := r.URL.Query().Get("last_event_id")
+	sub, missed, err := app.missedEvents(ctx, user.ID, lastID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	server := websocket.Server{
+		Handshake: app.checkStreamOrigin,
+		Handler: func(ws *websocket.Conn) {
+			app.serveWebSocket(ws, sub, lastID, missed)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (app *application) serveWebSocket(ws *websocket.Conn, sub *stream.Subscription, lastID string, missed []stream.Event) {
+	// clients send nothing, reading only notices when they go away
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		io.Copy(io.Discard, ws)
+	}()
+
+	send := func(e stream.Event) error {
+		if err := websocket.JSON.Send(ws, e); err != nil {
+			return err
+		}
+		if e.ID != "" {
+			lastID = e.ID
+		}
+
+		return nil
+	}
+
+	for _, e := range missed {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case <-heartbeat.C:
+			if err := ping(ws); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if e.ID != "" && !stream.After(e.ID, lastID) {
+				continue
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func ping(ws *websocket.Conn) error {
+	fw, err := ws.NewFrameWriter(websocket.PingFrame)
+	if err != nil {
+		return err
+	}
+
+	return fw.Close()
+}
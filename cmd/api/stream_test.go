@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social/internal/store"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// memoryTickets keeps stream tickets until they are consumed.
+type memoryTickets struct {
+	tickets map[string]int64
+}
+
+func (m *memoryTickets) Create(_ context.Context, userID int64, token string, _ time.Duration) error {
+	m.tickets[token] = userID
+	return nil
+}
+
+func (m *memoryTickets) Consume(_ context.Context, token string) (int64, error) {
+	userID, ok := m.tickets[token]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+
+	delete(m.tickets, token)
+	return userID, nil
+}
+
+func TestStreamTicket(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store.StreamTicket = &memoryTickets{tickets: make(map[string]int64)}
+	mux := app.mount()
+
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/stream/tickets", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+testToken)
+
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+
+	var body struct {
+		Data StreamTicket `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	openStream := func(ticket string) int {
+		// the stream stays open until the client goes away
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v1/stream?ticket="+ticket, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should open a stream with a ticket", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, openStream(body.Data.Ticket))
+	})
+
+	t.Run("should not accept a ticket twice", func(t *testing.T) {
+		checkResponseCode(t, http.StatusUnauthorized, openStream(body.Data.Ticket))
+	})
+
+	t.Run("should not accept a JWT in the query", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v1/stream?token="+testToken, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, mux).Code)
+	})
+}
+
+func TestCheckStreamOrigin(t *testing.T) {
+	app := newTestApplication(t, config{frontendURL: "https://social.example"})
+
+	tests := map[string]struct {
+		origin  string
+		allowed bool
+	}{
+		"frontend":         {"https://social.example", true},
+		"no origin":        {"", true},
+		"other site":       {"https://evil.example", false},
+		"other scheme":     {"http://social.example", false},
+		"frontend subpath": {"https://social.example.evil.example", false},
+	}
+
+	for name, tt := range tests {
+		r, err := http.NewRequest(http.MethodGet, "/v1/stream/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+
+		if err := app.checkStreamOrigin(nil, r); (err == nil) != tt.allowed {
+			t.Errorf("%s: checkStreamOrigin = %v, want allowed %v", name, err, tt.allowed)
+		}
+	}
+}
+
+func TestRequestLoggerOmitsQuery(t *testing.T) {
+	var buf bytes.Buffer
+	logger := middleware.RequestLogger(&pathLogFormatter{
+		&middleware.DefaultLogFormatter{Logger: log.New(&buf, "", 0), NoColor: true},
+	})
+
+	handler := logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/stream?ticket=s3cret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RequestURI = "/v1/stream?ticket=s3cret"
+
+	executeRequest(req, handler)
+
+	if line := buf.String(); strings.Contains(line, "s3cret") || !strings.Contains(line, "/v1/stream") {
+		t.Errorf("logged %q, want the path without the query", line)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"social/internal/mailer"
+	"social/internal/store"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	ErrInvalidSuspensionLength = errors.New("suspension needs a duration or to be permanent, not both")
+	ErrSuspendHigherRole       = errors.New("cannot suspend a user with an equal or higher role")
+)
+
+type SuspendUserPayload struct {
+	Reason       string `json:"reason" validate:"required,max=500"`
+	DurationDays int    `json:"duration_days" validate:"gte=0,lte=3650"`
+	Permanent    bool   `json:"permanent"`
+}
+
+type AppealSuspensionPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=100"`
+	Note     string `json:"note" validate:"required,max=2000"`
+}
+
+// suspendedError tells a suspended user until when they are suspended.
+func suspendedError(user *store.User) error {
+	if user.SuspendedUntil == nil {
+		return errors.New("account is suspended permanently")
+	}
+
+	return fmt.Errorf("account is suspended until %s", *user.SuspendedUntil)
+}
+
+// SuspendUser godoc
+//
+//	@Summary		Suspends a user
+//	@Description	Suspends a user for duration_days or permanently. Suspended users cannot sign in or use their tokens
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int					true	"User ID"
+//	@Param			payload	body		SuspendUserPayload	true	"Suspension payload"
+//	@Success		201		{object}	store.Suspension
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/suspensions [post]
+func (app *application) suspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	var payload SuspendUserPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if payload.Permanent == (payload.DurationDays > 0) {
+		app.statusBadRequest(w, r, ErrInvalidSuspensionLength)
+		return
+	}
+
+	ctx := r.Context()
+	moderator := ctx.Value(userCtxKey).(store.User)
+
+	suspension := &store.Suspension{
+		UserID:      userID,
+		ModeratorID: &moderator.ID,
+		Reason:      payload.Reason,
+	}
+	if payload.DurationDays > 0 {
+		endsAt := time.Now().AddDate(0, 0, payload.DurationDays).Format(time.RFC3339)
+		suspension.EndsAt = &endsAt
+	}
+
+	if err := app.suspendUser(ctx, &moderator, suspension); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		case errors.Is(err, ErrSuspendHigherRole):
+			app.forbiddenResponse(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("user.suspend", "user", userID, nil, suspension))
+
+	if err := app.JSONResponse(w, http.StatusCreated, suspension); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// GetUserSuspensions godoc
+//
+//	@Summary		Fetches the suspensions of a user
+//	@Description	Fetches every suspension of a user, newest first, with their appeals
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{array}		store.Suspension
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/suspensions [get]
+func (app *application) getUserSuspensionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	suspensions, err := app.store.Suspension.GetByUser(r.Context(), userID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, suspensions); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// LiftUserSuspension godoc
+//
+//	@Summary		Lifts the suspension of a user
+//	@Description	Lifts every active suspension of a user
+//	@Tags			moderation
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/suspensions [delete]
+func (app *application) liftUserSuspensionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	moderator := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Suspension.Lift(ctx, userID, moderator.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.evictUser(ctx, userID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditEvent("user.unsuspend", "user", userID, nil, nil))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AppealSuspension godoc
+//
+//	@Summary		Appeals a suspension
+//	@Description	Attaches a note to the active suspension of the user. Suspended users cannot get tokens, so they sign the appeal with their credentials
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		AppealSuspensionPayload	true	"Appeal payload"
+//	@Success		200		{object}	store.Suspension
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/appeal [post]
+func (app *application) appealSuspensionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload AppealSuspensionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.User.GetByEmail(ctx, payload.Email)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.statusUnauthorized(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !user.Password.Equal(payload.Password) {
+		app.statusUnauthorized(w, r, ErrorInvalidPass)
+		return
+	}
+
+	suspension, err := app.store.Suspension.Appeal(ctx, user.ID, payload.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		case errors.Is(err, store.ErrAlreadyAppealed):
+			app.statusConflict(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	event := auditEvent("suspension.appeal", "suspension", suspension.ID, nil, map[string]string{"note": payload.Note})
+	event.ActorID = &user.ID
+	app.audit(r, event)
+
+	if err := app.JSONResponse(w, http.StatusOK, suspension); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// suspendUser suspends a user below the moderator's role, drops them from
+// the user cache so the suspension applies to their next request and
+// e-mails them a notice.
+func (app *application) suspendUser(ctx context.Context, moderator *store.User, suspension *store.Suspension) error {
+	user, err := app.getSuspendable(ctx, moderator, suspension.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := app.store.Suspension.Create(ctx, suspension); err != nil {
+		return err
+	}
+
+	app.noticeSuspension(ctx, &user, suspension)
+
+	return nil
+}
+
+// getSuspendable fetches a user the moderator may suspend, failing with
+// ErrSuspendHigherRole for users of the same or a higher role.
+func (app *application) getSuspendable(ctx context.Context, moderator *store.User, userID int64) (store.User, error) {
+	user, err := app.store.User.GetById(ctx, userID)
+	if err != nil {
+		return store.User{}, err
+	}
+
+	if user.Role.Level >= moderator.Role.Level {
+		return store.User{}, ErrSuspendHigherRole
+	}
+
+	return user, nil
+}
+
+// noticeSuspension applies a stored suspension to the user's next request
+// and e-mails them about it. The suspension is already stored, so failures
+// are only logged; a user left in the cache is suspended once it expires.
+func (app *application) noticeSuspension(ctx context.Context, user *store.User, suspension *store.Suspension) {
+	if err := app.evictUser(ctx, user.ID); err != nil {
+		app.logger.Errorw("error evicting suspended user", "user", user.ID, "error", err)
+	}
+
+	vars := struct {
+		Username  string
+		Reason    string
+		EndsAt    *string
+		AppealURL string
+	}{
+		Username:  user.Username,
+		Reason:    suspension.Reason,
+		EndsAt:    suspension.EndsAt,
+		AppealURL: app.config.frontendURL + "/appeal",
+	}
+	isProdEnv := app.config.env == "production"
+
+	go func() {
+		if err := app.mailer.Send(mailer.UserSuspendedTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+			app.logger.Errorw("error sending suspension notice", "user", user.ID, "error", err)
+		}
+	}()
+}
+
+// evictUser drops a user from the cache so changes to their account apply
+// to their next request.
+func (app *application) evictUser(ctx context.Context, userID int64) error {
+	if !app.config.redisCfg.enabled {
+		return nil
+	}
+
+	return app.cacheStorage.Users.Delete(ctx, userID)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"social/internal/store"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-redis/redis/v8"
+)
+
+// trendingTagsLimit is how many tags the ranking keeps; clients page
+// through it with limit and offset.
+const trendingTagsLimit = 50
+
+var ErrInvalidTag = errors.New("tag must have between 1 and 100 characters")
+
+type tagsConfig struct {
+	trendingWindow   time.Duration
+	trendingBaseline time.Duration
+	refreshInterval  time.Duration
+}
+
+// GetTrendingTags godoc
+//
+//	@Summary		Fetches trending tags
+//	@Description	Fetches the tags gaining usage fastest in the recent window compared to their baseline
+//	@Tags			tags
+//	@Produce		json
+//	@Param			limit	query		int	false	"Page size"
+//	@Param			offset	query		int	false	"Page offset"
+//	@Success		200		{array}		store.TrendingTag
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/trending [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginatedQuery{Limit: 10}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	tags, err := app.getTrendingTags(r.Context())
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	start := min(pq.Offset, len(tags))
+	end := min(start+pq.Limit, len(tags))
+
+	if err := app.JSONResponse(w, http.StatusOK, tags[start:end]); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// GetTagPosts godoc
+//
+//	@Summary		Fetches the posts of a tag
+//	@Description	Fetches the published posts carrying a tag, newest first
+//	@Tags			tags
+//	@Produce		json
+//	@Param			tag		path		string	true	"Tag"
+//	@Param			limit	query		int		false	"Page size"
+//	@Param			offset	query		int		false	"Page offset"
+//	@Success		200		{array}		store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/posts [get]
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := tagFromRequest(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	pq, err := store.PaginatedQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	viewer := ctx.Value(userCtxKey).(store.User)
+
+	posts, err := app.store.Post.GetByTag(ctx, tag, viewer.ID, pq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, posts); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// FollowTag godoc
+//
+//	@Summary		Follows a tag
+//	@Description	Follows a tag so its posts show up in the user's feed
+//	@Tags			tags
+//	@Param			tag	path	string	true	"Tag"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/follow [put]
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := tagFromRequest(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Tag.Follow(ctx, user.ID, tag); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnfollowTag godoc
+//
+//	@Summary		Unfollows a tag
+//	@Description	Stops following a tag
+//	@Tags			tags
+//	@Param			tag	path	string	true	"Tag"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/follow [delete]
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := tagFromRequest(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if err := app.store.Tag.Unfollow(ctx, user.ID, tag); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFollowedTags godoc
+//
+//	@Summary		Fetches followed tags
+//	@Description	Fetches the tags the authenticated user follows
+//	@Tags			tags
+//	@Produce		json
+//	@Success		200	{array}		string
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/tags [get]
+func (app *application) getFollowedTagsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	tags, err := app.store.Tag.GetFollowed(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, tags); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+func tagFromRequest(r *http.Request) (string, error) {
+	tag := chi.URLParam(r, "tag")
+	if tag == "" || utf8.RuneCountInString(tag) > 100 {
+		return "", ErrInvalidTag
+	}
+
+	return strings.ToLower(tag), nil
+}
+
+// getTrendingTags serves the ranking precomputed by the refresh job,
+// computing and caching it on a miss.
+func (app *application) getTrendingTags(ctx context.Context) ([]store.TrendingTag, error) {
+	if !app.config.redisCfg.enabled {
+		return app.computeTrendingTags(ctx)
+	}
+
+	tags, err := app.cacheStorage.Tags.GetTrending(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if tags == nil {
+		tags, err = app.computeTrendingTags(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := app.cacheStorage.Tags.SetTrending(ctx, tags); err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+func (app *application) computeTrendingTags(ctx context.Context) ([]store.TrendingTag, error) {
+	return app.store.Tag.GetTrending(
+		ctx,
+		app.config.tags.trendingWindow,
+		app.config.tags.trendingBaseline,
+		trendingTagsLimit,
+	)
+}
+
+// refreshTrendingTags recomputes the ranking. Instances overwrite each
+// other's result, so running it everywhere is harmless.
+func (app *application) refreshTrendingTags(ctx context.Context) {
+	tags, err := app.computeTrendingTags(ctx)
+	if err != nil {
+		app.logger.Errorw("error computing trending tags", "error", err)
+		return
+	}
+
+	if err := app.cacheStorage.Tags.SetTrending(ctx, tags); err != nil {
+		app.logger.Errorw("error caching trending tags", "error", err)
+	}
+}
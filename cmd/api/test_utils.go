@@ -3,11 +3,15 @@ package main
 import (
 	"net/http"
 	"net/http/httptest"
+	"social/internal/audit"
 	"social/internal/auth"
 	"social/internal/ratelimiter"
 	"social/internal/store"
 	"social/internal/store/cache"
+	"social/internal/stream"
+	"social/internal/webhooks"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -24,6 +28,8 @@ func newTestApplication(t *testing.T, cfg config) *application {
 		cfg.rateLimiter.TimeFrame,
 	)
 
+	webhookStore := webhooks.NewMockStore()
+
 	return &application{
 		config:        cfg,
 		logger:        logger,
@@ -31,6 +37,12 @@ func newTestApplication(t *testing.T, cfg config) *application {
 		cacheStorage:  mockCacheStore,
 		authenticator: mockAuth,
 		rateLimiter:   rateLimiter,
+		auditLog:      audit.NewMockStore(),
+		auditQueue:    make(chan audit.Event, auditQueueSize),
+		streams:       stream.NewHub(stream.NewLocalBackend(streamHistory)),
+
+		webhooks:          webhookStore,
+		webhookDispatcher: webhooks.NewDispatcher(webhookStore, webhooks.NewHTTPClient(time.Second, false)),
 	}
 }
 
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"social/internal/store"
+	"time"
+)
+
+type timelineConfig struct {
+	enabled bool
+	// maxLength is how many entries a cached timeline keeps; deeper feed
+	// pages are served by the SQL query.
+	maxLength int
+	// fanOutThreshold is the follower count from which an author's posts
+	// are no longer pushed to followers but pulled when they read.
+	fanOutThreshold int
+}
+
+func (app *application) timelinesEnabled() bool {
+	return app.config.redisCfg.enabled && app.config.timeline.enabled
+}
+
+// fanOutPost pushes a published post or repost to the cached timelines of
+// its author and, unless the author has too many followers, of each
+// follower, and signals the followers that are connected. It is run by the
+// outbox relay when the post store announces the post.
+func (app *application) fanOutPost(ctx context.Context, post *store.Post) error {
+	threshold := app.config.timeline.fanOutThreshold
+
+	followers, _, err := app.store.Follower.GetFollowerIDs(ctx, post.UserID, threshold)
+	if err != nil {
+		return err
+	}
+
+	app.signalNewPost(ctx, post, followers)
+
+	if !app.timelinesEnabled() {
+		return nil
+	}
+
+	score := float64(time.Now().Unix())
+	if post.PublishAt != nil {
+		if t, err := time.Parse(time.RFC3339, *post.PublishAt); err == nil {
+			score = float64(t.Unix())
+		}
+	}
+
+	entry := store.TimelineEntry{PostID: post.ID, SharedID: post.SharedPostID(), Score: score}
+	userIDs := append(followers, post.UserID)
+
+	return app.cacheStorage.Timelines.Push(ctx, userIDs, entry, app.config.timeline.maxLength)
+}
+
+// removeFromTimelines takes a deleted post or an undone repost off the
+// cached timelines it was pushed to. Reposts of a deleted post are left in
+// place and skipped when read, which rebuilds the timelines holding them.
+func (app *application) removeFromTimelines(ctx context.Context, msg *store.PostMessage) error {
+	if !app.timelinesEnabled() {
+		return nil
+	}
+
+	followers, _, err := app.store.Follower.GetFollowerIDs(ctx, msg.UserID, app.config.timeline.fanOutThreshold)
+	if err != nil {
+		return err
+	}
+
+	entry := store.TimelineEntry{PostID: msg.PostID, SharedID: msg.SharedID}
+
+	return app.cacheStorage.Timelines.Remove(ctx, append(followers, msg.UserID), entry)
+}
+
+// invalidateTimeline drops the cached timeline of a user whose follows
+// changed, since posts pushed earlier no longer match who they follow.
+func (app *application) invalidateTimeline(ctx context.Context, userID int64) {
+	if !app.timelinesEnabled() {
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Delete(ctx, userID); err != nil {
+		app.logger.Errorw("error invalidating timeline", "user", userID, "error", err)
+	}
+}
+
+// getTimelineFeed serves a chronological feed page from the cached timeline
+// merged with the entries pulled from large accounts and followed tags. It
+// reports false when the page has to come from the SQL query instead: when
+// the timeline was not cached, in which case it is rebuilt for the next
+// read, when the page lies beyond the cached length, or when the page holds
+// posts hidden or deleted since they were pushed, in which case the
+// timeline is dropped to be rebuilt.
+func (app *application) getTimelineFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetadata, bool, error) {
+	cfg := app.config.timeline
+	want := fq.Offset + fq.Limit
+	if want > cfg.maxLength {
+		return nil, false, nil
+	}
+
+	// the whole timeline is read: reposts of the same post are separate
+	// entries, so the first want entries may hold fewer posts
+	pushed, cached, err := app.cacheStorage.Timelines.Get(ctx, userID, cfg.maxLength)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !cached {
+		entries, err := app.store.Post.GetTimelineEntries(ctx, userID, store.TimelinePushed, cfg.fanOutThreshold, cfg.maxLength)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if err := app.cacheStorage.Timelines.Set(ctx, userID, entries, cfg.maxLength); err != nil {
+			return nil, false, err
+		}
+
+		return nil, false, nil
+	}
+
+	pulled, err := app.store.Post.GetTimelineEntries(ctx, userID, store.TimelinePulled, cfg.fanOutThreshold, want)
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries := mergeTimelines(pushed, pulled)
+	if len(entries) < want && len(pushed) >= cfg.maxLength {
+		return nil, false, nil
+	}
+
+	start := min(fq.Offset, len(entries))
+	end := min(start+fq.Limit, len(entries))
+
+	ids := make([]int64, 0, end-start)
+	for _, e := range entries[start:end] {
+		ids = append(ids, e.PostID)
+	}
+
+	feed, err := app.store.Post.GetFeedByIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(feed) < len(ids) {
+		if err := app.cacheStorage.Timelines.Delete(ctx, userID); err != nil {
+			return nil, false, err
+		}
+
+		return nil, false, nil
+	}
+
+	return feed, true, nil
+}
+
+// mergeTimelines combines timeline sources newest first, keeping the latest
+// entry of each shared post.
+func mergeTimelines(sources ...[]store.TimelineEntry) []store.TimelineEntry {
+	merged := make([]store.TimelineEntry, 0)
+	for _, source := range sources {
+		merged = append(merged, source...)
+	}
+
+	slices.SortFunc(merged, func(a, b store.TimelineEntry) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.PostID, a.PostID)
+	})
+
+	seen := make(map[int64]bool, len(merged))
+
+	return slices.DeleteFunc(merged, func(e store.TimelineEntry) bool {
+		if seen[e.SharedID] {
+			return true
+		}
+
+		seen[e.SharedID] = true
+		return false
+	})
+}
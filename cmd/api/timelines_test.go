@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"social/internal/store"
+	"testing"
+)
+
+// memoryTimelines is a single cached timeline.
+type memoryTimelines struct {
+	entries []store.TimelineEntry
+	dropped bool
+}
+
+func (m *memoryTimelines) Get(_ context.Context, _ int64, limit int) ([]store.TimelineEntry, bool, error) {
+	return m.entries[:min(limit, len(m.entries))], !m.dropped, nil
+}
+
+func (m *memoryTimelines) Set(context.Context, int64, []store.TimelineEntry, int) error {
+	return nil
+}
+
+func (m *memoryTimelines) Push(context.Context, []int64, store.TimelineEntry, int) error {
+	return nil
+}
+
+func (m *memoryTimelines) Remove(context.Context, []int64, store.TimelineEntry) error {
+	return nil
+}
+
+func (m *memoryTimelines) Delete(context.Context, int64) error {
+	m.dropped = true
+	return nil
+}
+
+// timelinePosts serves feed items for the entries of a timeline, skipping
+// the removed posts, and records whether the SQL feed was queried.
+type timelinePosts struct {
+	*store.PostStore
+
+	shared   map[int64]int64
+	removed  map[int64]bool
+	queried  bool
+	requests [][]int64
+}
+
+func (p *timelinePosts) GetTimelineEntries(context.Context, int64, string, int, int) ([]store.TimelineEntry, error) {
+	return nil, nil
+}
+
+func (p *timelinePosts) GetFeedByIDs(_ context.Context, _ int64, ids []int64) ([]store.PostWithMetadata, error) {
+	p.requests = append(p.requests, ids)
+
+	feed := make([]store.PostWithMetadata, 0, len(ids))
+	for _, id := range ids {
+		if p.removed[id] {
+			continue
+		}
+
+		item := store.PostWithMetadata{Post: store.Post{ID: p.shared[id]}}
+		if item.ID != id {
+			item.RepostedBy = &store.RepostAttribution{RepostID: id}
+		}
+		feed = append(feed, item)
+	}
+
+	return feed, nil
+}
+
+func (p *timelinePosts) GetUserFeed(context.Context, int64, store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	p.queried = true
+	return []store.PostWithMetadata{}, nil
+}
+
+func TestTimelineFeed(t *testing.T) {
+	// posts 1 and 3 are each in the timeline twice, through reposts 11 and 12
+	entries := []store.TimelineEntry{
+		{PostID: 11, SharedID: 1, Score: 300},
+		{PostID: 12, SharedID: 3, Score: 250},
+		{PostID: 2, SharedID: 2, Score: 200},
+		{PostID: 1, SharedID: 1, Score: 100},
+		{PostID: 3, SharedID: 3, Score: 50},
+		{PostID: 4, SharedID: 4, Score: 10},
+	}
+
+	setup := func(t *testing.T, maxLength int) (http.Handler, *timelinePosts, *memoryTimelines, string) {
+		app := newTestApplication(t, config{
+			redisCfg: redisConfig{enabled: true},
+			timeline: timelineConfig{enabled: true, maxLength: maxLength, fanOutThreshold: 100},
+		})
+
+		posts := &timelinePosts{
+			shared:  map[int64]int64{11: 1, 12: 3, 1: 1, 2: 2, 3: 3, 4: 4},
+			removed: make(map[int64]bool),
+		}
+		app.store.Post = posts
+
+		timelines := &memoryTimelines{entries: entries}
+		app.cacheStorage.Timelines = timelines
+
+		token, err := app.authenticator.GenerateToken(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return app.mount(), posts, timelines, token
+	}
+
+	getPage := func(t *testing.T, mux http.Handler, token, query string) []int64 {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Authorization", "Bearer "+token)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data []store.PostWithMetadata `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]int64, 0, len(body.Data))
+		for _, p := range body.Data {
+			ids = append(ids, p.ID)
+		}
+
+		return ids
+	}
+
+	t.Run("should list each post once at its latest activity", func(t *testing.T) {
+		mux, posts, _, token := setup(t, 20)
+
+		first := getPage(t, mux, token, "limit=2&offset=0")
+		second := getPage(t, mux, token, "limit=2&offset=2")
+		third := getPage(t, mux, token, "limit=2&offset=4")
+
+		if !slices.Equal(first, []int64{1, 3}) || !slices.Equal(second, []int64{2, 4}) || len(third) != 0 {
+			t.Errorf("pages = %v %v %v, want [1 3] [2 4] []", first, second, third)
+		}
+		if !slices.Equal(posts.requests[0], []int64{11, 12}) {
+			t.Errorf("first page loaded %v, want the reposts 11 and 12", posts.requests[0])
+		}
+		if posts.queried {
+			t.Error("the SQL feed was queried, want the cached timeline")
+		}
+	})
+
+	t.Run("should query pages beyond a full timeline", func(t *testing.T) {
+		mux, posts, _, token := setup(t, len(entries))
+
+		getPage(t, mux, token, "limit=3&offset=2")
+
+		if !posts.queried {
+			t.Error("the cached timeline was used, want the SQL feed")
+		}
+	})
+
+	t.Run("should rebuild a timeline holding removed posts", func(t *testing.T) {
+		mux, posts, timelines, token := setup(t, 20)
+		posts.removed[12] = true
+
+		getPage(t, mux, token, "limit=2&offset=0")
+
+		if !posts.queried || !timelines.dropped {
+			t.Errorf("queried = %v, dropped = %v, want the page from the SQL feed and the timeline dropped", posts.queried, timelines.dropped)
+		}
+	})
+}
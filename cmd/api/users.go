@@ -49,6 +49,53 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetUserPosts godoc
+//
+//	@Summary		Fetches a user timeline
+//	@Description	Fetches the posts of a user, pinned posts first
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Page size"
+//	@Param			offset	query		int	false	"Page offset"
+//	@Success		200		{array}		store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/posts [get]
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	authorID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	pq, err := store.PaginatedQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	viewer := ctx.Value(userCtxKey).(store.User)
+
+	posts, err := app.store.Post.GetByUser(ctx, authorID, viewer.ID, pq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, posts); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
 // FollowUser godoc
 //
 //	@Summary		Follows a user
@@ -65,13 +112,15 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	follower := ctx.Value("userCtx").(*store.User)
+	follower := ctx.Value(userCtxKey).(store.User)
 	followedId, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		app.statusBadRequest(w, r, err)
+		return
 	}
 
-	if err := app.store.Follower.Follow(ctx, follower.ID, followedId); err != nil {
+	followed := store.NewOutboxEvent(store.OutboxUserFollowed, FollowMessage{UserID: followedId, FollowerID: follower.ID})
+	if err := app.store.Follower.Follow(ctx, follower.ID, followedId, followed); err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.statusNotFound(w, r, err)
@@ -83,6 +132,8 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.invalidateTimeline(ctx, follower.ID)
+
 	if err := app.JSONResponse(w, http.StatusNoContent, nil); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
@@ -92,13 +143,15 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	follower := ctx.Value("userCtx").(*store.User)
+	follower := ctx.Value(userCtxKey).(store.User)
 	unfollowedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		app.statusBadRequest(w, r, err)
+		return
 	}
 
-	if err = app.store.Follower.Unfollow(ctx, follower.ID, unfollowedID); err != nil {
+	unfollowed := store.NewOutboxEvent(store.OutboxUserUnfollowed, FollowMessage{UserID: unfollowedID, FollowerID: follower.ID})
+	if err = app.store.Follower.Unfollow(ctx, follower.ID, unfollowedID, unfollowed); err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.statusNotFound(w, r, err)
@@ -108,6 +161,8 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	app.invalidateTimeline(ctx, follower.ID)
+
 	response := map[string]string{
 		"success": "successfully unfollowed",
 	}
@@ -1,10 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"social/internal/store"
 	"testing"
+	"time"
 )
 
+// activityUsers counts the activity writes, failing them while err is set.
+type activityUsers struct {
+	*store.MockUserStore
+
+	writes int
+	err    error
+}
+
+func (u *activityUsers) RecordActivity(context.Context, int64, time.Time) error {
+	u.writes++
+	return u.err
+}
+
 func TestGerUser(t *testing.T) {
 	app := newTestApplication(t, config{})
 	mux := app.mount()
@@ -34,3 +51,33 @@ func TestGerUser(t *testing.T) {
 		checkResponseCode(t, http.StatusOK, rr.Code)
 	})
 }
+
+func TestRecordActivity(t *testing.T) {
+	app := newTestApplication(t, config{})
+	users := &activityUsers{MockUserStore: &store.MockUserStore{}}
+	app.store.User = users
+	ctx := context.Background()
+
+	t.Run("should write once a day per user", func(t *testing.T) {
+		app.recordActivity(ctx, 1)
+		app.recordActivity(ctx, 1)
+		app.recordActivity(ctx, 2)
+
+		if users.writes != 2 {
+			t.Errorf("expected 2 writes, got %d", users.writes)
+		}
+	})
+
+	t.Run("should write again after a failed write", func(t *testing.T) {
+		users.writes, users.err = 0, errors.New("down")
+		app.recordActivity(ctx, 3)
+
+		users.err = nil
+		app.recordActivity(ctx, 3)
+		app.recordActivity(ctx, 3)
+
+		if users.writes != 2 {
+			t.Errorf("expected 2 writes, got %d", users.writes)
+		}
+	})
+}
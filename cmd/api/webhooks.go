@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"social/internal/store"
+	"social/internal/webhooks"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type webhookKey string
+
+const webhookCtx webhookKey = "webhook"
+
+type webhookConfig struct {
+	enabled   bool
+	interval  time.Duration
+	batchSize int
+	timeout   time.Duration
+	// allowPrivate lets endpoints live on the internal network, which is
+	// refused in production.
+	allowPrivate bool
+}
+
+var (
+	ErrInvalidWebhookURL = errors.New("webhook url must be an absolute http or https url")
+	ErrAllUsersWebhook   = errors.New("only admins may receive the events of all users")
+)
+
+type CreateWebhookPayload struct {
+	URL      string   `json:"url" validate:"required,url,max=2048"`
+	Events   []string `json:"events" validate:"required,min=1,dive,oneof=post.created post.deleted comment.created user.followed user.unfollowed user.registered"`
+	AllUsers bool     `json:"all_users"`
+}
+
+// PostCreatedEvent is a post as it went live, without the viewer and
+// moderation details a store.Post carries.
+type PostCreatedEvent struct {
+	PostID    int64    `json:"post_id"`
+	UserID    int64    `json:"user_id"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags,omitempty"`
+	Language  string   `json:"language,omitempty"`
+	QuoteOfID *int64   `json:"quote_of_id,omitempty"`
+	PublishAt *string  `json:"publish_at,omitempty"`
+}
+
+func newPostCreatedEvent(post *store.Post) PostCreatedEvent {
+	return PostCreatedEvent{
+		PostID:    post.ID,
+		UserID:    post.UserID,
+		Title:     post.Title,
+		Content:   post.Content,
+		Tags:      post.Tags,
+		Language:  post.Language,
+		QuoteOfID: post.QuoteOfID,
+		PublishAt: post.PublishAt,
+	}
+}
+
+type PostDeletedEvent struct {
+	PostID int64 `json:"post_id"`
+	UserID int64 `json:"user_id"`
+}
+
+type CommentCreatedEvent struct {
+	CommentID int64  `json:"comment_id"`
+	PostID    int64  `json:"post_id"`
+	ParentID  *int64 `json:"parent_id,omitempty"`
+	UserID    int64  `json:"user_id"`
+	Content   string `json:"content"`
+}
+
+type FollowEvent struct {
+	UserID     int64 `json:"user_id"`
+	FollowerID int64 `json:"follower_id"`
+}
+
+type UserRegisteredEvent struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// emitWebhook enqueues an event for the endpoints of the users it concerns
+// and the admin endpoints covering every user. Failures are only logged:
+// webhooks must not fail the action they are about.
+func (app *application) emitWebhook(ctx context.Context, eventType string, userIDs []int64, data any) {
+	e, err := webhooks.NewEvent(eventType, userIDs, data)
+	if err == nil {
+		_, err = app.webhookDispatcher.Publish(ctx, e)
+	}
+
+	if err != nil {
+		app.logger.Errorw("error emitting webhook event", "type", eventType, "error", err)
+	}
+}
+
+// deliverWebhooks sends the due deliveries, batch by batch.
+func (app *application) deliverWebhooks(ctx context.Context) {
+	for {
+		n, err := app.webhookDispatcher.DeliverDue(ctx, app.config.webhooks.batchSize)
+		if err != nil {
+			app.logger.Errorw("error delivering webhooks", "error", err)
+			return
+		}
+
+		if n == 0 || n < app.config.webhooks.batchSize {
+			return
+		}
+	}
+}
+
+// CreateWebhook godoc
+//
+//	@Summary		Registers a webhook endpoint
+//	@Description	Registers an endpoint receiving the events of the current user of the given types, or of every user for admins setting all_users. Deliveries are signed with the returned secret, which is not shown again, in the X-Webhook-Signature header
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateWebhookPayload	true	"Endpoint"
+//	@Success		201		{object}	webhooks.Endpoint
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [post]
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if u, err := url.Parse(payload.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		app.statusBadRequest(w, r, ErrInvalidWebhookURL)
+		return
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	if payload.AllUsers {
+		allowed, err := app.checkRolePrecedence(ctx, &user, "admin")
+		if err != nil {
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r, ErrAllUsersWebhook)
+			return
+		}
+	}
+
+	endpoint := &webhooks.Endpoint{
+		UserID:   user.ID,
+		URL:      payload.URL,
+		Events:   payload.Events,
+		AllUsers: payload.AllUsers,
+	}
+
+	if err := app.webhooks.CreateEndpoint(ctx, endpoint); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditEvent("webhook.create", "webhook", endpoint.ID, nil, map[string]any{
+		"url":       endpoint.URL,
+		"events":    endpoint.Events,
+		"all_users": endpoint.AllUsers,
+	}))
+
+	if err := app.JSONResponse(w, http.StatusCreated, endpoint); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// GetWebhooks godoc
+//
+//	@Summary		Lists webhook endpoints
+//	@Description	Lists the webhook endpoints of the current user
+//	@Tags			webhooks
+//	@Produce		json
+//	@Success		200	{array}		webhooks.Endpoint
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [get]
+func (app *application) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(userCtxKey).(store.User)
+
+	endpoints, err := app.webhooks.ListEndpoints(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, endpoints); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// GetWebhook godoc
+//
+//	@Summary		Fetches a webhook endpoint
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Success		200			{object}	webhooks.Endpoint
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID} [get]
+func (app *application) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := getWebhookFromCtx(r)
+
+	if err := app.JSONResponse(w, http.StatusOK, endpoint); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// DeleteWebhook godoc
+//
+//	@Summary		Deletes a webhook endpoint
+//	@Description	Deletes a webhook endpoint with its pending deliveries and delivery log
+//	@Tags			webhooks
+//	@Param			webhookID	path	int	true	"Webhook ID"
+//	@Success		204
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID} [delete]
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := getWebhookFromCtx(r)
+
+	if err := app.webhooks.DeleteEndpoint(r.Context(), endpoint.ID); err != nil {
+		switch {
+		case errors.Is(err, webhooks.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent("webhook.delete", "webhook", endpoint.ID, map[string]any{
+		"user_id": endpoint.UserID,
+		"url":     endpoint.URL,
+	}, nil))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries godoc
+//
+//	@Summary		Lists webhook deliveries
+//	@Description	Lists the deliveries of a webhook endpoint, latest first, with their status, attempts and last response
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			webhookID	path		int		true	"Webhook ID"
+//	@Param			status		query		string	false	"pending, succeeded or dead"
+//	@Param			limit		query		int		false	"Page size"
+//	@Param			offset		query		int		false	"Page offset"
+//	@Success		200			{array}		webhooks.Delivery
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID}/deliveries [get]
+func (app *application) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := webhooks.DeliveryQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	endpoint := getWebhookFromCtx(r)
+
+	deliveries, err := app.webhooks.ListDeliveries(r.Context(), endpoint.ID, q)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.JSONResponse(w, http.StatusOK, deliveries); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// RedeliverWebhook godoc
+//
+//	@Summary		Redelivers a webhook delivery
+//	@Description	Schedules a delivery again right away with its attempts reset, typically a dead one
+//	@Tags			webhooks
+//	@Param			webhookID	path	int	true	"Webhook ID"
+//	@Param			deliveryID	path	int	true	"Delivery ID"
+//	@Success		202
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver [post]
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		app.statusBadRequest(w, r, err)
+		return
+	}
+
+	endpoint := getWebhookFromCtx(r)
+
+	if err := app.webhooks.Redeliver(r.Context(), endpoint.ID, deliveryID); err != nil {
+		switch {
+		case errors.Is(err, webhooks.ErrNotFound):
+			app.statusNotFound(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// webhooksContextMiddleware loads the endpoint of the route. Endpoints of
+// other users are not found, except for admins.
+func (app *application) webhooksContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+		if err != nil {
+			app.statusBadRequest(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		user := ctx.Value(userCtxKey).(store.User)
+
+		endpoint, err := app.webhooks.GetEndpoint(ctx, webhookID)
+		if err != nil {
+			switch {
+			case errors.Is(err, webhooks.ErrNotFound):
+				app.statusNotFound(w, r, err)
+			default:
+				app.statusInternalServerError(w, r, err)
+			}
+			return
+		}
+
+		if endpoint.UserID != user.ID {
+			allowed, err := app.checkRolePrecedence(ctx, &user, "admin")
+			if err != nil {
+				app.statusInternalServerError(w, r, err)
+				return
+			}
+
+			if !allowed {
+				app.statusNotFound(w, r, webhooks.ErrNotFound)
+				return
+			}
+		}
+
+		ctx = context.WithValue(ctx, webhookCtx, &endpoint)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getWebhookFromCtx(r *http.Request) *webhooks.Endpoint {
+	endpoint := r.Context().Value(webhookCtx).(*webhooks.Endpoint)
+	return endpoint
+}
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_posts_scheduled_publish_at;
+
+ALTER TABLE posts
+DROP CONSTRAINT IF EXISTS chk_posts_status;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS publish_at,
+DROP COLUMN IF EXISTS status;
@@ -0,0 +1,11 @@
+ALTER TABLE posts
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'published',
+ADD COLUMN publish_at TIMESTAMP(0) WITH TIME ZONE;
+
+ALTER TABLE posts
+ADD CONSTRAINT chk_posts_status CHECK (status IN ('draft', 'scheduled', 'published', 'archived'));
+
+UPDATE posts
+SET publish_at = created_at;
+
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled_publish_at ON posts (publish_at) WHERE status = 'scheduled';
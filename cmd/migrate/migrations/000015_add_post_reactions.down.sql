@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS post_reaction_counts;
+
+DROP TABLE IF EXISTS post_reactions;
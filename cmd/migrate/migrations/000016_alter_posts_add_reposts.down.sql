@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_posts_quote_of_id;
+
+DROP INDEX IF EXISTS idx_posts_user_repost;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS quote_count,
+DROP COLUMN IF EXISTS repost_count,
+DROP COLUMN IF EXISTS quote_of_id,
+DROP COLUMN IF EXISTS repost_of_id;
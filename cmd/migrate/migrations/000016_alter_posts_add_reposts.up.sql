@@ -0,0 +1,9 @@
+ALTER TABLE posts
+ADD COLUMN repost_of_id bigint REFERENCES posts (id) ON DELETE CASCADE,
+ADD COLUMN quote_of_id bigint REFERENCES posts (id) ON DELETE SET NULL,
+ADD COLUMN repost_count INT NOT NULL DEFAULT 0,
+ADD COLUMN quote_count INT NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_user_repost ON posts (user_id, repost_of_id) WHERE repost_of_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_quote_of_id ON posts (quote_of_id) WHERE quote_of_id IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE posts
+ADD COLUMN pinned_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_pinned_at ON posts (user_id, pinned_at) WHERE pinned_at IS NOT NULL;
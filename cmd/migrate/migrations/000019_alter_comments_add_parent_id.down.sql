@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_comments_parent_id;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS reply_count,
+DROP COLUMN IF EXISTS parent_id;
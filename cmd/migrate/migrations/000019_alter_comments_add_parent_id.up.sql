@@ -0,0 +1,5 @@
+ALTER TABLE comments
+ADD COLUMN parent_id bigint REFERENCES comments (id) ON DELETE CASCADE,
+ADD COLUMN reply_count INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id, created_at) WHERE parent_id IS NOT NULL;
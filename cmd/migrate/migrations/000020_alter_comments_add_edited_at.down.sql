@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_comments_post_created_at;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,4 @@
+ALTER TABLE comments
+ADD COLUMN edited_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_created_at ON comments (post_id, created_at, id) WHERE parent_id IS NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE comments
+DROP COLUMN IF EXISTS like_count;
+
+DROP TABLE IF EXISTS comment_likes;
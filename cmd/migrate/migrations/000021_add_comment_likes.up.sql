@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS comment_likes (
+    comment_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE comments
+ADD COLUMN like_count INT NOT NULL DEFAULT 0;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS mentions (
+    id bigserial PRIMARY KEY,
+    mentioned_user_id bigint NOT NULL,
+    author_id bigint NOT NULL,
+    post_id bigint NOT NULL,
+    comment_id bigint,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (mentioned_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mentions_target ON mentions (mentioned_user_id, post_id, COALESCE(comment_id, 0));
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user_created_at ON mentions (mentioned_user_id, created_at DESC);
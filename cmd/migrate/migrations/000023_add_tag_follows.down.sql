@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_publish_at;
+
+DROP TABLE IF EXISTS tag_follows;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+ADD COLUMN follower_count INT NOT NULL DEFAULT 0;
+
+UPDATE users u SET follower_count = (
+    SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id
+);
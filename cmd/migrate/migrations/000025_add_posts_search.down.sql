@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+DROP TRIGGER IF EXISTS posts_search_vector_trigger ON posts;
+
+DROP FUNCTION IF EXISTS posts_search_vector_update;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS search_vector,
+DROP COLUMN IF EXISTS search_language;
@@ -0,0 +1,24 @@
+ALTER TABLE posts
+ADD COLUMN search_language regconfig NOT NULL DEFAULT 'english',
+ADD COLUMN search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION posts_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector(NEW.search_language, COALESCE(NEW.title, '')), 'A') ||
+        setweight(to_tsvector(NEW.search_language, COALESCE(NEW.content, '')), 'B') ||
+        setweight(to_tsvector(NEW.search_language, COALESCE(array_to_string(NEW.tags, ' '), '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_search_vector_trigger
+BEFORE INSERT OR UPDATE OF title, content, tags, search_language ON posts
+FOR EACH ROW EXECUTE FUNCTION posts_search_vector_update();
+
+UPDATE posts SET search_vector =
+    setweight(to_tsvector(search_language, COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector(search_language, COALESCE(content, '')), 'B') ||
+    setweight(to_tsvector(search_language, COALESCE(array_to_string(tags, ' '), '')), 'C');
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
@@ -0,0 +1,13 @@
+ALTER TABLE comments
+DROP COLUMN IF EXISTS hidden_at;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS hidden_at;
+
+DROP TABLE IF EXISTS user_suspensions;
+
+DROP TABLE IF EXISTS moderation_actions;
+
+DROP TABLE IF EXISTS reports;
+
+DROP TABLE IF EXISTS moderation_cases;
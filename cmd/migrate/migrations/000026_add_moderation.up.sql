@@ -0,0 +1,79 @@
+CREATE TABLE IF NOT EXISTS moderation_cases (
+    id bigserial PRIMARY KEY,
+    target_type VARCHAR(20) NOT NULL,
+    target_id bigint NOT NULL,
+    target_user_id bigint NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    report_count INT NOT NULL DEFAULT 0,
+    assignee_id bigint,
+    claimed_at timestamp(0) with time zone,
+    resolution VARCHAR(20),
+    resolution_note VARCHAR(500) NOT NULL DEFAULT '',
+    resolved_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT moderation_cases_target_type_check CHECK (target_type IN ('post', 'comment', 'user')),
+    CONSTRAINT moderation_cases_status_check CHECK (status IN ('open', 'claimed', 'resolved')),
+    CONSTRAINT moderation_cases_resolution_check CHECK (resolution IN ('dismiss', 'hide', 'delete', 'warn', 'suspend')),
+    FOREIGN KEY (target_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (assignee_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+-- one unresolved case per target gathers all of its reports
+CREATE UNIQUE INDEX IF NOT EXISTS idx_moderation_cases_unresolved_target
+ON moderation_cases (target_type, target_id) WHERE status <> 'resolved';
+
+CREATE INDEX IF NOT EXISTS idx_moderation_cases_status ON moderation_cases (status, report_count DESC, created_at);
+
+CREATE TABLE IF NOT EXISTS reports (
+    id bigserial PRIMARY KEY,
+    case_id bigint NOT NULL,
+    reporter_id bigint NOT NULL,
+    reason VARCHAR(30) NOT NULL,
+    details VARCHAR(500) NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    UNIQUE (reporter_id, case_id),
+    FOREIGN KEY (case_id) REFERENCES moderation_cases (id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_case_id ON reports (case_id);
+
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id bigserial PRIMARY KEY,
+    case_id bigint NOT NULL,
+    moderator_id bigint,
+    action VARCHAR(20) NOT NULL,
+    note VARCHAR(500) NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (case_id) REFERENCES moderation_cases (id) ON DELETE CASCADE,
+    FOREIGN KEY (moderator_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_case_id ON moderation_actions (case_id, created_at);
+
+CREATE TABLE IF NOT EXISTS user_suspensions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    case_id bigint,
+    moderator_id bigint,
+    reason VARCHAR(500) NOT NULL,
+    ends_at timestamp(0) with time zone,
+    lifted_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (case_id) REFERENCES moderation_cases (id) ON DELETE SET NULL,
+    FOREIGN KEY (moderator_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_suspensions_user_id ON user_suspensions (user_id, created_at DESC);
+
+ALTER TABLE posts
+ADD COLUMN hidden_at timestamp(0) with time zone;
+
+ALTER TABLE comments
+ADD COLUMN hidden_at timestamp(0) with time zone;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_user_suspensions_active;
+
+ALTER TABLE user_suspensions
+DROP COLUMN IF EXISTS appealed_at,
+DROP COLUMN IF EXISTS appeal_note,
+DROP COLUMN IF EXISTS lifted_by;
@@ -0,0 +1,6 @@
+ALTER TABLE user_suspensions
+ADD COLUMN lifted_by bigint REFERENCES users (id) ON DELETE SET NULL,
+ADD COLUMN appeal_note VARCHAR(2000),
+ADD COLUMN appealed_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_user_suspensions_active ON user_suspensions (user_id) WHERE lifted_at IS NULL;
@@ -0,0 +1,19 @@
+DELETE FROM comments WHERE deleted_at IS NOT NULL;
+
+DELETE FROM posts WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_posts_user_repost;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_user_repost ON posts (user_id, repost_of_id) WHERE repost_of_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_comments_deleted_at;
+
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS deleted_by,
+DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS deleted_by,
+DROP COLUMN IF EXISTS deleted_at;
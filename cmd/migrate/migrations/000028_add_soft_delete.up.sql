@@ -0,0 +1,16 @@
+ALTER TABLE posts
+ADD COLUMN deleted_at timestamp(0) with time zone,
+ADD COLUMN deleted_by bigint REFERENCES users (id) ON DELETE SET NULL;
+
+ALTER TABLE comments
+ADD COLUMN deleted_at timestamp(0) with time zone,
+ADD COLUMN deleted_by bigint REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- a deleted repost must not keep the user from reposting again
+DROP INDEX IF EXISTS idx_posts_user_repost;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_user_repost ON posts (user_id, repost_of_id) WHERE repost_of_id IS NOT NULL AND deleted_at IS NULL;
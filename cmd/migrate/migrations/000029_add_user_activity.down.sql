@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_comments_created_at;
+
+DROP INDEX IF EXISTS idx_posts_created_at;
+
+DROP INDEX IF EXISTS idx_users_activated_at;
+
+DROP INDEX IF EXISTS idx_users_created_at;
+
+DROP TABLE IF EXISTS user_activity;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS activated_at;
@@ -0,0 +1,20 @@
+ALTER TABLE users
+ADD COLUMN activated_at timestamp(0) with time zone;
+
+UPDATE users SET activated_at = created_at WHERE is_active = true;
+
+CREATE TABLE IF NOT EXISTS user_activity (
+    day date NOT NULL,
+    user_id bigint NOT NULL,
+
+    PRIMARY KEY (day, user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at);
+
+CREATE INDEX IF NOT EXISTS idx_users_activated_at ON users (activated_at) WHERE activated_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at);
+
+CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments (created_at);
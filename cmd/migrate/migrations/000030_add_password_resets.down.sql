@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_users_email_trgm;
+
+DROP INDEX IF EXISTS idx_users_username_trgm;
+
+DROP TABLE IF EXISTS password_resets;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS password_changed_at;
@@ -0,0 +1,16 @@
+ALTER TABLE users
+ADD COLUMN password_changed_at timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops);
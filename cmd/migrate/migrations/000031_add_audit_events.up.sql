@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    -- no foreign keys: events outlive the users they mention
+    actor_id bigint,
+    impersonator_id bigint,
+    action varchar(100) NOT NULL,
+    target_type varchar(50) NOT NULL DEFAULT '',
+    target_id varchar(255) NOT NULL DEFAULT '',
+    ip varchar(64) NOT NULL DEFAULT '',
+    request_id varchar(255) NOT NULL DEFAULT '',
+    -- json keeps the exact text that was hashed, jsonb would not
+    before json,
+    after json,
+    created_at timestamp(6) with time zone NOT NULL,
+    prev_hash varchar(64) NOT NULL,
+    hash varchar(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_change
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    type varchar(20) NOT NULL,
+    actor_id bigint NOT NULL,
+    post_id bigint,
+    comment_id bigint,
+    -- notifications of the same type and group key are shown together
+    group_key varchar(50) NOT NULL,
+    read_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE,
+    UNIQUE (user_id, type, actor_id, group_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications (user_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id bigint NOT NULL,
+    type varchar(20) NOT NULL,
+    enabled boolean NOT NULL,
+
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_followers_user_created;
+
+DROP TABLE IF EXISTS digest_subscriptions;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+    user_id bigint PRIMARY KEY,
+    frequency varchar(10) NOT NULL,
+    -- the next digest covers what happened since the last one
+    last_sent_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT chk_digest_subscriptions_frequency CHECK (frequency IN ('daily', 'weekly'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_digest_subscriptions_due ON digest_subscriptions (frequency, last_sent_at);
+
+CREATE INDEX IF NOT EXISTS idx_followers_user_created ON followers (user_id, created_at);
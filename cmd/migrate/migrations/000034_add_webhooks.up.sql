@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    url text NOT NULL,
+    secret varchar(64) NOT NULL,
+    events varchar(50)[] NOT NULL,
+    -- endpoints of admins may receive the events of every user
+    all_users boolean NOT NULL DEFAULT false,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_user_id ON webhook_endpoints (user_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    endpoint_id bigint NOT NULL,
+    event_id varchar(64) NOT NULL,
+    event_type varchar(50) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone DEFAULT NOW(),
+    response_status int,
+    last_error text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    delivered_at timestamp(0) with time zone,
+
+    FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints (id) ON DELETE CASCADE,
+    UNIQUE (endpoint_id, event_id),
+    CONSTRAINT chk_webhook_deliveries_status CHECK (status IN ('pending', 'succeeded', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries (endpoint_id, created_at DESC);
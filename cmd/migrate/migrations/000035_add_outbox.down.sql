@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS outbox_consumptions;
+
+DROP TABLE IF EXISTS outbox_events;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id bigserial PRIMARY KEY,
+    -- handed to consumers so they can recognize redeliveries
+    idempotency_key varchar(64) NOT NULL UNIQUE,
+    type varchar(50) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    available_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_error text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    processed_at timestamp(0) with time zone,
+
+    CONSTRAINT chk_outbox_events_status CHECK (status IN ('pending', 'done', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_due ON outbox_events (available_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_processed_at ON outbox_events (processed_at) WHERE status <> 'pending';
+
+-- consumers that already handled an event are skipped when it is retried
+CREATE TABLE IF NOT EXISTS outbox_consumptions (
+    idempotency_key varchar(64) NOT NULL,
+    consumer varchar(50) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (idempotency_key, consumer),
+    FOREIGN KEY (idempotency_key) REFERENCES outbox_events (idempotency_key) ON DELETE CASCADE
+);
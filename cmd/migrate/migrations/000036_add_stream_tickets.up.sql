@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS stream_tickets (
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_tickets_expiry ON stream_tickets (expiry);
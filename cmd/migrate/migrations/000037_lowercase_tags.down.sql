@@ -0,0 +1 @@
+-- the original case of tags is not kept
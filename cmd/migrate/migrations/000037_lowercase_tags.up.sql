@@ -0,0 +1,19 @@
+-- tags are matched exactly, so the ones stored before they were lowercased
+-- are folded, keeping the first of those differing only in case
+UPDATE posts SET tags = ARRAY(
+    SELECT t.tag FROM (
+        SELECT lower(tag) AS tag, min(position) AS position
+        FROM unnest(posts.tags) WITH ORDINALITY AS u (tag, position)
+        GROUP BY lower(tag)
+    ) t
+    ORDER BY t.position
+)::varchar(100)[]
+WHERE array_to_string(tags, ' ') <> lower(array_to_string(tags, ' '));
+
+INSERT INTO tag_follows (user_id, tag, created_at)
+SELECT user_id, lower(tag), min(created_at) FROM tag_follows
+WHERE tag <> lower(tag)
+GROUP BY user_id, lower(tag)
+ON CONFLICT (user_id, tag) DO NOTHING;
+
+DELETE FROM tag_follows WHERE tag <> lower(tag);
@@ -0,0 +1,157 @@
+// Package audit records security relevant actions in an append-only log.
+// Each event is chained to the previous one by hash, so editing or removing
+// an event breaks the chain from that event on.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// Event is one action in the log. Before and After hold the state of the
+// target around the action as JSON objects, when it had one.
+type Event struct {
+	ID             int64           `json:"id"`
+	ActorID        *int64          `json:"actor_id"`
+	ImpersonatorID *int64          `json:"impersonator_id,omitempty"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type"`
+	TargetID       string          `json:"target_id"`
+	IP             string          `json:"ip"`
+	RequestID      string          `json:"request_id"`
+	Before         json.RawMessage `json:"before,omitempty"`
+	After          json.RawMessage `json:"after,omitempty"`
+	Diff           []Change        `json:"diff,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	PrevHash       string          `json:"prev_hash"`
+	Hash           string          `json:"hash"`
+}
+
+// Change is a field whose value differs between Before and After.
+type Change struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// Store appends events to the log and reads them back.
+type Store interface {
+	Append(context.Context, *Event) error
+	List(context.Context, Query) ([]Event, error)
+	Verify(context.Context) (VerifyResult, error)
+}
+
+// VerifyResult tells whether the chain is intact. When it is not, BrokenAt
+// is the first event that does not match its hash or its predecessor.
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Checked  int64  `json:"checked"`
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// JSON marshals a before or after state, returning nil for nil values or
+// values that cannot be marshaled.
+func JSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	return b
+}
+
+// Hash computes the hash of the event chained to prevHash. Every field but
+// ID, Diff and Hash itself is covered.
+func Hash(prevHash string, e *Event) string {
+	hashed := struct {
+		PrevHash       string          `json:"prev_hash"`
+		ActorID        *int64          `json:"actor_id"`
+		ImpersonatorID *int64          `json:"impersonator_id"`
+		Action         string          `json:"action"`
+		TargetType     string          `json:"target_type"`
+		TargetID       string          `json:"target_id"`
+		IP             string          `json:"ip"`
+		RequestID      string          `json:"request_id"`
+		Before         json.RawMessage `json:"before"`
+		After          json.RawMessage `json:"after"`
+		CreatedAt      string          `json:"created_at"`
+	}{
+		PrevHash:       prevHash,
+		ActorID:        e.ActorID,
+		ImpersonatorID: e.ImpersonatorID,
+		Action:         e.Action,
+		TargetType:     e.TargetType,
+		TargetID:       e.TargetID,
+		IP:             e.IP,
+		RequestID:      e.RequestID,
+		Before:         compact(e.Before),
+		After:          compact(e.After),
+		CreatedAt:      e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	// the struct only holds values json can encode
+	b, _ := json.Marshal(hashed)
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func compact(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+
+	return buf.Bytes()
+}
+
+// Diff lists the top level fields that differ between two JSON objects,
+// sorted by name. A field missing on one side is reported with a nil value.
+func Diff(before, after json.RawMessage) []Change {
+	var b, a map[string]any
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &b); err != nil {
+			return nil
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &a); err != nil {
+			return nil
+		}
+	}
+
+	var fields []string
+	for f := range b {
+		fields = append(fields, f)
+	}
+	for f := range a {
+		if _, ok := b[f]; !ok {
+			fields = append(fields, f)
+		}
+	}
+	slices.Sort(fields)
+
+	var changes []Change
+	for _, f := range fields {
+		if !reflect.DeepEqual(b[f], a[f]) {
+			changes = append(changes, Change{Field: f, Before: b[f], After: a[f]})
+		}
+	}
+
+	return changes
+}
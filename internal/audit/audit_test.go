@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHashChain(t *testing.T) {
+	actor := int64(7)
+	created := time.Date(2025, 3, 1, 12, 0, 0, 123456000, time.UTC)
+
+	first := &Event{ActorID: &actor, Action: "user.role", TargetType: "user", TargetID: "9",
+		Before: json.RawMessage(`{"role": "user"}`), After: json.RawMessage(`{"role":"moderator"}`), CreatedAt: created}
+	first.Hash = Hash("", first)
+
+	second := &Event{Action: "auth.login", TargetType: "user", TargetID: "9", CreatedAt: created.Add(time.Second)}
+	second.PrevHash = first.Hash
+	second.Hash = Hash(first.Hash, second)
+
+	if len(first.Hash) != 64 || first.Hash == second.Hash {
+		t.Fatalf("unexpected hashes %q and %q", first.Hash, second.Hash)
+	}
+
+	// reformatted JSON and another time zone are the same event
+	same := *first
+	same.Before = json.RawMessage(`{"role":"user"}`)
+	same.CreatedAt = created.In(time.FixedZone("UTC-3", -3*60*60))
+	if got := Hash("", &same); got != first.Hash {
+		t.Errorf("Hash of the same event = %q, want %q", got, first.Hash)
+	}
+
+	tampered := *first
+	tampered.After = json.RawMessage(`{"role":"admin"}`)
+	if Hash("", &tampered) == first.Hash {
+		t.Error("tampered event kept its hash")
+	}
+
+	if Hash("other", second) == second.Hash {
+		t.Error("hash does not depend on the previous hash")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		before, after string
+		want          []Change
+	}{
+		{`{"role":"user","active":true}`, `{"role":"admin","active":true}`,
+			[]Change{{Field: "role", Before: "user", After: "admin"}}},
+		{``, `{"hidden":true}`,
+			[]Change{{Field: "hidden", Before: nil, After: true}}},
+		{`{"b":1,"a":{"x":1}}`, `{"a":{"x":2}}`,
+			[]Change{{Field: "a", Before: map[string]any{"x": 1.0}, After: map[string]any{"x": 2.0}}, {Field: "b", Before: 1.0, After: nil}}},
+		{`{"a":1}`, `{"a":1}`, nil},
+		{`[1]`, `{"a":1}`, nil},
+	}
+
+	for _, tt := range tests {
+		got := Diff(json.RawMessage(tt.before), json.RawMessage(tt.after))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Diff(%s, %s) = %v, want %v", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package audit
+
+import "context"
+
+type MockStore struct {
+}
+
+func NewMockStore() *MockStore {
+	return &MockStore{}
+}
+
+func (s *MockStore) Append(context.Context, *Event) error {
+	return nil
+}
+
+func (s *MockStore) List(context.Context, Query) ([]Event, error) {
+	return []Event{}, nil
+}
+
+func (s *MockStore) Verify(context.Context) (VerifyResult, error) {
+	return VerifyResult{Valid: true}, nil
+}
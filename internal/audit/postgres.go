@@ -0,0 +1,307 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	queryTimeout = time.Second * 5
+	// chainLockKey is the advisory lock serializing appends, so that every
+	// event is chained to the one inserted right before it.
+	chainLockKey = 0x61756469
+	// verifyBatchSize bounds how many events one verification query reads.
+	verifyBatchSize = 1000
+)
+
+// Query filters the events listed to admins. Unset filters match every
+// event; To includes the whole day.
+type Query struct {
+	ActorID    *int64     `json:"actor_id"`
+	Action     string     `json:"action" validate:"max=100"`
+	TargetType string     `json:"target_type" validate:"max=50"`
+	TargetID   string     `json:"target_id" validate:"max=255"`
+	From       *time.Time `json:"from"`
+	To         *time.Time `json:"to"`
+	Limit      int        `json:"limit" validate:"gte=1,lte=100"`
+	Offset     int        `json:"offset" validate:"gte=0"`
+}
+
+func (q Query) Parse(r *http.Request) (Query, error) {
+	qs := r.URL.Query()
+
+	if v := qs.Get("actor_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return q, err
+		}
+
+		q.ActorID = &id
+	}
+
+	q.Action = qs.Get("action")
+	q.TargetType = qs.Get("target_type")
+	q.TargetID = qs.Get("target_id")
+
+	for name, dest := range map[string]**time.Time{"from": &q.From, "to": &q.To} {
+		if v := qs.Get(name); v != "" {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				return q, err
+			}
+
+			*dest = &t
+		}
+	}
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+
+		q.Offset = o
+	}
+
+	return q, nil
+}
+
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Append chains the event to the last one of the log and inserts it,
+// filling its ID, CreatedAt, PrevHash and Hash.
+func (s *PostgresStore) Append(ctx context.Context, e *Event) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, chainLockKey); err != nil {
+		return err
+	}
+
+	var prevHash string
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	e.Before = compact(e.Before)
+	e.After = compact(e.After)
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	e.PrevHash = prevHash
+	e.Hash = Hash(prevHash, e)
+
+	query := `
+		INSERT INTO audit_events (actor_id, impersonator_id, action, target_type, target_id,
+		ip, request_id, before, after, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id
+	`
+
+	if err := tx.QueryRowContext(
+		ctx,
+		query,
+		e.ActorID,
+		e.ImpersonatorID,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.IP,
+		e.RequestID,
+		nullJSON(e.Before),
+		nullJSON(e.After),
+		e.CreatedAt,
+		e.PrevHash,
+		e.Hash,
+	).Scan(&e.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// List fetches the events matching the query, newest first, with the diff
+// of their before and after states.
+func (s *PostgresStore) List(ctx context.Context, q Query) ([]Event, error) {
+	query := `
+		SELECT ` + eventColumns + `
+		FROM audit_events
+		WHERE ($1::bigint IS NULL OR actor_id = $1 OR impersonator_id = $1)
+		AND ($2 = '' OR action = $2)
+		AND ($3 = '' OR target_type = $3)
+		AND ($4 = '' OR target_id = $4)
+		AND ($5::date IS NULL OR created_at >= $5::date AT TIME ZONE 'UTC')
+		AND ($6::date IS NULL OR created_at < ($6::date + 1) AT TIME ZONE 'UTC')
+		ORDER BY id DESC
+		LIMIT $7 OFFSET $8
+	`
+
+	var from, to *string
+	if q.From != nil {
+		d := q.From.Format(time.DateOnly)
+		from = &d
+	}
+	if q.To != nil {
+		d := q.To.Format(time.DateOnly)
+		to = &d
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.ActorID, q.Action, q.TargetType, q.TargetID, from, to, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Diff = Diff(e.Before, e.After)
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// Verify walks the whole chain in order, recomputing every hash.
+func (s *PostgresStore) Verify(ctx context.Context) (VerifyResult, error) {
+	var (
+		result   VerifyResult
+		lastID   int64
+		prevHash string
+	)
+
+	for {
+		events, err := s.batchAfter(ctx, lastID)
+		if err != nil {
+			return VerifyResult{}, err
+		}
+
+		for _, e := range events {
+			result.Checked++
+
+			reason := ""
+			switch {
+			case e.PrevHash != prevHash:
+				reason = "previous hash does not match the preceding event"
+			case Hash(e.PrevHash, &e) != e.Hash:
+				reason = "hash does not match the event"
+			}
+
+			if reason != "" {
+				result.BrokenAt = &e.ID
+				result.Reason = reason
+				return result, nil
+			}
+
+			prevHash = e.Hash
+			lastID = e.ID
+		}
+
+		if len(events) < verifyBatchSize {
+			result.Valid = true
+			return result, nil
+		}
+	}
+}
+
+func (s *PostgresStore) batchAfter(ctx context.Context, afterID int64) ([]Event, error) {
+	query := `
+		SELECT ` + eventColumns + `
+		FROM audit_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, afterID, verifyBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+const eventColumns = `id, actor_id, impersonator_id, action, target_type, target_id,
+	ip, request_id, before, after, created_at, prev_hash, hash`
+
+func scanEvent(rows *sql.Rows) (Event, error) {
+	var e Event
+	var before, after []byte
+	if err := rows.Scan(
+		&e.ID,
+		&e.ActorID,
+		&e.ImpersonatorID,
+		&e.Action,
+		&e.TargetType,
+		&e.TargetID,
+		&e.IP,
+		&e.RequestID,
+		&before,
+		&after,
+		&e.CreatedAt,
+		&e.PrevHash,
+		&e.Hash,
+	); err != nil {
+		return Event{}, err
+	}
+
+	e.Before = before
+	e.After = after
+	e.CreatedAt = e.CreatedAt.UTC()
+
+	return e, nil
+}
+
+func nullJSON(raw []byte) any {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	return string(raw)
+}
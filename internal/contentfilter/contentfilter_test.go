@@ -0,0 +1,224 @@
+package contentfilter
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+type fakeHistory []string
+
+func (h fakeHistory) GetRecentByAuthor(ctx context.Context, authorID int64, since time.Time, excludeType string, excludeID int64) ([]string, error) {
+	return h, nil
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, World!", []string{"hello", "world"}},
+		{"sp4m and $pam", []string{"spam", "and", "pam"}},
+		{"ѕраm", []string{"spam"}},
+		{"ＳＰＡＭ", []string{"spam"}},
+		{"s.p.a.m now", []string{"spam", "now"}},
+		{"spaaaam!!!", []string{"spam"}},
+		{"call 555 1234", []string{"call"}},
+		{"sooo cool", []string{"so", "cool"}},
+	}
+
+	for _, tt := range tests {
+		if got := Words(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Words(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWordList(t *testing.T) {
+	wl := NewWordList(Reject, []string{"spam", "buy now"})
+	ctx := context.Background()
+
+	tests := []struct {
+		text string
+		want Verdict
+	}{
+		{"this is sp@m", Reject},
+		{"B U Y  N O W", Reject},
+		{"please buy n0w", Reject},
+		{"spammer", Allow},
+		{"buy later, now or never", Allow},
+	}
+
+	for _, tt := range tests {
+		d, err := wl.Check(ctx, Content{Body: tt.text})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Verdict != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.text, d.Verdict, tt.want)
+		}
+	}
+}
+
+func TestWordListDoubledLetters(t *testing.T) {
+	wl := NewWordList(Reject, []string{"ass", "pass"})
+	ctx := context.Background()
+
+	tests := []struct {
+		text string
+		want Verdict
+	}{
+		{"as far as I know", Allow},
+		{"pas de deux", Allow},
+		{"a classic", Allow},
+		{"you ass", Reject},
+		{"no pass", Reject},
+		{"p a s s", Reject},
+	}
+
+	for _, tt := range tests {
+		d, err := wl.Check(ctx, Content{Body: tt.text})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Verdict != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.text, d.Verdict, tt.want)
+		}
+	}
+}
+
+func TestDomainDenyList(t *testing.T) {
+	dl := NewDomainDenyList([]string{"bad.example", " Evil.Test "})
+	ctx := context.Background()
+
+	tests := []struct {
+		text string
+		want Verdict
+	}{
+		{"see https://bad.example/path", Reject},
+		{"see http://sub.EVIL.test", Reject},
+		{"see www.bad.example", Reject},
+		{"see https://notbad.example", Allow},
+		{"bad.example without scheme, e.g. this", Allow},
+	}
+
+	for _, tt := range tests {
+		d, err := dl.Check(ctx, Content{Body: tt.text})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Verdict != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.text, d.Verdict, tt.want)
+		}
+	}
+}
+
+func TestLinkDensity(t *testing.T) {
+	ld := LinkDensity{MaxLinks: 2, MaxRatio: 0.5}
+	ctx := context.Background()
+
+	tests := []struct {
+		text string
+		want Verdict
+	}{
+		{"a long enough post about gophers with one link https://go.dev", Allow},
+		{"https://a.test https://b.test https://c.test", Hold},
+		{"look https://example.test/a/very/long/path", Hold},
+	}
+
+	for _, tt := range tests {
+		d, err := ld.Check(ctx, Content{Body: tt.text})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Verdict != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.text, d.Verdict, tt.want)
+		}
+	}
+}
+
+func TestRepeatedContent(t *testing.T) {
+	rc := RepeatedContent{
+		History:    fakeHistory{"Check my channel!", "check   my CHANNEL", "something else"},
+		Window:     time.Hour,
+		MaxRepeats: 2,
+	}
+
+	d, err := rc.Check(context.Background(), Content{Body: "check my channel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Verdict != Hold {
+		t.Errorf("got %s, want hold", d.Verdict)
+	}
+
+	d, err = rc.Check(context.Background(), Content{Body: "something else"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Verdict != Allow {
+		t.Errorf("got %s, want allow", d.Verdict)
+	}
+}
+
+func TestNewAccountVelocity(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := NewAccountVelocity{
+		History:      fakeHistory{"a", "b", "c"},
+		AccountAge:   24 * time.Hour,
+		Window:       time.Hour,
+		MaxPerWindow: 3,
+		now:          func() time.Time { return now },
+	}
+
+	d, err := v.Check(context.Background(), Content{AuthorCreatedAt: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Verdict != Hold {
+		t.Errorf("new account: got %s, want hold", d.Verdict)
+	}
+
+	d, err = v.Check(context.Background(), Content{AuthorCreatedAt: now.Add(-48 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Verdict != Allow {
+		t.Errorf("old account: got %s, want allow", d.Verdict)
+	}
+}
+
+func TestChain(t *testing.T) {
+	hold := FilterFunc(func(ctx context.Context, c Content) (Decision, error) {
+		return Decision{Verdict: Hold, Reason: "held"}, nil
+	})
+	reject := FilterFunc(func(ctx context.Context, c Content) (Decision, error) {
+		return Decision{Verdict: Reject, Reason: "rejected"}, nil
+	})
+
+	res, err := NewChain(hold, hold).Check(context.Background(), Content{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Verdict != Hold || res.Reason() != "held; held" {
+		t.Errorf("got %s %q, want hold with both reasons", res.Verdict, res.Reason())
+	}
+
+	res, err = NewChain(hold, reject, hold).Check(context.Background(), Content{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Verdict != Reject || res.Reason() != "rejected" {
+		t.Errorf("got %s %q, want reject", res.Verdict, res.Reason())
+	}
+
+	var nilChain *Chain
+	if res, _ := nilChain.Check(context.Background(), Content{}); res.Verdict != Allow {
+		t.Errorf("nil chain: got %s, want allow", res.Verdict)
+	}
+}
@@ -0,0 +1,124 @@
+package contentfilter
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Verdict is the outcome of filtering content. Verdicts are ordered by
+// severity, so the verdict of a chain is the highest of its filters.
+type Verdict int
+
+const (
+	// Allow stores and publishes the content.
+	Allow Verdict = iota
+	// Hold stores the content hidden until a moderator reviews it.
+	Hold
+	// Reject refuses to store the content.
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Hold:
+		return "hold"
+	case Reject:
+		return "reject"
+	default:
+		return "allow"
+	}
+}
+
+// Content is a post or comment about to be stored, with what filters need
+// to know about its author.
+type Content struct {
+	AuthorID        int64
+	AuthorCreatedAt time.Time
+	Title           string
+	Body            string
+	// EditedType and EditedID identify the stored post or comment the
+	// content replaces, which is left out of the author's history. They
+	// are empty for new content.
+	EditedType string
+	EditedID   int64
+}
+
+// Text is the title and body of the content as one string.
+func (c Content) Text() string {
+	if c.Title == "" {
+		return c.Body
+	}
+
+	return c.Title + "\n" + c.Body
+}
+
+// Decision is the verdict of one filter with the reason behind it, which is
+// shown to the author on rejection and to moderators on hold.
+type Decision struct {
+	Verdict Verdict
+	Reason  string
+}
+
+// Filter decides on a piece of content. Filters with nothing to say return
+// an Allow decision.
+type Filter interface {
+	Check(ctx context.Context, c Content) (Decision, error)
+}
+
+// FilterFunc adapts a function to the Filter interface.
+type FilterFunc func(ctx context.Context, c Content) (Decision, error)
+
+func (f FilterFunc) Check(ctx context.Context, c Content) (Decision, error) {
+	return f(ctx, c)
+}
+
+// Result is the combined outcome of a chain.
+type Result struct {
+	Verdict Verdict
+	Reasons []string
+}
+
+// Reason joins the reasons of the result.
+func (r Result) Reason() string {
+	return strings.Join(r.Reasons, "; ")
+}
+
+// Chain runs filters in order. It stops at the first rejection, since
+// nothing can change that outcome, and otherwise gathers the reasons of
+// every filter that held the content.
+type Chain struct {
+	filters []Filter
+}
+
+func NewChain(filters ...Filter) *Chain {
+	return &Chain{filters: filters}
+}
+
+// Check runs the content through the chain. A nil chain allows everything.
+func (ch *Chain) Check(ctx context.Context, c Content) (Result, error) {
+	result := Result{Verdict: Allow}
+	if ch == nil {
+		return result, nil
+	}
+
+	for _, f := range ch.filters {
+		d, err := f.Check(ctx, c)
+		if err != nil {
+			return Result{}, err
+		}
+
+		if d.Verdict == Allow {
+			continue
+		}
+
+		if d.Verdict == Reject {
+			return Result{Verdict: Reject, Reasons: []string{d.Reason}}, nil
+		}
+
+		result.Verdict = max(result.Verdict, d.Verdict)
+		result.Reasons = append(result.Reasons, d.Reason)
+	}
+
+	return result, nil
+}
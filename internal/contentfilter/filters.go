@@ -0,0 +1,244 @@
+package contentfilter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// WordList rejects or holds content containing listed words or phrases. The
+// terms and the content are compared after normalization, so "sp4m",
+// "ѕpam" and "s.p.a.m" all match "spam". Terms keep their repeated letters,
+// so "ass" does not match "as".
+type WordList struct {
+	verdict Verdict
+	terms   [][]string
+}
+
+// NewWordList builds a word list with the verdict given to matching
+// content. Empty terms are ignored.
+func NewWordList(verdict Verdict, terms []string) *WordList {
+	wl := &WordList{verdict: verdict}
+	for _, t := range terms {
+		if words := splitWords(t); len(words) > 0 {
+			wl.terms = append(wl.terms, words)
+		}
+	}
+
+	return wl
+}
+
+func (wl *WordList) Check(ctx context.Context, c Content) (Decision, error) {
+	words := Words(c.Text())
+
+	for _, term := range wl.terms {
+		if containsPhrase(words, term) {
+			return Decision{
+				Verdict: wl.verdict,
+				Reason:  fmt.Sprintf("contains the blocked term %q", strings.Join(term, " ")),
+			}, nil
+		}
+	}
+
+	return Decision{Verdict: Allow}, nil
+}
+
+// containsPhrase reports whether phrase appears in words, either as
+// consecutive words or spelled out as one.
+func containsPhrase(words, phrase []string) bool {
+	joined := strings.Join(phrase, "")
+
+	for i := range words {
+		if words[i] == joined {
+			return true
+		}
+
+		if i+len(phrase) > len(words) {
+			continue
+		}
+
+		match := true
+		for j, p := range phrase {
+			if words[i+j] != p {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+`)
+
+// Links returns the links found in text. Only links with a scheme or a www.
+// prefix count, so abbreviations like "e.g." are not mistaken for domains.
+func Links(text string) []string {
+	return linkPattern.FindAllString(text, -1)
+}
+
+// linkHost returns the lowercased host of a link found by Links.
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// DomainDenyList rejects content linking to denied domains or their
+// subdomains.
+type DomainDenyList struct {
+	domains []string
+}
+
+func NewDomainDenyList(domains []string) *DomainDenyList {
+	dl := &DomainDenyList{}
+	for _, d := range domains {
+		d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), ".")
+		if d != "" {
+			dl.domains = append(dl.domains, d)
+		}
+	}
+
+	return dl
+}
+
+func (dl *DomainDenyList) Check(ctx context.Context, c Content) (Decision, error) {
+	for _, link := range Links(c.Text()) {
+		host := linkHost(link)
+		for _, d := range dl.domains {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return Decision{
+					Verdict: Reject,
+					Reason:  fmt.Sprintf("links to the blocked domain %s", d),
+				}, nil
+			}
+		}
+	}
+
+	return Decision{Verdict: Allow}, nil
+}
+
+// LinkDensity holds content with more than MaxLinks links, or where links
+// make up more than MaxRatio of the text.
+type LinkDensity struct {
+	MaxLinks int
+	MaxRatio float64
+}
+
+func (ld LinkDensity) Check(ctx context.Context, c Content) (Decision, error) {
+	text := c.Text()
+	links := Links(text)
+	if len(links) == 0 {
+		return Decision{Verdict: Allow}, nil
+	}
+
+	if ld.MaxLinks > 0 && len(links) > ld.MaxLinks {
+		return Decision{
+			Verdict: Hold,
+			Reason:  fmt.Sprintf("has %d links, more than %d", len(links), ld.MaxLinks),
+		}, nil
+	}
+
+	linkLength := 0
+	for _, l := range links {
+		linkLength += utf8.RuneCountInString(l)
+	}
+
+	if ld.MaxRatio > 0 && float64(linkLength)/float64(utf8.RuneCountInString(text)) > ld.MaxRatio {
+		return Decision{Verdict: Hold, Reason: "is mostly links"}, nil
+	}
+
+	return Decision{Verdict: Allow}, nil
+}
+
+// History looks up what an author stored since a given time, posts and
+// comments alike, except for the post or comment being edited, if any.
+type History interface {
+	GetRecentByAuthor(ctx context.Context, authorID int64, since time.Time, excludeType string, excludeID int64) ([]string, error)
+}
+
+// RepeatedContent holds content the author already stored MaxRepeats times
+// within Window. Texts are compared normalized, so changes in case, spacing
+// or punctuation do not make a copy new.
+type RepeatedContent struct {
+	History    History
+	Window     time.Duration
+	MaxRepeats int
+	now        func() time.Time
+}
+
+func (rc RepeatedContent) Check(ctx context.Context, c Content) (Decision, error) {
+	fingerprint := Normalize(c.Body)
+	if fingerprint == "" {
+		return Decision{Verdict: Allow}, nil
+	}
+
+	recent, err := rc.History.GetRecentByAuthor(ctx, c.AuthorID, clock(rc.now)().Add(-rc.Window), c.EditedType, c.EditedID)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	repeats := 0
+	for _, text := range recent {
+		if Normalize(text) == fingerprint {
+			repeats++
+		}
+	}
+
+	if repeats >= rc.MaxRepeats {
+		return Decision{Verdict: Hold, Reason: "repeats content posted recently"}, nil
+	}
+
+	return Decision{Verdict: Allow}, nil
+}
+
+// NewAccountVelocity holds content from accounts younger than AccountAge
+// that already stored MaxPerWindow posts and comments within Window.
+type NewAccountVelocity struct {
+	History      History
+	AccountAge   time.Duration
+	Window       time.Duration
+	MaxPerWindow int
+	now          func() time.Time
+}
+
+func (v NewAccountVelocity) Check(ctx context.Context, c Content) (Decision, error) {
+	now := clock(v.now)()
+	if now.Sub(c.AuthorCreatedAt) >= v.AccountAge {
+		return Decision{Verdict: Allow}, nil
+	}
+
+	recent, err := v.History.GetRecentByAuthor(ctx, c.AuthorID, now.Add(-v.Window), c.EditedType, c.EditedID)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if len(recent) >= v.MaxPerWindow {
+		return Decision{Verdict: Hold, Reason: "new account posting too fast"}, nil
+	}
+
+	return Decision{Verdict: Allow}, nil
+}
+
+func clock(now func() time.Time) func() time.Time {
+	if now == nil {
+		return time.Now
+	}
+
+	return now
+}
@@ -0,0 +1,169 @@
+package contentfilter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// confusables maps letters that render like latin ones, mostly cyrillic and
+// greek, to the latin letter they imitate.
+var confusables = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's',
+	'і': 'i', 'ї': 'i', 'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ı': 'i',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ç': 'c', 'ñ': 'n', 'ý': 'y', 'ÿ': 'y', 'ß': 's',
+}
+
+// leet maps the digits and symbols used in leetspeak to letters. It only
+// applies inside words that have letters, so plain numbers are left alone.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// foldRune lowercases r, undoes fullwidth forms and maps confusables.
+func foldRune(r rune) rune {
+	if r >= '！' && r <= '～' {
+		r -= '！' - '!'
+	}
+
+	r = unicode.ToLower(r)
+	if c, ok := confusables[r]; ok {
+		return c
+	}
+
+	return r
+}
+
+// Words splits text into normalized words: folded to plain lowercase latin
+// letters, with leetspeak undone and letters repeated for emphasis
+// collapsed. Runs of single letters, as in "s p a m" or "s.p.a.m", are
+// joined into one word.
+func Words(text string) []string {
+	words := splitWords(text)
+	for i, w := range words {
+		words[i] = collapseRepeats(w)
+	}
+
+	return words
+}
+
+// splitWords is Words without collapsing repeated letters, for word list
+// terms, whose doubled letters are part of the word.
+func splitWords(text string) []string {
+	var (
+		words   []string
+		spelled strings.Builder
+	)
+
+	flushSpelled := func() {
+		if spelled.Len() > 0 {
+			words = append(words, spelled.String())
+			spelled.Reset()
+		}
+	}
+
+	for _, token := range tokenize(text) {
+		word := normalizeToken(token)
+		if word == "" {
+			continue
+		}
+
+		if len(word) == 1 {
+			spelled.WriteString(word)
+			continue
+		}
+
+		flushSpelled()
+		words = append(words, word)
+	}
+	flushSpelled()
+
+	return words
+}
+
+// Normalize folds a word list term the same way Words folds text.
+func Normalize(term string) string {
+	return strings.Join(Words(term), "")
+}
+
+// tokenize splits text on anything that is neither a letter, a digit nor a
+// leetspeak symbol.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		r = foldRune(r)
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+		_, isLeet := leet[r]
+
+		return !isLeet
+	})
+}
+
+// normalizeToken folds a token to letters. Leetspeak symbols at its edges
+// are taken for punctuation, as in "spam!".
+func normalizeToken(token string) string {
+	token = strings.TrimFunc(token, func(r rune) bool {
+		_, isLeet := leet[r]
+
+		return isLeet && !unicode.IsDigit(r)
+	})
+
+	hasLetter := false
+	for _, r := range token {
+		if unicode.IsLetter(foldRune(r)) {
+			hasLetter = true
+			break
+		}
+	}
+
+	if !hasLetter {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, r := range token {
+		r = foldRune(r)
+		if l, ok := leet[r]; ok {
+			r = l
+		}
+
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// collapseRepeats squeezes runs of three or more of the same letter to
+// one, so "spaaam" and "spam" compare equal. Doubled letters are kept, as
+// they are common in words and dropping them would make "pass" read "pas".
+func collapseRepeats(w string) string {
+	runes := []rune(w)
+
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+
+		if j-i >= 3 {
+			b.WriteRune(runes[i])
+		} else {
+			b.WriteString(string(runes[i:j]))
+		}
+		i = j
+	}
+
+	return b.String()
+}
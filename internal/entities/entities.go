@@ -0,0 +1,134 @@
+package entities
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	TypeMention = "mention"
+	TypeHashtag = "hashtag"
+
+	maxMentionLength = 50
+	maxHashtagLength = 100
+)
+
+// Entity is a mention or hashtag found in a text. Start and End are offsets
+// in Unicode code points, End being exclusive, and include the leading @ or
+// # sign so clients can link the exact span.
+type Entity struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Parse extracts @username mentions and #hashtags from text. A sign only
+// starts an entity at the beginning of the text or after a character that
+// cannot be part of a word, so e-mail addresses and URL fragments are left
+// alone.
+func Parse(text string) []Entity {
+	runes := []rune(text)
+	var found []Entity
+
+	for i := 0; i < len(runes); i++ {
+		sign := runes[i]
+		if sign != '@' && sign != '#' {
+			continue
+		}
+
+		if i > 0 && isWordRune(runes[i-1]) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+
+		body := runes[i+1 : end]
+		entity := Entity{Text: string(body), Start: i, End: end}
+
+		switch {
+		case sign == '@' && validMention(body):
+			entity.Type = TypeMention
+		case sign == '#' && validHashtag(body):
+			entity.Type = TypeHashtag
+		default:
+			continue
+		}
+
+		found = append(found, entity)
+		i = end - 1
+	}
+
+	return found
+}
+
+// Mentions returns the lowercased usernames mentioned in entities, without
+// duplicates.
+func Mentions(found []Entity) []string {
+	return collect(found, TypeMention)
+}
+
+// Hashtags returns the lowercased hashtags in entities, without duplicates.
+func Hashtags(found []Entity) []string {
+	return collect(found, TypeHashtag)
+}
+
+// MergeTags lowercases tags and adds the hashtags, without duplicates.
+func MergeTags(tags, hashtags []string) []string {
+	merged := make([]string, 0, len(tags)+len(hashtags))
+	for _, tag := range slices.Concat(tags, hashtags) {
+		tag = strings.ToLower(tag)
+		if !slices.Contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+
+	return merged
+}
+
+func collect(found []Entity, kind string) []string {
+	values := make([]string, 0)
+	for _, e := range found {
+		if e.Type != kind {
+			continue
+		}
+
+		value := strings.ToLower(e.Text)
+		if !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func validMention(body []rune) bool {
+	if len(body) == 0 || len(body) > maxMentionLength {
+		return false
+	}
+
+	for _, r := range body {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validHashtag rejects empty and all-digit tags such as "#1".
+func validHashtag(body []rune) bool {
+	if len(body) == 0 || len(body) > maxHashtagLength {
+		return false
+	}
+
+	return slices.ContainsFunc(body, func(r rune) bool { return !unicode.IsDigit(r) })
+}
@@ -0,0 +1,69 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Entity
+	}{
+		{
+			name: "mentions and hashtags",
+			text: "hi @Gopher, check #golang!",
+			want: []Entity{
+				{Type: TypeMention, Text: "Gopher", Start: 3, End: 10},
+				{Type: TypeHashtag, Text: "golang", Start: 18, End: 25},
+			},
+		},
+		{
+			name: "offsets count code points",
+			text: "café #über @bob",
+			want: []Entity{
+				{Type: TypeHashtag, Text: "über", Start: 5, End: 10},
+				{Type: TypeMention, Text: "bob", Start: 11, End: 15},
+			},
+		},
+		{
+			name: "ignores emails and numeric tags",
+			text: "mail me at bob@example.com about #1",
+		},
+		{
+			name: "ignores lone signs",
+			text: "@ # @@ ##",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMentionsAndHashtagsAreDeduplicated(t *testing.T) {
+	found := Parse("@Bob @bob #Go #go #rust")
+
+	if got, want := Mentions(found), []string{"bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Mentions() = %v, want %v", got, want)
+	}
+
+	if got, want := Hashtags(found), []string{"go", "rust"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Hashtags() = %v, want %v", got, want)
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	got := MergeTags([]string{"Go", "WebDev", "webdev"}, []string{"go", "rust"})
+	want := []string{"go", "webdev", "rust"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeTags() = %v, want %v", got, want)
+	}
+}
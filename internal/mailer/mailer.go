@@ -3,14 +3,34 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "GopherSocial"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName                  = "GopherSocial"
+	maxRetries                = 3
+	UserWelcomeTemplate       = "user_invitation.tmpl"
+	UserMentionTemplate       = "user_mention.tmpl"
+	ModerationWarningTemplate = "moderation_warning.tmpl"
+	UserSuspendedTemplate     = "user_suspended.tmpl"
+	UserPasswordResetTemplate = "password_reset.tmpl"
+	DigestTemplate            = "digest.tmpl"
 )
 
 //go:embed "templates"
 var FS embed.FS
 
+// Header is an extra header of an email.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// ListUnsubscribe returns the headers offering one-click unsubscription
+// through url, which takes a POST request (RFC 8058).
+func ListUnsubscribe(url string) []Header {
+	return []Header{
+		{Name: "List-Unsubscribe", Value: "<" + url + ">"},
+		{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+	}
+}
+
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandbox bool) error
+	Send(templateFile, username, email string, data any, isSandbox bool, headers ...Header) error
 }
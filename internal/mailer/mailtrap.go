@@ -30,7 +30,7 @@ func NewMailTrapClient(apiKey, fromEmail string) (*mailtrapClient, error) {
 	}, nil
 }
 
-func (m *mailtrapClient) Send(templateFile, username, email string, data any, isSandbox bool) error {
+func (m *mailtrapClient) Send(templateFile, username, email string, data any, isSandbox bool, headers ...Header) error {
 	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
 	if err != nil {
 		return err
@@ -50,6 +50,9 @@ func (m *mailtrapClient) Send(templateFile, username, email string, data any, is
 	message.SetHeader("From", m.fromEmail)
 	message.SetHeader("To", email)
 	message.SetHeader("Subject", subject.String())
+	for _, h := range headers {
+		message.SetHeader(h.Name, h.Value)
+	}
 
 	message.AddAlternative("text/html", body.String())
 
@@ -27,7 +27,7 @@ func NewSendgrid(apiKey, fromEmail string) *SendGridMailer {
 	}
 }
 
-func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool, headers ...Header) error {
 	from := mail.NewEmail(FromName, m.fromEmail)
 	to := mail.NewEmail(username, email)
 
@@ -46,6 +46,9 @@ func (m *SendGridMailer) Send(templateFile, username, email string, data any, is
 		return err
 	}
 	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
+	for _, h := range headers {
+		message.SetHeader(h.Name, h.Value)
+	}
 
 	message.SetMailSettings(&mail.MailSettings{
 		SandboxMode: &mail.Setting{
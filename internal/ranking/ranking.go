@@ -0,0 +1,152 @@
+package ranking
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// Candidate is a post considered for the ranked feed, reduced to the
+// signals scorers look at.
+type Candidate struct {
+	PostID      int64
+	AuthorID    int64
+	PublishedAt time.Time
+	Reactions   int64
+	Comments    int64
+	// Affinity counts the viewer's recent interactions with the author.
+	Affinity int64
+}
+
+// Scorer rates a candidate at the given time. Scores of the different
+// scorers are combined by the Ranker, so each should stay in a comparable
+// range, roughly 0 to 1 for an average post.
+type Scorer interface {
+	Score(c Candidate, now time.Time) float64
+}
+
+// ScorerFunc adapts a function to the Scorer interface.
+type ScorerFunc func(c Candidate, now time.Time) float64
+
+func (f ScorerFunc) Score(c Candidate, now time.Time) float64 {
+	return f(c, now)
+}
+
+// Weighted pairs a scorer with the weight of its score in the total.
+type Weighted struct {
+	Scorer Scorer
+	Weight float64
+}
+
+// Scored is a candidate with its total score.
+type Scored struct {
+	Candidate
+	Score float64
+}
+
+// Ranker orders candidates by the weighted sum of its scorers.
+type Ranker struct {
+	scorers []Weighted
+	now     func() time.Time
+}
+
+func New(scorers ...Weighted) *Ranker {
+	return &Ranker{
+		scorers: scorers,
+		now:     time.Now,
+	}
+}
+
+// WithClock returns a copy of the ranker reading the time from now, which
+// keeps rankings reproducible in tests.
+func (r *Ranker) WithClock(now func() time.Time) *Ranker {
+	return &Ranker{
+		scorers: r.scorers,
+		now:     now,
+	}
+}
+
+// Rank scores the candidates and returns them best first. Ties go to the
+// newest post so the order is deterministic.
+func (r *Ranker) Rank(candidates []Candidate) []Scored {
+	now := r.now()
+
+	scored := make([]Scored, len(candidates))
+	for i, c := range candidates {
+		scored[i] = Scored{Candidate: c, Score: r.score(c, now)}
+	}
+
+	slices.SortStableFunc(scored, func(a, b Scored) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if c := b.PublishedAt.Compare(a.PublishedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.PostID, a.PostID)
+	})
+
+	return scored
+}
+
+func (r *Ranker) score(c Candidate, now time.Time) float64 {
+	var total float64
+	for _, s := range r.scorers {
+		total += s.Weight * s.Scorer.Score(c, now)
+	}
+
+	return total
+}
+
+// RecencyDecay halves the score of a post every HalfLife. Posts dated in
+// the future score as if they were just published.
+type RecencyDecay struct {
+	HalfLife time.Duration
+}
+
+func (d RecencyDecay) Score(c Candidate, now time.Time) float64 {
+	age := max(now.Sub(c.PublishedAt), 0)
+
+	return math.Exp2(-float64(age) / float64(d.HalfLife))
+}
+
+// AuthorAffinity favours authors the viewer interacts with. The score grows
+// logarithmically so a handful of interactions matters more than the
+// hundredth one, and reaches 1 at Saturation interactions.
+type AuthorAffinity struct {
+	Saturation int64
+}
+
+func (a AuthorAffinity) Score(c Candidate, _ time.Time) float64 {
+	return logScale(float64(c.Affinity), float64(a.Saturation))
+}
+
+// Engagement rates posts by their reactions and comments, a comment
+// counting as CommentWeight reactions. It reaches 1 at Saturation.
+type Engagement struct {
+	CommentWeight float64
+	Saturation    float64
+}
+
+func (e Engagement) Score(c Candidate, _ time.Time) float64 {
+	return logScale(float64(c.Reactions)+e.CommentWeight*float64(c.Comments), e.Saturation)
+}
+
+// logScale maps v to log(1+v)/log(1+saturation), capped at 1.
+func logScale(v, saturation float64) float64 {
+	if v <= 0 || saturation <= 0 {
+		return 0
+	}
+
+	return min(math.Log1p(v)/math.Log1p(saturation), 1)
+}
+
+// DefaultScorers is the mix used by the "For You" feed.
+func DefaultScorers() []Weighted {
+	return []Weighted{
+		{Scorer: RecencyDecay{HalfLife: 6 * time.Hour}, Weight: 1},
+		{Scorer: AuthorAffinity{Saturation: 20}, Weight: 0.6},
+		{Scorer: Engagement{CommentWeight: 2, Saturation: 100}, Weight: 0.4},
+	}
+}
@@ -0,0 +1,105 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var fixedNow = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func fixedClock() time.Time {
+	return fixedNow
+}
+
+func TestRecencyDecay(t *testing.T) {
+	decay := RecencyDecay{HalfLife: 6 * time.Hour}
+
+	tests := []struct {
+		name string
+		age  time.Duration
+		want float64
+	}{
+		{name: "just published", age: 0, want: 1},
+		{name: "one half-life", age: 6 * time.Hour, want: 0.5},
+		{name: "two half-lives", age: 12 * time.Hour, want: 0.25},
+		{name: "future post", age: -time.Hour, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decay.Score(Candidate{PublishedAt: fixedNow.Add(-tt.age)}, fixedNow)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogScaledScorersSaturate(t *testing.T) {
+	affinity := AuthorAffinity{Saturation: 20}
+	if got := affinity.Score(Candidate{Affinity: 0}, fixedNow); got != 0 {
+		t.Errorf("no interactions scored %v, want 0", got)
+	}
+	if got := affinity.Score(Candidate{Affinity: 500}, fixedNow); got != 1 {
+		t.Errorf("saturated affinity scored %v, want 1", got)
+	}
+
+	engagement := Engagement{CommentWeight: 2, Saturation: 100}
+	withComments := engagement.Score(Candidate{Reactions: 5, Comments: 5}, fixedNow)
+	withReactions := engagement.Score(Candidate{Reactions: 10}, fixedNow)
+	if withComments <= withReactions {
+		t.Errorf("comments should weigh more than reactions: %v <= %v", withComments, withReactions)
+	}
+}
+
+func TestRankerOrdersByWeightedScore(t *testing.T) {
+	ranker := New(DefaultScorers()...).WithClock(fixedClock)
+
+	candidates := []Candidate{
+		{PostID: 1, PublishedAt: fixedNow.Add(-48 * time.Hour), Reactions: 3},
+		{PostID: 2, PublishedAt: fixedNow.Add(-1 * time.Hour)},
+		{PostID: 3, PublishedAt: fixedNow.Add(-3 * time.Hour), Affinity: 15, Reactions: 40, Comments: 10},
+	}
+
+	got := ranker.Rank(candidates)
+
+	want := []int64{3, 2, 1}
+	for i, id := range want {
+		if got[i].PostID != id {
+			t.Fatalf("position %d = post %d, want post %d (ranking %+v)", i, got[i].PostID, id, got)
+		}
+	}
+}
+
+func TestRankerBreaksTiesDeterministically(t *testing.T) {
+	constant := ScorerFunc(func(Candidate, time.Time) float64 { return 1 })
+	ranker := New(Weighted{Scorer: constant, Weight: 1}).WithClock(fixedClock)
+
+	candidates := []Candidate{
+		{PostID: 1, PublishedAt: fixedNow.Add(-time.Hour)},
+		{PostID: 2, PublishedAt: fixedNow.Add(-time.Hour)},
+		{PostID: 3, PublishedAt: fixedNow},
+	}
+
+	got := ranker.Rank(candidates)
+
+	want := []int64{3, 2, 1}
+	for i, id := range want {
+		if got[i].PostID != id {
+			t.Fatalf("position %d = post %d, want post %d", i, got[i].PostID, id)
+		}
+	}
+}
+
+func TestRankerUsesInjectedClock(t *testing.T) {
+	ranker := New(Weighted{Scorer: RecencyDecay{HalfLife: time.Hour}, Weight: 1})
+	candidate := []Candidate{{PostID: 1, PublishedAt: fixedNow.Add(-time.Hour)}}
+
+	got := ranker.WithClock(fixedClock).Rank(candidate)[0].Score
+	later := ranker.WithClock(func() time.Time { return fixedNow.Add(time.Hour) }).Rank(candidate)[0].Score
+
+	if got != 0.5 || later != 0.25 {
+		t.Errorf("scores = %v and %v, want 0.5 and 0.25", got, later)
+	}
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"social/internal/entities"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var DuplicateCollectionErrMsg = `pq: duplicate key value violates unique constraint "bookmark_collections_user_id_name_key`
+
+type Bookmark struct {
+	CollectionID *int64 `json:"collection_id,omitempty"`
+	CreatedAt    string `json:"created_at"`
+	Post         Post   `json:"post"`
+}
+
+type BookmarkCollection struct {
+	ID            int64  `json:"id"`
+	UserID        int64  `json:"user_id"`
+	Name          string `json:"name"`
+	BookmarkCount int64  `json:"bookmark_count"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type BookmarkStore struct {
+	db *sql.DB
+}
+
+// Save bookmarks a post, moving it to the given collection when it is
+// already bookmarked. The collection must belong to the user.
+func (s *BookmarkStore) Save(ctx context.Context, userID, postID int64, collectionID *int64) error {
+	query := `
+		INSERT INTO bookmarks (user_id, post_id, collection_id)
+		SELECT $1, $2, $3
+		WHERE $3::bigint IS NULL OR EXISTS (
+			SELECT 1 FROM bookmark_collections WHERE id = $3 AND user_id = $1
+		)
+		ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, postID, collectionID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *BookmarkStore) Remove(ctx context.Context, userID, postID int64) error {
+	query := `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *BookmarkStore) IsBookmarked(ctx context.Context, userID, postID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM bookmarks WHERE user_id = $1 AND post_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var bookmarked bool
+	if err := s.db.QueryRowContext(ctx, query, userID, postID).Scan(&bookmarked); err != nil {
+		return false, err
+	}
+
+	return bookmarked, nil
+}
+
+// GetByUser lists the user's bookmarks, newest first. Posts that are no
+// longer visible to the user are left out.
+func (s *BookmarkStore) GetByUser(ctx context.Context, userID int64, collectionID *int64, page PaginatedQuery) ([]Bookmark, error) {
+	query := `
+		SELECT b.collection_id, b.created_at,
+		p.id, p.user_id, u.username, p.title, p.content, p.tags, p.status, p.publish_at,
+		p.created_at, p.updated_at, p.repost_count, p.quote_count
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			b.user_id = $1 AND
+			($2::bigint IS NULL OR b.collection_id = $2) AND
+			(p.status = 'published' OR p.user_id = $1) AND
+			(p.hidden_at IS NULL OR p.user_id = $1) AND p.deleted_at IS NULL
+		ORDER BY b.created_at DESC
+		LIMIT $3 OFFSET $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, collectionID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := make([]Bookmark, 0)
+	for rows.Next() {
+		b := Bookmark{Post: Post{Bookmarked: true}}
+		if err := rows.Scan(
+			&b.CollectionID,
+			&b.CreatedAt,
+			&b.Post.ID,
+			&b.Post.UserID,
+			&b.Post.Username,
+			&b.Post.Title,
+			&b.Post.Content,
+			pq.Array(&b.Post.Tags),
+			&b.Post.Status,
+			&b.Post.PublishAt,
+			&b.Post.CreatedAt,
+			&b.Post.UpdatedAt,
+			&b.Post.RepostCount,
+			&b.Post.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+
+		b.Post.Entities = entities.Parse(b.Post.Content)
+
+		bookmarks = append(bookmarks, b)
+	}
+
+	return bookmarks, rows.Err()
+}
+
+func (s *BookmarkStore) CreateCollection(ctx context.Context, collection *BookmarkCollection) error {
+	query := `
+		INSERT INTO bookmark_collections (user_id, name)
+		VALUES ($1, $2) RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if err := s.db.QueryRowContext(
+		ctx,
+		query,
+		collection.UserID,
+		collection.Name,
+	).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+	); err != nil {
+		switch {
+		case strings.Contains(err.Error(), DuplicateCollectionErrMsg):
+			return ErrDuplicatedKey
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *BookmarkStore) GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error) {
+	query := `
+		SELECT bc.id, bc.user_id, bc.name, bc.created_at, COUNT(b.post_id)
+		FROM bookmark_collections bc
+		LEFT JOIN bookmarks b ON b.collection_id = bc.id
+		WHERE bc.user_id = $1
+		GROUP BY bc.id
+		ORDER BY bc.name
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make([]BookmarkCollection, 0)
+	for rows.Next() {
+		var c BookmarkCollection
+		if err := rows.Scan(
+			&c.ID,
+			&c.UserID,
+			&c.Name,
+			&c.CreatedAt,
+			&c.BookmarkCount,
+		); err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+// DeleteCollection removes a collection. Its bookmarks are kept and become
+// uncategorized.
+func (s *BookmarkStore) DeleteCollection(ctx context.Context, userID, collectionID int64) error {
+	query := `DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, collectionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
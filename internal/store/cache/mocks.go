@@ -3,11 +3,15 @@ package cache
 import (
 	"context"
 	"social/internal/store"
+	"time"
 )
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:     &MockUserStore{},
+		Tags:      &MockTagStore{},
+		Timelines: &MockTimelineStore{},
+		Stats:     &MockStatsStore{},
 	}
 }
 
@@ -21,3 +25,56 @@ func (m MockUserStore) Get(ctx context.Context, id int64) (*store.User, error) {
 func (m MockUserStore) Set(ctx context.Context, user *store.User) error {
 	return nil
 }
+
+func (m MockUserStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m MockUserStore) MarkActive(ctx context.Context, userID int64, at time.Time) (bool, error) {
+	return true, nil
+}
+
+type MockTagStore struct {
+}
+
+func (m MockTagStore) GetTrending(ctx context.Context) ([]store.TrendingTag, error) {
+	return nil, nil
+}
+
+func (m MockTagStore) SetTrending(ctx context.Context, tags []store.TrendingTag) error {
+	return nil
+}
+
+type MockTimelineStore struct {
+}
+
+func (m MockTimelineStore) Get(ctx context.Context, userID int64, limit int) ([]store.TimelineEntry, bool, error) {
+	return nil, false, nil
+}
+
+func (m MockTimelineStore) Set(ctx context.Context, userID int64, entries []store.TimelineEntry, maxLength int) error {
+	return nil
+}
+
+func (m MockTimelineStore) Push(ctx context.Context, userIDs []int64, entry store.TimelineEntry, maxLength int) error {
+	return nil
+}
+
+func (m MockTimelineStore) Remove(ctx context.Context, userIDs []int64, entry store.TimelineEntry) error {
+	return nil
+}
+
+func (m MockTimelineStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockStatsStore struct {
+}
+
+func (m MockStatsStore) Get(ctx context.Context, key string) (*store.PlatformStats, error) {
+	return nil, nil
+}
+
+func (m MockStatsStore) Set(ctx context.Context, key string, stats *store.PlatformStats, exp time.Duration) error {
+	return nil
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"social/internal/store"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type StatsStore struct {
+	client *redis.Client
+}
+
+func (s *StatsStore) Get(ctx context.Context, key string) (*store.PlatformStats, error) {
+	d, err := s.client.Get(ctx, "stats-"+key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats store.PlatformStats
+	if err := json.Unmarshal([]byte(d), &stats); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (s *StatsStore) Set(ctx context.Context, key string, stats *store.PlatformStats, exp time.Duration) error {
+	json, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	return s.client.SetEX(ctx, "stats-"+key, json, exp).Err()
+}
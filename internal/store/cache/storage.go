@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"social/internal/store"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -11,11 +12,31 @@ type Storage struct {
 	Users interface {
 		Get(context.Context, int64) (*store.User, error)
 		Set(context.Context, *store.User) error
+		Delete(context.Context, int64) error
+		MarkActive(ctx context.Context, userID int64, at time.Time) (bool, error)
+	}
+	Tags interface {
+		GetTrending(context.Context) ([]store.TrendingTag, error)
+		SetTrending(context.Context, []store.TrendingTag) error
+	}
+	Timelines interface {
+		Get(ctx context.Context, userID int64, limit int) ([]store.TimelineEntry, bool, error)
+		Set(ctx context.Context, userID int64, entries []store.TimelineEntry, maxLength int) error
+		Push(ctx context.Context, userIDs []int64, entry store.TimelineEntry, maxLength int) error
+		Remove(ctx context.Context, userIDs []int64, entry store.TimelineEntry) error
+		Delete(context.Context, int64) error
+	}
+	Stats interface {
+		Get(ctx context.Context, key string) (*store.PlatformStats, error)
+		Set(ctx context.Context, key string, stats *store.PlatformStats, exp time.Duration) error
 	}
 }
 
 func NewRedisStorage(client *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{client: client},
+		Users:     &UserStore{client: client},
+		Tags:      &TagStore{client: client},
+		Timelines: &TimelineStore{client: client},
+		Stats:     &StatsStore{client: client},
 	}
 }
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"social/internal/store"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TrendingExpTime keeps a precomputed ranking around long enough to survive
+// a few missed refreshes before readers fall back to the database.
+const TrendingExpTime = time.Minute * 30
+
+const trendingTagsKey = "tags-trending"
+
+type TagStore struct {
+	client *redis.Client
+}
+
+func (s *TagStore) GetTrending(ctx context.Context) ([]store.TrendingTag, error) {
+	d, err := s.client.Get(ctx, trendingTagsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []store.TrendingTag
+	if err := json.Unmarshal([]byte(d), &tags); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (s *TagStore) SetTrending(ctx context.Context, tags []store.TrendingTag) error {
+	json, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+
+	return s.client.SetEX(ctx, trendingTagsKey, json, TrendingExpTime).Err()
+}
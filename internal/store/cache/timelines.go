@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"social/internal/store"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const TimelineExpTime = time.Hour * 24
+
+// pushTimelineScript adds a post to a timeline only when the timeline is
+// already cached: pushing into a cold key would make a partial timeline
+// look complete. The timeline is then trimmed to its newest ARGV[3] posts.
+var pushTimelineScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[1], ARGV[2])
+redis.call("ZREMRANGEBYRANK", KEYS[1], 0, -tonumber(ARGV[3]) - 1)
+return 1
+`)
+
+type TimelineStore struct {
+	client *redis.Client
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%v", userID)
+}
+
+// timelineMember encodes an entry as its id, followed by the post it shares
+// for reposts.
+func timelineMember(e store.TimelineEntry) string {
+	if e.SharedID == 0 || e.SharedID == e.PostID {
+		return strconv.FormatInt(e.PostID, 10)
+	}
+
+	return fmt.Sprintf("%d:%d", e.PostID, e.SharedID)
+}
+
+func parseTimelineMember(member string, score float64) (store.TimelineEntry, error) {
+	id, shared, isRepost := strings.Cut(member, ":")
+
+	postID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return store.TimelineEntry{}, err
+	}
+
+	e := store.TimelineEntry{PostID: postID, SharedID: postID, Score: score}
+	if isRepost {
+		if e.SharedID, err = strconv.ParseInt(shared, 10, 64); err != nil {
+			return store.TimelineEntry{}, err
+		}
+	}
+
+	return e, nil
+}
+
+// Get returns up to limit entries of a cached timeline, newest first, and
+// whether the timeline is cached at all.
+func (s *TimelineStore) Get(ctx context.Context, userID int64, limit int) ([]store.TimelineEntry, bool, error) {
+	key := timelineKey(userID)
+
+	pipe := s.client.Pipeline()
+	exists := pipe.Exists(ctx, key)
+	members := pipe.ZRevRangeWithScores(ctx, key, 0, int64(limit)-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, false, err
+	}
+
+	if exists.Val() == 0 {
+		return nil, false, nil
+	}
+
+	entries := make([]store.TimelineEntry, 0, len(members.Val()))
+	for _, member := range members.Val() {
+		e, err := parseTimelineMember(member.Member.(string), member.Score)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if e.PostID != 0 {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, true, nil
+}
+
+// Set replaces a timeline with the given entries. An empty timeline is
+// cached too, with a placeholder member, so new posts can be pushed to it.
+func (s *TimelineStore) Set(ctx context.Context, userID int64, entries []store.TimelineEntry, maxLength int) error {
+	key := timelineKey(userID)
+
+	members := make([]*redis.Z, 0, len(entries)+1)
+	members = append(members, &redis.Z{Score: 0, Member: "0"})
+	for _, e := range entries {
+		members = append(members, &redis.Z{Score: e.Score, Member: timelineMember(e)})
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.ZAdd(ctx, key, members...)
+	pipe.ZRemRangeByRank(ctx, key, 0, -int64(maxLength)-2)
+	pipe.Expire(ctx, key, TimelineExpTime)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Push adds a post to the cached timelines of the given users. Timelines
+// that are not cached are left alone and rebuilt on their next read. The
+// script is sent whole: a pipeline cannot fall back from EVALSHA when the
+// server does not know it yet.
+func (s *TimelineStore) Push(ctx context.Context, userIDs []int64, entry store.TimelineEntry, maxLength int) error {
+	pipe := s.client.Pipeline()
+	for _, userID := range userIDs {
+		pushTimelineScript.Eval(ctx, pipe, []string{timelineKey(userID)}, entry.Score, timelineMember(entry), maxLength+1)
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Remove takes the entry of a post or repost off the cached timelines of
+// the given users.
+func (s *TimelineStore) Remove(ctx context.Context, userIDs []int64, entry store.TimelineEntry) error {
+	member := timelineMember(entry)
+
+	pipe := s.client.Pipeline()
+	for _, userID := range userIDs {
+		pipe.ZRem(ctx, timelineKey(userID), member)
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Delete drops a cached timeline so it is rebuilt on its next read.
+func (s *TimelineStore) Delete(ctx context.Context, userID int64) error {
+	return s.client.Del(ctx, timelineKey(userID)).Err()
+}
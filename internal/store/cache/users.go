@@ -14,6 +14,17 @@ import (
 
 const UserExpTime = time.Second * 30
 
+// ActivityExpTime outlives a UTC day so an activity marker is still there
+// for the last requests of the day it was set on.
+const ActivityExpTime = time.Hour * 25
+
+// cachedUser is how users are cached, with the fields they keep out of
+// responses that the API still checks.
+type cachedUser struct {
+	*store.User
+	PasswordChangedAt *string `json:"password_changed_at,omitempty"`
+}
+
 type UserStore struct {
 	client *redis.Client
 }
@@ -27,10 +38,12 @@ func (s *UserStore) Get(ctx context.Context, userId int64) (*store.User, error)
 
 	var user store.User
 	if d != "" {
-		err := json.Unmarshal([]byte(d), &user)
+		cached := cachedUser{User: &user}
+		err := json.Unmarshal([]byte(d), &cached)
 		if err != nil {
 			return nil, err
 		}
+		user.PasswordChangedAt = cached.PasswordChangedAt
 	}
 
 	return &user, nil
@@ -42,10 +55,24 @@ func (s *UserStore) Set(ctx context.Context, user *store.User) error {
 	}
 	log.Println("caching user in redis: ", user.ID)
 	cacheKey := fmt.Sprintf("user-%v", user.ID)
-	json, err := json.Marshal(user)
+	json, err := json.Marshal(cachedUser{User: user, PasswordChangedAt: user.PasswordChangedAt})
 	if err != nil {
 		return err
 	}
 
 	return s.client.SetEX(ctx, cacheKey, json, UserExpTime).Err()
 }
+
+func (s *UserStore) Delete(ctx context.Context, userId int64) error {
+	cacheKey := fmt.Sprintf("user-%v", userId)
+
+	return s.client.Del(ctx, cacheKey).Err()
+}
+
+// MarkActive records that the user was active on the UTC day of at. It
+// reports false when the user was already marked for that day.
+func (s *UserStore) MarkActive(ctx context.Context, userId int64, at time.Time) (bool, error) {
+	cacheKey := fmt.Sprintf("user-active-%v-%v", at.UTC().Format(time.DateOnly), userId)
+
+	return s.client.SetNX(ctx, cacheKey, 1, ActivityExpTime).Result()
+}
@@ -3,15 +3,43 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"social/internal/entities"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// MaxReplyDepth bounds how many levels of replies are loaded at once.
+	MaxReplyDepth = 5
+	// RepliesPerThread is how many replies of each comment are inlined when
+	// loading a tree; the rest are fetched through the replies endpoint.
+	RepliesPerThread = 3
+	// CommentRankGravity controls how fast likes stop lifting a comment in
+	// the "top" sort: score = likes / (age in hours + 2) ^ gravity.
+	CommentRankGravity = 1.8
 )
 
+var ErrInvalidParentComment = errors.New("parent comment does not belong to this post")
+
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Username  string `json:"username"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
+	ID         int64             `json:"id"`
+	PostID     int64             `json:"post_id"`
+	ParentID   *int64            `json:"parent_id,omitempty"`
+	UserID     int64             `json:"user_id"`
+	Username   string            `json:"username"`
+	Content    string            `json:"content"`
+	CreatedAt  string            `json:"created_at"`
+	ReplyCount int64             `json:"reply_count"`
+	EditedAt   *string           `json:"edited_at,omitempty"`
+	LikeCount  int64             `json:"like_count"`
+	Liked      bool              `json:"liked"`
+	Replies    []Comment         `json:"replies,omitempty"`
+	Entities   []entities.Entity `json:"entities,omitempty"`
+	HiddenAt   *string           `json:"hidden_at,omitempty"`
+	DeletedAt  *string           `json:"deleted_at,omitempty"`
+	DeletedBy  *int64            `json:"deleted_by,omitempty"`
 }
 
 type CommentStore struct {
@@ -20,83 +48,535 @@ type CommentStore struct {
 
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 	query := `
-		INSERT INTO comments(user_id, post_id, content) 
-		VALUES ($1, $2, $3) RETURNING id, created_at; 
+		INSERT INTO comments(user_id, post_id, parent_id, content) 
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at; 
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if comment.ParentID != nil {
+			var parentPostID int64
+			if err := tx.QueryRowContext(
+				ctx,
+				`SELECT post_id FROM comments WHERE id = $1 FOR UPDATE`,
+				*comment.ParentID,
+			).Scan(&parentPostID); err != nil {
+				switch {
+				case errors.Is(err, sql.ErrNoRows):
+					return ErrInvalidParentComment
+				default:
+					return err
+				}
+			}
+
+			if parentPostID != comment.PostID {
+				return ErrInvalidParentComment
+			}
+		}
+
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			comment.UserID,
+			comment.PostID,
+			comment.ParentID,
+			comment.Content,
+		).Scan(
+			&comment.ID,
+			&comment.CreatedAt,
+		); err != nil {
+			return err
+		}
+
+		comment.Entities = entities.Parse(comment.Content)
+
+		if comment.ParentID == nil {
+			return nil
+		}
+
+		_, err := tx.ExecContext(
+			ctx,
+			`UPDATE comments SET reply_count = reply_count + 1 WHERE id = $1`,
+			*comment.ParentID,
+		)
+
+		return err
+	})
+}
+
+func (s *CommentStore) GetById(ctx context.Context, commentID int64) (Comment, error) {
+	query := `
+		SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content,
+		c.created_at, c.reply_count, c.edited_at, c.like_count, c.hidden_at, c.deleted_at, c.deleted_by,
+		users.username FROM comments c
+		JOIN users ON users.id = c.user_id
+		WHERE c.id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	if err := s.db.QueryRowContext(
-		ctx,
-		query,
-		comment.UserID,
-		comment.PostID,
-		comment.Content,
-	).Scan(
+	var comment Comment
+	if err := s.db.QueryRowContext(ctx, query, commentID).Scan(
 		&comment.ID,
+		&comment.PostID,
+		&comment.ParentID,
+		&comment.UserID,
+		&comment.Content,
 		&comment.CreatedAt,
+		&comment.ReplyCount,
+		&comment.EditedAt,
+		&comment.LikeCount,
+		&comment.HiddenAt,
+		&comment.DeletedAt,
+		&comment.DeletedBy,
+		&comment.Username,
 	); err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return Comment{}, ErrNotFound
+		default:
+			return Comment{}, err
+		}
 	}
 
-	return nil
+	comment.Entities = entities.Parse(comment.Content)
+
+	return comment, nil
+}
+
+// ListByPost pages through the top-level comments of a post, newest, oldest
+// or top-ranked first, with their replies loaded up to depth levels. It
+// returns the cursor of the next page, or an empty string on the last one.
+func (s *CommentStore) ListByPost(ctx context.Context, postID, viewerID int64, depth int, q CursorQuery) ([]Comment, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var (
+		comments []Comment
+		next     string
+		err      error
+	)
+
+	switch q.Sort {
+	case "top":
+		comments, next, err = s.listTopByPost(ctx, postID, viewerID, q)
+	default:
+		comments, next, err = s.listRecentByPost(ctx, postID, viewerID, q)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.attachReplies(ctx, comments, viewerID, depth); err != nil {
+		return nil, "", err
+	}
+
+	return comments, next, nil
+}
+
+func (s *CommentStore) listRecentByPost(ctx context.Context, postID, viewerID int64, q CursorQuery) ([]Comment, string, error) {
+	createdAt, id, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	comparison, direction := "<", "DESC"
+	if q.Sort == "old" {
+		comparison, direction = ">", "ASC"
+	}
+
+	query := `
+		SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, 
+		c.created_at, c.reply_count, c.edited_at, c.like_count,
+		EXISTS (SELECT 1 FROM comment_likes cl WHERE cl.comment_id = c.id AND cl.user_id = $5) AS liked,
+		users.username FROM comments c
+		JOIN users ON users.id = c.user_id
+		WHERE
+			c.post_id = $1 AND c.parent_id IS NULL AND c.hidden_at IS NULL AND c.deleted_at IS NULL AND
+			($2::timestamptz IS NULL OR (c.created_at, c.id) ` + comparison + ` ($2::timestamptz, $3::bigint))
+		ORDER BY c.created_at ` + direction + `, c.id ` + direction + `
+		LIMIT $4;
+	`
+
+	comments, err := s.queryComments(ctx, query, postID, createdAt, id, q.Limit+1, viewerID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(comments) > q.Limit {
+		comments = comments[:q.Limit]
+		last := comments[len(comments)-1]
+		next = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return comments, next, nil
 }
 
-func (s *CommentStore) GetByPostId(ctx context.Context, postID int64) ([]Comment, error) {
+// listTopByPost ranks comments by likes decayed over their age. Scores are
+// computed against the ranking time carried in the cursor so that pages stay
+// consistent while the client scrolls.
+func (s *CommentStore) listTopByPost(ctx context.Context, postID, viewerID int64, q CursorQuery) ([]Comment, string, error) {
+	rankedAt, offset, err := decodeRankCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, 
-		c.created_at, users.username FROM comments c
+		SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, 
+		c.created_at, c.reply_count, c.edited_at, c.like_count,
+		EXISTS (SELECT 1 FROM comment_likes cl WHERE cl.comment_id = c.id AND cl.user_id = $5) AS liked,
+		users.username FROM comments c
 		JOIN users ON users.id = c.user_id
-		where c.post_id = $1
-		ORDER BY c.created_at DESC
-		LIMIT 10;
+		WHERE c.post_id = $1 AND c.parent_id IS NULL AND c.hidden_at IS NULL AND c.deleted_at IS NULL AND c.created_at <= $2
+		ORDER BY
+			c.like_count / POWER(GREATEST(EXTRACT(EPOCH FROM ($2 - c.created_at)), 0) / 3600 + 2, $6) DESC,
+			c.id DESC
+		LIMIT $3 OFFSET $4;
+	`
+
+	comments, err := s.queryComments(ctx, query, postID, rankedAt, q.Limit+1, offset, viewerID, CommentRankGravity)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(comments) > q.Limit {
+		comments = comments[:q.Limit]
+		next = encodeRankCursor(rankedAt, offset+q.Limit)
+	}
+
+	return comments, next, nil
+}
+
+// GetReplies pages through the direct replies of a comment in chronological
+// order, loading their own replies up to depth-1 further levels.
+func (s *CommentStore) GetReplies(ctx context.Context, commentID, viewerID int64, depth int, page PaginatedQuery) ([]Comment, error) {
+	query := `
+		SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, 
+		c.created_at, c.reply_count, c.edited_at, c.like_count,
+		EXISTS (SELECT 1 FROM comment_likes cl WHERE cl.comment_id = c.id AND cl.user_id = $4) AS liked,
+		users.username FROM comments c
+		JOIN users ON users.id = c.user_id
+		WHERE c.parent_id = $1 AND c.hidden_at IS NULL AND c.deleted_at IS NULL
+		ORDER BY c.created_at, c.id
+		LIMIT $2 OFFSET $3;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(
-		ctx,
-		query,
-		postID,
-	)
+	replies, err := s.queryComments(ctx, query, commentID, page.Limit, page.Offset, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachReplies(ctx, replies, viewerID, depth-1); err != nil {
+		return nil, err
+	}
+
+	return replies, nil
+}
+
+// attachReplies loads the tree one level at a time so each level costs a
+// single query, inlining at most RepliesPerThread replies per comment.
+func (s *CommentStore) attachReplies(ctx context.Context, comments []Comment, viewerID int64, depth int) error {
+	query := `
+		SELECT id, post_id, parent_id, user_id, content, created_at, reply_count, edited_at, like_count,
+		EXISTS (SELECT 1 FROM comment_likes cl WHERE cl.comment_id = replies.id AND cl.user_id = $3) AS liked,
+		username
+		FROM (
+			SELECT c.*, users.username,
+			ROW_NUMBER() OVER (PARTITION BY c.parent_id ORDER BY c.created_at, c.id) AS position
+			FROM comments c
+			JOIN users ON users.id = c.user_id
+			WHERE c.parent_id = ANY($1) AND c.hidden_at IS NULL AND c.deleted_at IS NULL
+		) replies
+		WHERE position <= $2
+		ORDER BY created_at, id;
+	`
+
+	level := make([]*Comment, 0, len(comments))
+	for i := range comments {
+		level = append(level, &comments[i])
+	}
+
+	for d := 0; d < min(depth, MaxReplyDepth) && len(level) > 0; d++ {
+		parents := make(map[int64]*Comment, len(level))
+		ids := make([]int64, 0, len(level))
+		for _, c := range level {
+			if c.ReplyCount > 0 {
+				parents[c.ID] = c
+				ids = append(ids, c.ID)
+			}
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		replies, err := s.queryComments(ctx, query, pq.Array(ids), RepliesPerThread, viewerID)
+		if err != nil {
+			return err
+		}
+
+		for _, reply := range replies {
+			parent := parents[*reply.ParentID]
+			parent.Replies = append(parent.Replies, reply)
+		}
+
+		level = level[:0]
+		for _, parent := range parents {
+			for i := range parent.Replies {
+				level = append(level, &parent.Replies[i])
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *CommentStore) queryComments(ctx context.Context, query string, args ...any) ([]Comment, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	comments := make([]Comment, 0)
-	comment := &Comment{}
-
 	for rows.Next() {
+		var comment Comment
 		if err := rows.Scan(
 			&comment.ID,
 			&comment.PostID,
+			&comment.ParentID,
 			&comment.UserID,
 			&comment.Content,
 			&comment.CreatedAt,
+			&comment.ReplyCount,
+			&comment.EditedAt,
+			&comment.LikeCount,
+			&comment.Liked,
 			&comment.Username,
 		); err != nil {
 			return nil, err
 		}
 
-		comments = append(comments, *comment)
+		comment.Entities = entities.Parse(comment.Content)
+
+		comments = append(comments, comment)
 	}
 
-	return comments, nil
+	return comments, rows.Err()
 }
 
-func (s *CommentStore) DeleteByPostId(ctx context.Context, postID int64) (int64, error) {
-	query := "DELETE FROM comments WHERE comments.post_id = $1"
+// Update saves an edit of the comment, holding it for review in the same
+// transaction when hold is set.
+func (s *CommentStore) Update(ctx context.Context, comment *Comment, hold *ContentHold) error {
+	query := `
+		UPDATE comments SET content = $2, edited_at = NOW()
+		WHERE id = $1
+		RETURNING edited_at
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := tx.QueryRowContext(ctx, query, comment.ID, comment.Content).Scan(&comment.EditedAt); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		comment.Entities = entities.Parse(comment.Content)
+
+		if hold == nil {
+			return nil
+		}
+
+		hiddenAt, err := holdContent(ctx, tx, ReportTargetComment, comment.ID, comment.UserID, hold.Reason)
+		if err != nil {
+			return err
+		}
+
+		comment.HiddenAt = &hiddenAt
+		return nil
+	})
+}
+
+// Like records the user's like and returns the comment's like count.
+func (s *CommentStore) Like(ctx context.Context, commentID, userID int64) (int64, error) {
+	return s.toggleLike(
+		ctx,
+		commentID,
+		userID,
+		`INSERT INTO comment_likes (comment_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		`UPDATE comments SET like_count = like_count + 1 WHERE id = $1 RETURNING like_count`,
+		false,
+	)
+}
+
+// Unlike removes the user's like and returns the comment's like count.
+func (s *CommentStore) Unlike(ctx context.Context, commentID, userID int64) (int64, error) {
+	return s.toggleLike(
+		ctx,
+		commentID,
+		userID,
+		`DELETE FROM comment_likes WHERE comment_id = $1 AND user_id = $2`,
+		`UPDATE comments SET like_count = GREATEST(like_count - 1, 0) WHERE id = $1 RETURNING like_count`,
+		true,
+	)
+}
+
+// toggleLike runs the like change and, when it touched a row, the matching
+// counter update in one transaction. mustExist reports ErrNotFound when the
+// change was a no-op.
+func (s *CommentStore) toggleLike(ctx context.Context, commentID, userID int64, change, counter string, mustExist bool) (int64, error) {
+	var count int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		result, err := tx.ExecContext(ctx, change, commentID, userID)
+		if err != nil {
+			return err
+		}
+
+		changed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if changed == 0 {
+			if mustExist {
+				return ErrNotFound
+			}
+
+			return tx.QueryRowContext(ctx, `SELECT like_count FROM comments WHERE id = $1`, commentID).Scan(&count)
+		}
+
+		return tx.QueryRowContext(ctx, counter, commentID).Scan(&count)
+	})
+
+	return count, err
+}
+
+// Delete soft-deletes a comment. Its replies stay attached and disappear
+// with it until it is restored or purged.
+func (s *CommentStore) Delete(ctx context.Context, commentID, deletedBy int64) error {
+	return s.setDeleted(ctx, deleteCommentQuery, -1, commentID, deletedBy)
+}
+
+// deleteCommentQuery soft-deletes comment $1 on behalf of user $2.
+const deleteCommentQuery = `
+	UPDATE comments SET deleted_at = NOW(), deleted_by = $2
+	WHERE id = $1 AND deleted_at IS NULL
+	RETURNING parent_id
+`
+
+// Restore undoes the soft-deletion of a comment.
+func (s *CommentStore) Restore(ctx context.Context, commentID int64) error {
+	query := `
+		UPDATE comments SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING parent_id
+	`
+
+	return s.setDeleted(ctx, query, 1, commentID)
+}
+
+// setDeleted runs a soft-delete or restore query returning the parent_id of
+// the comment, and moves the reply count of the parent by delta.
+func (s *CommentStore) setDeleted(ctx context.Context, query string, delta int, args ...any) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		return setCommentDeleted(ctx, tx, query, delta, args...)
+	})
+}
+
+// setCommentDeleted is setDeleted within tx.
+func setCommentDeleted(ctx context.Context, tx *sql.Tx, query string, delta int, args ...any) error {
+	var parentID *int64
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&parentID); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	if parentID == nil {
+		return nil
+	}
+
+	_, err := tx.ExecContext(
+		ctx,
+		`UPDATE comments SET reply_count = GREATEST(reply_count + $2, 0) WHERE id = $1`,
+		*parentID,
+		delta,
+	)
+
+	return err
+}
+
+// Purge permanently removes up to limit comments deleted before the given
+// time, with their replies, and returns how many it removed.
+func (s *CommentStore) Purge(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM comments WHERE id IN (
+			SELECT id FROM comments
+			WHERE deleted_at < $1
+			ORDER BY deleted_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	result, err := s.db.ExecContext(ctx, query, postID)
+	result, err := s.db.ExecContext(ctx, query, before, limit)
 	if err != nil {
 		return 0, err
 	}
 
 	return result.RowsAffected()
 }
+
+// SetHidden hides a comment and its replies from listings, or shows it again.
+func (s *CommentStore) SetHidden(ctx context.Context, commentID int64, hidden bool) error {
+	query := `
+		UPDATE comments SET hidden_at = CASE WHEN $2 THEN COALESCE(hidden_at, NOW()) END
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, commentID, hidden)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
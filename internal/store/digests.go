@@ -0,0 +1,269 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+var ErrInvalidDigestFrequency = errors.New("unknown digest frequency")
+
+// DigestPeriod is the time between two digests of the given frequency.
+func DigestPeriod(frequency string) (time.Duration, error) {
+	switch frequency {
+	case DigestDaily:
+		return time.Hour * 24, nil
+	case DigestWeekly:
+		return time.Hour * 24 * 7, nil
+	default:
+		return 0, ErrInvalidDigestFrequency
+	}
+}
+
+type DigestSubscription struct {
+	UserID     int64  `json:"user_id"`
+	Frequency  string `json:"frequency"`
+	LastSentAt string `json:"last_sent_at"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// DueDigest is a digest to send, covering what happened since Since.
+type DueDigest struct {
+	UserID    int64
+	Username  string
+	Email     string
+	Frequency string
+	Since     time.Time
+}
+
+type DigestFollower struct {
+	ID       int64
+	Username string
+}
+
+type DigestPost struct {
+	ID        int64
+	Title     string
+	Author    string
+	Reactions int64
+	Comments  int64
+}
+
+// Digest summarizes the activity of a user's network since their last
+// digest.
+type Digest struct {
+	NewFollowers     []DigestFollower
+	NewFollowerCount int64
+	TopPosts         []DigestPost
+	Unread           int64
+	Notifications    []NotificationGroup
+}
+
+// Empty reports whether there is nothing worth an email.
+func (d *Digest) Empty() bool {
+	return d.NewFollowerCount == 0 && len(d.TopPosts) == 0 && d.Unread == 0
+}
+
+type DigestStore struct {
+	db *sql.DB
+}
+
+func (s *DigestStore) Get(ctx context.Context, userID int64) (DigestSubscription, error) {
+	query := `
+		SELECT user_id, frequency, last_sent_at, created_at
+		FROM digest_subscriptions
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var sub DigestSubscription
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&sub.UserID, &sub.Frequency, &sub.LastSentAt, &sub.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return sub, ErrNotFound
+		default:
+			return sub, err
+		}
+	}
+
+	return sub, nil
+}
+
+// Subscribe opts the user in, or changes the frequency of their digest.
+// The first digest comes one period after subscribing.
+func (s *DigestStore) Subscribe(ctx context.Context, userID int64, frequency string) (DigestSubscription, error) {
+	if _, err := DigestPeriod(frequency); err != nil {
+		return DigestSubscription{}, err
+	}
+
+	query := `
+		INSERT INTO digest_subscriptions (user_id, frequency)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET frequency = EXCLUDED.frequency
+		RETURNING user_id, frequency, last_sent_at, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var sub DigestSubscription
+	err := s.db.QueryRowContext(ctx, query, userID, frequency).Scan(&sub.UserID, &sub.Frequency, &sub.LastSentAt, &sub.CreatedAt)
+
+	return sub, err
+}
+
+func (s *DigestStore) Unsubscribe(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM digest_subscriptions WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ClaimDue returns up to limit digests due at now, for active users that
+// are not suspended, and marks them as sent so that no other instance
+// sends them again.
+func (s *DigestStore) ClaimDue(ctx context.Context, now time.Time, limit int) ([]DueDigest, error) {
+	query := `
+		WITH due AS (
+			SELECT d.user_id, d.last_sent_at
+			FROM digest_subscriptions d
+			JOIN users u ON u.id = d.user_id
+			WHERE u.is_active AND (u.suspended_at IS NULL OR u.suspended_until <= $1) AND (
+				(d.frequency = $3 AND d.last_sent_at <= $1 - $4 * INTERVAL '1 second') OR
+				(d.frequency = $5 AND d.last_sent_at <= $1 - $6 * INTERVAL '1 second')
+			)
+			ORDER BY d.last_sent_at
+			LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE digest_subscriptions d
+		SET last_sent_at = $1
+		FROM due
+		JOIN users u ON u.id = due.user_id
+		WHERE d.user_id = due.user_id
+		RETURNING d.user_id, u.username, u.email, d.frequency, due.last_sent_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	daily, _ := DigestPeriod(DigestDaily)
+	weekly, _ := DigestPeriod(DigestWeekly)
+
+	rows, err := s.db.QueryContext(ctx, query, now, limit, DigestDaily, daily.Seconds(), DigestWeekly, weekly.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []DueDigest
+	for rows.Next() {
+		var d DueDigest
+		if err := rows.Scan(&d.UserID, &d.Username, &d.Email, &d.Frequency, &d.Since); err != nil {
+			return nil, err
+		}
+
+		due = append(due, d)
+	}
+
+	return due, rows.Err()
+}
+
+// GetNewFollowers returns the latest followers of the user since the given
+// time, up to limit, with their total count.
+func (s *DigestStore) GetNewFollowers(ctx context.Context, userID int64, since time.Time, limit int) ([]DigestFollower, int64, error) {
+	query := `
+		SELECT u.id, u.username, COUNT(*) OVER ()
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1 AND f.created_at > $2
+		ORDER BY f.created_at DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		followers []DigestFollower
+		count     int64
+	)
+	for rows.Next() {
+		var f DigestFollower
+		if err := rows.Scan(&f.ID, &f.Username, &count); err != nil {
+			return nil, 0, err
+		}
+
+		followers = append(followers, f)
+	}
+
+	return followers, count, rows.Err()
+}
+
+// GetTopPosts returns the posts published since the given time by the
+// users the user follows, with the most reactions, comments and reposts
+// first.
+func (s *DigestStore) GetTopPosts(ctx context.Context, userID int64, since time.Time, limit int) ([]DigestPost, error) {
+	query := `
+		SELECT p.id, p.title, u.username,
+		COALESCE((SELECT SUM(rc.count) FROM post_reaction_counts rc WHERE rc.post_id = p.id), 0) AS reactions,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comments
+		FROM posts p
+		JOIN followers f ON f.user_id = p.user_id AND f.follower_id = $1
+		JOIN users u ON u.id = p.user_id
+		WHERE p.status = 'published' AND p.hidden_at IS NULL AND p.deleted_at IS NULL AND
+		p.repost_of_id IS NULL AND p.publish_at > $2
+		ORDER BY reactions + comments + p.repost_count DESC, p.publish_at DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []DigestPost
+	for rows.Next() {
+		var p DigestPost
+		if err := rows.Scan(&p.ID, &p.Title, &p.Author, &p.Reactions, &p.Comments); err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
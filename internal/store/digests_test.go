@@ -0,0 +1,37 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDigestPeriod(t *testing.T) {
+	if p, err := DigestPeriod(DigestDaily); err != nil || p != 24*time.Hour {
+		t.Errorf("DigestPeriod(daily) = %v, %v", p, err)
+	}
+	if p, err := DigestPeriod(DigestWeekly); err != nil || p != 7*24*time.Hour {
+		t.Errorf("DigestPeriod(weekly) = %v, %v", p, err)
+	}
+	if _, err := DigestPeriod("hourly"); !errors.Is(err, ErrInvalidDigestFrequency) {
+		t.Errorf("DigestPeriod(hourly) error = %v, want %v", err, ErrInvalidDigestFrequency)
+	}
+}
+
+func TestDigestEmpty(t *testing.T) {
+	tests := []struct {
+		digest Digest
+		want   bool
+	}{
+		{Digest{}, true},
+		{Digest{NewFollowerCount: 1}, false},
+		{Digest{TopPosts: []DigestPost{{ID: 1}}}, false},
+		{Digest{Unread: 3}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.digest.Empty(); got != tt.want {
+			t.Errorf("%+v.Empty() = %v, want %v", tt.digest, got, tt.want)
+		}
+	}
+}
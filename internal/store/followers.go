@@ -22,56 +22,108 @@ type FollowerStore struct {
 	db *sql.DB
 }
 
-func (s *FollowerStore) Follow(ctx context.Context, followerId, userId int64) error {
+func (s *FollowerStore) Follow(ctx context.Context, followerId, userId int64, events ...*OutboxEvent) error {
 	query := `
 		INSERT INTO followers(user_id, follower_id)
 		VALUES ($1, $2);
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userId, followerId)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		case strings.Contains(err.Error(), DuplicatedKeyErrorMessage):
-			return ErrDuplicatedKey
-		default:
+		_, err := tx.ExecContext(ctx, query, userId, followerId)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			case strings.Contains(err.Error(), DuplicatedKeyErrorMessage):
+				return ErrDuplicatedKey
+			default:
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET follower_count = follower_count + 1 WHERE id = $1`, userId); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		return addOutboxEvents(ctx, tx, events)
+	})
 }
 
-func (s *FollowerStore) Unfollow(ctx context.Context, followerId, userId int64) error {
+func (s *FollowerStore) Unfollow(ctx context.Context, followerId, userId int64, events ...*OutboxEvent) error {
 	query := `
 		DELETE FROM followers
 		WHERE user_id = $1 AND follower_id = $2;
 	`
 
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		result, err := tx.ExecContext(ctx, query, userId, followerId)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		rows, resultErr := result.RowsAffected()
+		if rows != 1 || resultErr != nil {
+			if rows == 0 || errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET follower_count = GREATEST(follower_count - 1, 0) WHERE id = $1`, userId); err != nil {
+			return err
+		}
+
+		return addOutboxEvents(ctx, tx, events)
+	})
+}
+
+// GetFollowerIDs returns the ids of the users following userId together
+// with its follower count, so callers can skip large accounts without
+// loading their followers: no ids are loaded once the count reaches limit.
+func (s *FollowerStore) GetFollowerIDs(ctx context.Context, userId int64, limit int) ([]int64, int, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	result, err := s.db.ExecContext(ctx, query, userId, followerId)
-	if err != nil {
-		switch err {
-		case sql.ErrNoRows:
-			return ErrNotFound
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT follower_count FROM users WHERE id = $1`, userId).Scan(&count); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, 0, ErrNotFound
 		default:
-			return err
+			return nil, 0, err
 		}
 	}
 
-	rows, resultErr := result.RowsAffected()
-	if rows != 1 || resultErr != nil {
-		if rows == 0 || errors.Is(err, sql.ErrNoRows) {
-			return ErrNotFound
+	ids := make([]int64, 0)
+	if count >= limit {
+		return ids, count, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT follower_id FROM followers WHERE user_id = $1`, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, 0, err
 		}
-		return err
+
+		ids = append(ids, id)
 	}
 
-	return nil
+	return ids, count, rows.Err()
 }
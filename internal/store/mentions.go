@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type MentionStore struct {
+	db *sql.DB
+}
+
+// Create records that the author mentioned the given usernames in a post,
+// or in one of its comments when commentID is set, and forgets the users no
+// longer mentioned there after an edit. Unknown and inactive users, the
+// author and users already mentioned in the same place are skipped; only
+// the newly mentioned users are returned so they are notified once.
+func (s *MentionStore) Create(ctx context.Context, authorID, postID int64, commentID *int64, usernames []string) ([]User, error) {
+	query := `
+		WITH targets AS (
+			SELECT id, username, email FROM users
+			WHERE lower(username) = ANY($4) AND id <> $1 AND is_active = true
+		), stale AS (
+			DELETE FROM mentions
+			WHERE post_id = $2 AND comment_id IS NOT DISTINCT FROM $3
+			AND mentioned_user_id NOT IN (SELECT id FROM targets)
+		), inserted AS (
+			INSERT INTO mentions (mentioned_user_id, author_id, post_id, comment_id)
+			SELECT id, $1, $2, $3 FROM targets
+			ON CONFLICT DO NOTHING
+			RETURNING mentioned_user_id
+		)
+		SELECT t.id, t.username, t.email FROM targets t
+		JOIN inserted i ON i.mentioned_user_id = t.id
+	`
+
+	users := make([]User, 0)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, authorID, postID, commentID, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email); err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
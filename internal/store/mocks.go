@@ -27,7 +27,11 @@ func (u *MockUserStore) create(context.Context, *User, *sql.Tx) error {
 	return nil
 }
 
-func (u *MockUserStore) CreateAndInvite(ctx context.Context, user *User, token string, tokenExp time.Duration) error {
+func (u *MockUserStore) CreateAndInvite(ctx context.Context, user *User, token string, tokenExp time.Duration, events ...*OutboxEvent) error {
+	return nil
+}
+
+func (u *MockUserStore) Invite(ctx context.Context, userID int64, token string, exp time.Duration) error {
 	return nil
 }
 
@@ -38,3 +42,31 @@ func (u *MockUserStore) Activate(context.Context, string) error {
 func (u *MockUserStore) Delete(context.Context, int64) error {
 	return nil
 }
+
+func (u *MockUserStore) RecordActivity(context.Context, int64, time.Time) error {
+	return nil
+}
+
+func (u *MockUserStore) List(context.Context, UserListQuery) ([]User, error) {
+	return []User{}, nil
+}
+
+func (u *MockUserStore) GetAny(context.Context, int64) (User, error) {
+	return User{}, nil
+}
+
+func (u *MockUserStore) ActivateById(context.Context, int64) error {
+	return nil
+}
+
+func (u *MockUserStore) SetRole(context.Context, int64, string) error {
+	return nil
+}
+
+func (u *MockUserStore) ForcePasswordReset(context.Context, *User, string, time.Duration) error {
+	return nil
+}
+
+func (u *MockUserStore) ResetPassword(context.Context, string, *User) error {
+	return nil
+}
@@ -0,0 +1,493 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrCaseNotOpen       = errors.New("moderation case is not open")
+	ErrCaseNotClaimed    = errors.New("moderation case is not claimed by this moderator")
+	ErrInvalidResolution = errors.New("resolution does not apply to this target")
+
+	DuplicateReportErrMsg = `pq: duplicate key value violates unique constraint "reports_reporter_id_case_id_key`
+)
+
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+
+	CaseStatusOpen     = "open"
+	CaseStatusClaimed  = "claimed"
+	CaseStatusResolved = "resolved"
+
+	ResolutionDismiss = "dismiss"
+	ResolutionHide    = "hide"
+	ResolutionDelete  = "delete"
+	ResolutionWarn    = "warn"
+	ResolutionSuspend = "suspend"
+
+	// ModerationActionClaim is logged when a moderator takes a case and
+	// ModerationActionHold when the content filters hold its target; the
+	// resolutions are logged under their own names.
+	ModerationActionClaim = "claim"
+	ModerationActionHold  = "hold"
+)
+
+type Report struct {
+	ID         int64  `json:"id"`
+	CaseID     int64  `json:"case_id"`
+	ReporterID int64  `json:"reporter_id"`
+	TargetType string `json:"target_type"`
+	TargetID   int64  `json:"target_id"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// ModerationCase gathers the reports against one target until a moderator
+// resolves it. Reports and Actions are only loaded by GetCase.
+type ModerationCase struct {
+	ID             int64              `json:"id"`
+	TargetType     string             `json:"target_type"`
+	TargetID       int64              `json:"target_id"`
+	TargetUserID   int64              `json:"target_user_id"`
+	Status         string             `json:"status"`
+	ReportCount    int64              `json:"report_count"`
+	AssigneeID     *int64             `json:"assignee_id,omitempty"`
+	ClaimedAt      *string            `json:"claimed_at,omitempty"`
+	Resolution     *string            `json:"resolution,omitempty"`
+	ResolutionNote string             `json:"resolution_note,omitempty"`
+	ResolvedAt     *string            `json:"resolved_at,omitempty"`
+	CreatedAt      string             `json:"created_at"`
+	UpdatedAt      string             `json:"updated_at"`
+	Reports        []Report           `json:"reports,omitempty"`
+	Actions        []ModerationAction `json:"actions,omitempty"`
+}
+
+// ContentHold asks for a post or comment to be held for review as part of
+// the statement saving it.
+type ContentHold struct {
+	Reason string
+}
+
+// ModerationAction is an entry of the audit trail of a case.
+type ModerationAction struct {
+	ID          int64  `json:"id"`
+	CaseID      int64  `json:"case_id"`
+	ModeratorID *int64 `json:"moderator_id,omitempty"`
+	Action      string `json:"action"`
+	Note        string `json:"note,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type ModerationStore struct {
+	db *sql.DB
+}
+
+// Report files a report, adding it to the unresolved case of its target or
+// opening one. A user can report a target once per case.
+func (s *ModerationStore) Report(ctx context.Context, report *Report) error {
+	ownerQuery := `
+		SELECT CASE $1
+			WHEN 'post' THEN (SELECT user_id FROM posts WHERE id = $2 AND status = 'published' AND deleted_at IS NULL)
+			WHEN 'comment' THEN (SELECT user_id FROM comments WHERE id = $2 AND deleted_at IS NULL)
+			WHEN 'user' THEN (SELECT id FROM users WHERE id = $2)
+		END
+	`
+
+	caseQuery := `
+		INSERT INTO moderation_cases (target_type, target_id, target_user_id, report_count)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (target_type, target_id) WHERE status <> 'resolved'
+		DO UPDATE SET report_count = moderation_cases.report_count + 1, updated_at = NOW()
+		RETURNING id
+	`
+
+	reportQuery := `
+		INSERT INTO reports (case_id, reporter_id, reason, details)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var ownerID sql.NullInt64
+		if err := tx.QueryRowContext(ctx, ownerQuery, report.TargetType, report.TargetID).Scan(&ownerID); err != nil {
+			return err
+		}
+
+		if !ownerID.Valid {
+			return ErrNotFound
+		}
+
+		if err := tx.QueryRowContext(
+			ctx,
+			caseQuery,
+			report.TargetType,
+			report.TargetID,
+			ownerID.Int64,
+		).Scan(&report.CaseID); err != nil {
+			return err
+		}
+
+		if err := tx.QueryRowContext(
+			ctx,
+			reportQuery,
+			report.CaseID,
+			report.ReporterID,
+			report.Reason,
+			report.Details,
+		).Scan(
+			&report.ID,
+			&report.CreatedAt,
+		); err != nil {
+			switch {
+			case strings.Contains(err.Error(), DuplicateReportErrMsg):
+				return ErrDuplicatedKey
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetCases lists the cases with the given status, most reported first.
+func (s *ModerationStore) GetCases(ctx context.Context, status string, page PaginatedQuery) ([]ModerationCase, error) {
+	query := `
+		SELECT id, target_type, target_id, target_user_id, status, report_count, assignee_id,
+		claimed_at, resolution, resolution_note, resolved_at, created_at, updated_at
+		FROM moderation_cases
+		WHERE status = $1
+		ORDER BY report_count DESC, created_at, id
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, status, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cases := make([]ModerationCase, 0)
+	for rows.Next() {
+		var c ModerationCase
+		if err := rows.Scan(
+			&c.ID,
+			&c.TargetType,
+			&c.TargetID,
+			&c.TargetUserID,
+			&c.Status,
+			&c.ReportCount,
+			&c.AssigneeID,
+			&c.ClaimedAt,
+			&c.Resolution,
+			&c.ResolutionNote,
+			&c.ResolvedAt,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cases = append(cases, c)
+	}
+
+	return cases, rows.Err()
+}
+
+// GetCase returns a case with its reports and audit trail.
+func (s *ModerationStore) GetCase(ctx context.Context, caseID int64) (ModerationCase, error) {
+	query := `
+		SELECT id, target_type, target_id, target_user_id, status, report_count, assignee_id,
+		claimed_at, resolution, resolution_note, resolved_at, created_at, updated_at
+		FROM moderation_cases
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var c ModerationCase
+	if err := s.db.QueryRowContext(ctx, query, caseID).Scan(
+		&c.ID,
+		&c.TargetType,
+		&c.TargetID,
+		&c.TargetUserID,
+		&c.Status,
+		&c.ReportCount,
+		&c.AssigneeID,
+		&c.ClaimedAt,
+		&c.Resolution,
+		&c.ResolutionNote,
+		&c.ResolvedAt,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ModerationCase{}, ErrNotFound
+		default:
+			return ModerationCase{}, err
+		}
+	}
+
+	reports, err := s.db.QueryContext(ctx, `
+		SELECT id, reporter_id, reason, details, created_at FROM reports
+		WHERE case_id = $1 ORDER BY created_at, id
+	`, caseID)
+	if err != nil {
+		return ModerationCase{}, err
+	}
+	defer reports.Close()
+
+	for reports.Next() {
+		r := Report{CaseID: c.ID, TargetType: c.TargetType, TargetID: c.TargetID}
+		if err := reports.Scan(&r.ID, &r.ReporterID, &r.Reason, &r.Details, &r.CreatedAt); err != nil {
+			return ModerationCase{}, err
+		}
+
+		c.Reports = append(c.Reports, r)
+	}
+	if err := reports.Err(); err != nil {
+		return ModerationCase{}, err
+	}
+
+	actions, err := s.db.QueryContext(ctx, `
+		SELECT id, moderator_id, action, note, created_at FROM moderation_actions
+		WHERE case_id = $1 ORDER BY created_at, id
+	`, caseID)
+	if err != nil {
+		return ModerationCase{}, err
+	}
+	defer actions.Close()
+
+	for actions.Next() {
+		a := ModerationAction{CaseID: c.ID}
+		if err := actions.Scan(&a.ID, &a.ModeratorID, &a.Action, &a.Note, &a.CreatedAt); err != nil {
+			return ModerationCase{}, err
+		}
+
+		c.Actions = append(c.Actions, a)
+	}
+
+	return c, actions.Err()
+}
+
+// Claim assigns an open case to the moderator.
+func (s *ModerationStore) Claim(ctx context.Context, caseID, moderatorID int64) error {
+	query := `
+		UPDATE moderation_cases
+		SET status = 'claimed', assignee_id = $2, claimed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'open'
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := execOne(ctx, tx, ErrCaseNotOpen, query, caseID, moderatorID); err != nil {
+			return err
+		}
+
+		return logModerationAction(ctx, tx, caseID, &moderatorID, ModerationActionClaim, "")
+	})
+}
+
+// Resolve closes a case claimed by the moderator with the given resolution
+// and applies it to the case's target in the same transaction: dismissing
+// releases content the filters held, hide and delete act on the post or
+// comment and suspend creates the suspension, which is required for it.
+// Warnings are left to the caller.
+func (s *ModerationStore) Resolve(ctx context.Context, caseID, moderatorID int64, resolution, note string, suspension *Suspension) error {
+	query := `
+		UPDATE moderation_cases
+		SET status = 'resolved', resolution = $3, resolution_note = $4, resolved_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'claimed' AND assignee_id = $2
+		RETURNING target_type, target_id
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var (
+			targetType string
+			targetID   int64
+		)
+		if err := tx.QueryRowContext(ctx, query, caseID, moderatorID, resolution, note).Scan(&targetType, &targetID); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrCaseNotClaimed
+			default:
+				return err
+			}
+		}
+
+		if err := applyResolution(ctx, tx, caseID, moderatorID, targetType, targetID, resolution, suspension); err != nil {
+			return err
+		}
+
+		return logModerationAction(ctx, tx, caseID, &moderatorID, resolution, note)
+	})
+}
+
+// applyResolution carries out a resolution on the target of a case within
+// tx. Content that is already gone is left alone.
+func applyResolution(ctx context.Context, tx *sql.Tx, caseID, moderatorID int64, targetType string, targetID int64, resolution string, suspension *Suspension) error {
+	var table string
+	switch targetType {
+	case ReportTargetPost:
+		table = "posts"
+	case ReportTargetComment:
+		table = "comments"
+	}
+
+	switch resolution {
+	case ResolutionDismiss:
+		if table == "" {
+			return nil
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE `+table+` SET hidden_at = NULL
+			WHERE id = $1 AND EXISTS (
+				SELECT 1 FROM moderation_actions WHERE case_id = $2 AND action = $3
+			)
+		`, targetID, caseID, ModerationActionHold)
+
+		return err
+
+	case ResolutionHide:
+		if table == "" {
+			return ErrInvalidResolution
+		}
+
+		_, err := tx.ExecContext(ctx, `UPDATE `+table+` SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = $1`, targetID)
+
+		return err
+
+	case ResolutionDelete:
+		var err error
+		switch targetType {
+		case ReportTargetPost:
+			err = deletePost(ctx, tx, targetID, moderatorID)
+		case ReportTargetComment:
+			err = setCommentDeleted(ctx, tx, deleteCommentQuery, -1, targetID, moderatorID)
+		default:
+			return ErrInvalidResolution
+		}
+
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+
+	case ResolutionSuspend:
+		if suspension == nil {
+			return ErrInvalidResolution
+		}
+
+		return createSuspension(ctx, tx, suspension)
+	}
+
+	return nil
+}
+
+// Hold hides a post or comment the content filters held and queues it for
+// review, opening a case for it or joining its unresolved one. It returns
+// when the content was hidden.
+func (s *ModerationStore) Hold(ctx context.Context, targetType string, targetID, targetUserID int64, reason string) (string, error) {
+	var hiddenAt string
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var err error
+		hiddenAt, err = holdContent(ctx, tx, targetType, targetID, targetUserID, reason)
+
+		return err
+	})
+
+	return hiddenAt, err
+}
+
+// holdContent hides a post or comment and queues it for review within tx.
+func holdContent(ctx context.Context, tx *sql.Tx, targetType string, targetID, targetUserID int64, reason string) (string, error) {
+	var hideQuery string
+	switch targetType {
+	case ReportTargetPost:
+		hideQuery = `UPDATE posts SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = $1 RETURNING hidden_at`
+	case ReportTargetComment:
+		hideQuery = `UPDATE comments SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = $1 RETURNING hidden_at`
+	default:
+		return "", ErrNotFound
+	}
+
+	caseQuery := `
+		INSERT INTO moderation_cases (target_type, target_id, target_user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (target_type, target_id) WHERE status <> 'resolved'
+		DO UPDATE SET updated_at = NOW()
+		RETURNING id
+	`
+
+	var hiddenAt string
+	if err := tx.QueryRowContext(ctx, hideQuery, targetID).Scan(&hiddenAt); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+
+	var caseID int64
+	if err := tx.QueryRowContext(ctx, caseQuery, targetType, targetID, targetUserID).Scan(&caseID); err != nil {
+		return "", err
+	}
+
+	return hiddenAt, logModerationAction(ctx, tx, caseID, nil, ModerationActionHold, reason)
+}
+
+// logModerationAction appends to the audit trail of a case. Actions taken
+// automatically have no moderator.
+func logModerationAction(ctx context.Context, tx *sql.Tx, caseID int64, moderatorID *int64, action, note string) error {
+	query := `
+		INSERT INTO moderation_actions (case_id, moderator_id, action, note)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err := tx.ExecContext(ctx, query, caseID, moderatorID, action, note)
+
+	return err
+}
+
+// execOne runs a statement that must change exactly one row, returning
+// errNone when it changed none.
+func execOne(ctx context.Context, tx *sql.Tx, errNone error, query string, args ...any) error {
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errNone
+	}
+
+	return nil
+}
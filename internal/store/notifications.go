@@ -0,0 +1,365 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const (
+	NotificationFollow   = "follow"
+	NotificationComment  = "comment"
+	NotificationReply    = "reply"
+	NotificationMention  = "mention"
+	NotificationReaction = "reaction"
+)
+
+var NotificationTypes = []string{
+	NotificationFollow,
+	NotificationComment,
+	NotificationReply,
+	NotificationMention,
+	NotificationReaction,
+}
+
+// notificationGroupActors is how many actors a notification group names.
+const notificationGroupActors = 3
+
+var ErrInvalidNotificationType = errors.New("unknown notification type")
+
+// Notification tells a user about something another user did. Repeating
+// the action does not add a notification but marks the existing one unread
+// again.
+type Notification struct {
+	ID        int64   `json:"id"`
+	UserID    int64   `json:"user_id"`
+	Type      string  `json:"type"`
+	ActorID   int64   `json:"actor_id"`
+	PostID    *int64  `json:"post_id,omitempty"`
+	CommentID *int64  `json:"comment_id,omitempty"`
+	GroupKey  string  `json:"group_key"`
+	ReadAt    *string `json:"read_at,omitempty"`
+	CreatedAt string  `json:"created_at"`
+}
+
+type NotificationActor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// NotificationGroup gathers the notifications of the same type about the
+// same target, like every reaction to a post. Its ID is the one of its
+// latest notification, and Actors lists the latest actors only.
+type NotificationGroup struct {
+	ID         int64               `json:"id"`
+	Type       string              `json:"type"`
+	PostID     *int64              `json:"post_id,omitempty"`
+	CommentID  *int64              `json:"comment_id,omitempty"`
+	Actors     []NotificationActor `json:"actors"`
+	ActorCount int64               `json:"actor_count"`
+	Message    string              `json:"message"`
+	Read       bool                `json:"read"`
+	LatestAt   string              `json:"latest_at"`
+}
+
+// PostGroupKey and CommentGroupKey group notifications by their target.
+func PostGroupKey(postID int64) string {
+	return fmt.Sprintf("post:%d", postID)
+}
+
+func CommentGroupKey(commentID int64) string {
+	return fmt.Sprintf("comment:%d", commentID)
+}
+
+// NotificationMessage describes a group, like "alice and 4 others reacted
+// to your post".
+func NotificationMessage(g *NotificationGroup) string {
+	var actors string
+	switch {
+	case len(g.Actors) == 0:
+		actors = "Someone"
+	case g.ActorCount <= 1:
+		actors = g.Actors[0].Username
+	case g.ActorCount == 2 && len(g.Actors) >= 2:
+		actors = g.Actors[0].Username + " and " + g.Actors[1].Username
+	case g.ActorCount == 2:
+		actors = g.Actors[0].Username + " and 1 other"
+	default:
+		actors = fmt.Sprintf("%s and %d others", g.Actors[0].Username, g.ActorCount-1)
+	}
+
+	switch g.Type {
+	case NotificationFollow:
+		return actors + " started following you"
+	case NotificationComment:
+		return actors + " commented on your post"
+	case NotificationReply:
+		return actors + " replied to your comment"
+	case NotificationMention:
+		return actors + " mentioned you"
+	case NotificationReaction:
+		return actors + " reacted to your post"
+	default:
+		return actors
+	}
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// Create notifies the user, unless they are the actor or turned the type
+// off, in which case n.ID stays zero. A notification is dated n.CreatedAt
+// when it is set, or now. A repeated action renews the notification of the
+// previous one as unread, unless that is as recent: then n.ID stays zero
+// too, so creating the notification of the same action again is a no-op.
+func (s *NotificationStore) Create(ctx context.Context, n *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, type, actor_id, post_id, comment_id, group_key, created_at)
+		SELECT $1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, '')::timestamptz, NOW())
+		WHERE $1 <> $3 AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences
+			WHERE user_id = $1 AND type = $2 AND NOT enabled
+		)
+		ON CONFLICT (user_id, type, actor_id, group_key) DO UPDATE
+		SET post_id = EXCLUDED.post_id, comment_id = EXCLUDED.comment_id, read_at = NULL, created_at = EXCLUDED.created_at
+		WHERE notifications.created_at < EXCLUDED.created_at
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		n.UserID,
+		n.Type,
+		n.ActorID,
+		n.PostID,
+		n.CommentID,
+		n.GroupKey,
+		n.CreatedAt,
+	).Scan(&n.ID, &n.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	return nil
+}
+
+// Remove withdraws the notification of an action that was undone.
+func (s *NotificationStore) Remove(ctx context.Context, userID int64, notificationType string, actorID int64, groupKey string) error {
+	query := `
+		DELETE FROM notifications
+		WHERE user_id = $1 AND type = $2 AND actor_id = $3 AND group_key = $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, notificationType, actorID, groupKey)
+
+	return err
+}
+
+// GetGroups fetches the notification groups of the user, latest first.
+// Read and unread notifications of a target make separate groups.
+func (s *NotificationStore) GetGroups(ctx context.Context, userID int64, unreadOnly bool, page PaginatedQuery) ([]NotificationGroup, error) {
+	query := `
+		WITH groups AS (
+			SELECT n.type, n.group_key, n.read_at IS NOT NULL AS read,
+			MAX(n.id) AS id, MAX(n.created_at) AS latest_at, COUNT(*) AS actor_count,
+			(array_agg(u.id ORDER BY n.created_at DESC, n.id DESC))[1:$5] AS actor_ids,
+			(array_agg(u.username ORDER BY n.created_at DESC, n.id DESC))[1:$5] AS actor_names
+			FROM notifications n
+			JOIN users u ON u.id = n.actor_id
+			WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+			GROUP BY n.type, n.group_key, n.read_at IS NOT NULL
+		)
+		SELECT g.id, g.type, n.post_id, n.comment_id, g.read, g.latest_at, g.actor_count,
+		g.actor_ids, g.actor_names
+		FROM groups g
+		JOIN notifications n ON n.id = g.id
+		ORDER BY g.latest_at DESC, g.id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, unreadOnly, page.Limit, page.Offset, notificationGroupActors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []NotificationGroup{}
+	for rows.Next() {
+		var (
+			g     NotificationGroup
+			ids   pq.Int64Array
+			names pq.StringArray
+		)
+		if err := rows.Scan(
+			&g.ID,
+			&g.Type,
+			&g.PostID,
+			&g.CommentID,
+			&g.Read,
+			&g.LatestAt,
+			&g.ActorCount,
+			&ids,
+			&names,
+		); err != nil {
+			return nil, err
+		}
+
+		for i := range ids {
+			g.Actors = append(g.Actors, NotificationActor{ID: ids[i], Username: names[i]})
+		}
+		g.Message = NotificationMessage(&g)
+
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+// GetUnreadCounts counts the unread notifications of the user by type.
+// Types without unread notifications are left out.
+func (s *NotificationStore) GetUnreadCounts(ctx context.Context, userID int64) (map[string]int64, error) {
+	query := `
+		SELECT type, COUNT(*) FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL
+		GROUP BY type
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{}
+	for rows.Next() {
+		var (
+			notificationType string
+			count            int64
+		)
+		if err := rows.Scan(&notificationType, &count); err != nil {
+			return nil, err
+		}
+
+		counts[notificationType] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// MarkRead marks the group of one of the user's notifications as read.
+func (s *NotificationStore) MarkRead(ctx context.Context, userID, notificationID int64) error {
+	query := `
+		WITH target AS (
+			SELECT type, group_key FROM notifications WHERE id = $2 AND user_id = $1
+		), updated AS (
+			UPDATE notifications n SET read_at = NOW()
+			FROM target t
+			WHERE n.user_id = $1 AND n.type = t.type AND n.group_key = t.group_key AND n.read_at IS NULL
+		)
+		SELECT COUNT(*) FROM target
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var found int
+	if err := s.db.QueryRowContext(ctx, query, userID, notificationID).Scan(&found); err != nil {
+		return err
+	}
+
+	if found == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every notification of the user as read, returning how
+// many were unread.
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// GetPreferences tells for every notification type whether the user gets
+// it. Types are on until turned off.
+func (s *NotificationStore) GetPreferences(ctx context.Context, userID int64) (map[string]bool, error) {
+	query := `SELECT type, enabled FROM notification_preferences WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+
+	for rows.Next() {
+		var (
+			notificationType string
+			enabled          bool
+		)
+		if err := rows.Scan(&notificationType, &enabled); err != nil {
+			return nil, err
+		}
+
+		prefs[notificationType] = enabled
+	}
+
+	return prefs, rows.Err()
+}
+
+// SetPreferences turns the given notification types on or off, leaving the
+// others as they are.
+func (s *NotificationStore) SetPreferences(ctx context.Context, userID int64, prefs map[string]bool) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, type, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		for notificationType, enabled := range prefs {
+			if _, err := tx.ExecContext(ctx, query, userID, notificationType, enabled); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,31 @@
+package store
+
+import "testing"
+
+func TestNotificationMessage(t *testing.T) {
+	alice := NotificationActor{ID: 1, Username: "alice"}
+	bob := NotificationActor{ID: 2, Username: "bob"}
+	carol := NotificationActor{ID: 3, Username: "carol"}
+
+	tests := []struct {
+		group NotificationGroup
+		want  string
+	}{
+		{NotificationGroup{Type: NotificationFollow, Actors: []NotificationActor{alice}, ActorCount: 1},
+			"alice started following you"},
+		{NotificationGroup{Type: NotificationComment, Actors: []NotificationActor{alice, bob}, ActorCount: 2},
+			"alice and bob commented on your post"},
+		{NotificationGroup{Type: NotificationReaction, Actors: []NotificationActor{carol, bob, alice}, ActorCount: 5},
+			"carol and 4 others reacted to your post"},
+		{NotificationGroup{Type: NotificationReply, Actors: []NotificationActor{bob}, ActorCount: 2},
+			"bob and 1 other replied to your comment"},
+		{NotificationGroup{Type: NotificationMention, ActorCount: 0},
+			"Someone mentioned you"},
+	}
+
+	for _, tt := range tests {
+		if got := NotificationMessage(&tt.group); got != tt.want {
+			t.Errorf("NotificationMessage(%+v) = %q, want %q", tt.group, got, tt.want)
+		}
+	}
+}
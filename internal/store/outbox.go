@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OutboxUserRegistered = "user.registered"
+	OutboxUserFollowed   = "user.followed"
+	OutboxUserUnfollowed = "user.unfollowed"
+	OutboxPostPublished  = "post.published"
+	OutboxPostRemoved    = "post.removed"
+)
+
+// PostMessage is the outbox payload of the post events, written by the post
+// store whenever a post or repost becomes visible or goes away.
+type PostMessage struct {
+	PostID int64 `json:"post_id"`
+	UserID int64 `json:"user_id"`
+	// SharedID is the post a removed repost shared, so its timeline entries
+	// can be found without scanning the timelines.
+	SharedID int64 `json:"shared_id,omitempty"`
+}
+
+// OutboxEvent is a side effect of a change, written in the transaction of
+// the change and relayed to its consumers afterwards, at least once.
+type OutboxEvent struct {
+	ID       int64
+	Key      string
+	Type     string
+	Payload  json.RawMessage
+	Attempts int
+	// CreatedAt is when the event was written, the time of what it records.
+	CreatedAt string
+
+	data any
+}
+
+// NewOutboxEvent builds an event with a new idempotency key. The payload is
+// marshaled when the event is written, so it may point at what the same
+// transaction creates, like the ID of a new user.
+func NewOutboxEvent(eventType string, payload any) *OutboxEvent {
+	return &OutboxEvent{Key: uuid.New().String(), Type: eventType, data: payload}
+}
+
+// addOutboxEvents writes the events in the transaction of the change they
+// are about.
+func addOutboxEvents(ctx context.Context, tx *sql.Tx, events []*OutboxEvent) error {
+	query := `
+		INSERT INTO outbox_events (idempotency_key, type, payload)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	for _, e := range events {
+		payload, err := json.Marshal(e.data)
+		if err != nil {
+			return err
+		}
+		e.Payload = payload
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		err = tx.QueryRowContext(ctx, query, e.Key, e.Type, payload).Scan(&e.ID)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addPostEvent writes a post event in the transaction that published or
+// removed the post.
+func addPostEvent(ctx context.Context, tx *sql.Tx, eventType string, postID, userID int64) error {
+	return addOutboxEvents(ctx, tx, []*OutboxEvent{NewOutboxEvent(eventType, PostMessage{PostID: postID, UserID: userID})})
+}
+
+// addPostRemovedEvent writes the removal of a post, or of a repost of
+// sharedID, in the transaction that removed it.
+func addPostRemovedEvent(ctx context.Context, tx *sql.Tx, postID, sharedID, userID int64) error {
+	msg := PostMessage{PostID: postID, UserID: userID, SharedID: sharedID}
+
+	return addOutboxEvents(ctx, tx, []*OutboxEvent{NewOutboxEvent(OutboxPostRemoved, msg)})
+}
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// ClaimDue returns up to limit pending events that are due, oldest first,
+// hiding them from other claims for lease.
+func (s *OutboxStore) ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM outbox_events
+			WHERE status = 'pending' AND available_at <= $1
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox_events o
+		SET available_at = $3
+		FROM due
+		WHERE o.id = due.id
+		RETURNING o.id, o.idempotency_key, o.type, o.payload, o.attempts, o.created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, now, limit, now.Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.Key, &e.Type, &e.Payload, &e.Attempts, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// GetConsumers returns the consumers that already handled the event.
+func (s *OutboxStore) GetConsumers(ctx context.Context, key string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT consumer FROM outbox_consumptions WHERE idempotency_key = $1`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consumers := make(map[string]bool)
+	for rows.Next() {
+		var consumer string
+		if err := rows.Scan(&consumer); err != nil {
+			return nil, err
+		}
+
+		consumers[consumer] = true
+	}
+
+	return consumers, rows.Err()
+}
+
+// MarkConsumed records that the consumer handled the event.
+func (s *OutboxStore) MarkConsumed(ctx context.Context, key, consumer string) error {
+	query := `
+		INSERT INTO outbox_consumptions (idempotency_key, consumer)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, key, consumer)
+
+	return err
+}
+
+// Complete marks the event as handled by every consumer.
+func (s *OutboxStore) Complete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `UPDATE outbox_events SET status = 'done', processed_at = NOW() WHERE id = $1`, id)
+
+	return err
+}
+
+// Fail records a failed attempt and schedules the event again at retryAt,
+// or gives up on it when retryAt is nil.
+func (s *OutboxStore) Fail(ctx context.Context, id int64, reason string, retryAt *time.Time) error {
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $2,
+		status = CASE WHEN $3::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+		available_at = COALESCE($3, available_at),
+		processed_at = CASE WHEN $3::timestamptz IS NULL THEN NOW() END
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, reason, retryAt)
+
+	return err
+}
+
+// Purge deletes up to limit events handled or given up on before the given
+// time, with their payloads.
+func (s *OutboxStore) Purge(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM outbox_events
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE status IN ('done', 'dead') AND processed_at < $1
+			LIMIT $2
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
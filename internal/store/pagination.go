@@ -1,12 +1,151 @@
 package store
 
 import (
+	"encoding/base64"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type PaginatedQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=50"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+func (p PaginatedQuery) Parse(r *http.Request) (PaginatedQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return p, err
+		}
+
+		p.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return p, err
+		}
+
+		p.Offset = o
+	}
+
+	return p, nil
+}
+
+// CursorQuery pages through a list ordered by creation time. The cursor is
+// opaque to clients and points right after the last item they received.
+type CursorQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor"`
+	Sort   string `json:"sort" validate:"oneof=new old top"`
+}
+
+func (q CursorQuery) Parse(r *http.Request) (CursorQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	if cursor := qs.Get("cursor"); cursor != "" {
+		q.Cursor = cursor
+	}
+
+	if sort := qs.Get("sort"); sort != "" {
+		q.Sort = sort
+	}
+
+	return q, nil
+}
+
+func encodeCursor(createdAt string, id int64) string {
+	raw := createdAt + "|" + strconv.FormatInt(id, 10)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor returns the creation time and id a cursor points at. An empty
+// cursor decodes to nil values, meaning the first page.
+func decodeCursor(cursor string) (*string, *int64, error) {
+	if cursor == "" {
+		return nil, nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	createdAt, idPart, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	if _, err := time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	return &createdAt, &id, nil
+}
+
+// encodeRankCursor points at an offset into a ranking computed at rankedAt.
+func encodeRankCursor(rankedAt time.Time, offset int) string {
+	raw := "rank|" + strconv.FormatInt(rankedAt.Unix(), 10) + "|" + strconv.Itoa(offset)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeRankCursor returns the ranking time and offset of a rank cursor. An
+// empty cursor starts a new ranking at the current time.
+func decodeRankCursor(cursor string) (time.Time, int, error) {
+	if cursor == "" {
+		return time.Now().Truncate(time.Second), 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != "rank" {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+
+	offset, err := strconv.Atoi(parts[2])
+	if err != nil || offset < 0 {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+
+	return time.Unix(unix, 0), offset, nil
+}
+
 type PaginatedFeedQuery struct {
 	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
 	Offset int      `json:"offset" validate:"gte=0"`
@@ -15,6 +154,7 @@ type PaginatedFeedQuery struct {
 	Search string   `json:"search" validate:"max=100"`
 	Since  string   `json:"since"`
 	Until  string   `json:"until"`
+	Mode   string   `json:"mode" validate:"oneof=chronological ranked"`
 }
 
 func (p PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -65,6 +205,11 @@ func (p PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
 		p.Until = parseTime(until)
 	}
 
+	mode := qs.Get("mode")
+	if mode != "" {
+		p.Mode = mode
+	}
+
 	return p, nil
 }
 
@@ -5,10 +5,26 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"social/internal/entities"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+var (
+	ErrPinLimitReached = errors.New("pinned posts limit reached")
+
+	DuplicateRepostErrMsg = `pq: duplicate key value violates unique constraint "idx_posts_user_repost`
+)
+
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+	PostStatusArchived  = "archived"
+)
+
 type Post struct {
 	ID        int64    `json:"id"`
 	Content   string   `json:"content"`
@@ -18,14 +34,50 @@ type Post struct {
 	CreatedAt string   `json:"created_at"`
 	UpdatedAt string   `json:"updated_at"`
 	// TODO implementar lock no database
-	Version  int       `json:"version"`
-	Comments []Comment `json:"comments"`
-	Username string    `json:"username"`
+	Version            int               `json:"version"`
+	Comments           []Comment         `json:"comments"`
+	CommentsNextCursor string            `json:"comments_next_cursor,omitempty"`
+	Username           string            `json:"username"`
+	Status             string            `json:"status"`
+	PublishAt          *string           `json:"publish_at,omitempty"`
+	Reactions          ReactionCounts    `json:"reactions"`
+	ViewerReaction     string            `json:"viewer_reaction,omitempty"`
+	RepostOfID         *int64            `json:"repost_of_id,omitempty"`
+	QuoteOfID          *int64            `json:"quote_of_id,omitempty"`
+	RepostCount        int64             `json:"repost_count"`
+	QuoteCount         int64             `json:"quote_count"`
+	Original           *Post             `json:"original,omitempty"`
+	Bookmarked         bool              `json:"bookmarked"`
+	PinnedAt           *string           `json:"pinned_at,omitempty"`
+	Entities           []entities.Entity `json:"entities,omitempty"`
+	Language           string            `json:"language,omitempty"`
+	HiddenAt           *string           `json:"hidden_at,omitempty"`
+	DeletedAt          *string           `json:"deleted_at,omitempty"`
+	DeletedBy          *int64            `json:"deleted_by,omitempty"`
+}
+
+// SharedPostID returns the post a repost points to, or the post itself.
+func (p *Post) SharedPostID() int64 {
+	if p.RepostOfID != nil {
+		return *p.RepostOfID
+	}
+
+	return p.ID
 }
 
 type PostWithMetadata struct {
 	Post
-	CommentCount int64 `json:"comment_count" `
+	CommentCount int64              `json:"comment_count" `
+	RepostedBy   *RepostAttribution `json:"reposted_by,omitempty"`
+}
+
+// RepostAttribution tells a feed reader which followed user brought a post
+// into their feed.
+type RepostAttribution struct {
+	RepostID   int64  `json:"repost_id"`
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username"`
+	RepostedAt string `json:"reposted_at"`
 }
 
 type PostStore struct {
@@ -34,33 +86,129 @@ type PostStore struct {
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	query := `
-		INSERT INTO posts (content, title, user_id, tags, version)
-		VALUES ($1, $2, $3, $4, 0) RETURNING id, created_at, updated_at
+		INSERT INTO posts (content, title, user_id, tags, version, status, publish_at, quote_of_id, search_language)
+		VALUES ($1, $2, $3, $4, 0, $5, COALESCE($6::timestamptz, CASE WHEN $5 = 'published' THEN NOW() END), $7, $8::regconfig)
+		RETURNING id, created_at, updated_at, publish_at
 		`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+	if post.Language == "" {
+		post.Language = DefaultSearchLanguage
+	}
 
-	if err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Content,
-		post.Title,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	); err != nil {
-		return err
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Content,
+			post.Title,
+			post.UserID,
+			pq.Array(post.Tags),
+			post.Status,
+			post.PublishAt,
+			post.QuoteOfID,
+			post.Language,
+		).Scan(
+			&post.ID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.PublishAt,
+		); err != nil {
+			return err
+		}
+
+		post.Entities = entities.Parse(post.Content)
+
+		if post.QuoteOfID != nil {
+			if _, err := tx.ExecContext(ctx, `UPDATE posts SET quote_count = quote_count + 1 WHERE id = $1`, *post.QuoteOfID); err != nil {
+				return err
+			}
+		}
+
+		if post.Status != PostStatusPublished {
+			return nil
+		}
+
+		return addPostEvent(ctx, tx, OutboxPostPublished, post.ID, post.UserID)
+	})
+}
+
+// Repost shares an existing post as the given user. A user can repost the
+// same post only once.
+func (s *PostStore) Repost(ctx context.Context, postID, userID int64) (Post, error) {
+	query := `
+		INSERT INTO posts (content, title, user_id, version, status, publish_at, repost_of_id)
+		VALUES ('', '', $1, 0, 'published', NOW(), $2)
+		ON CONFLICT (user_id, repost_of_id) WHERE repost_of_id IS NOT NULL AND deleted_at IS NULL DO NOTHING
+		RETURNING id, created_at, updated_at, publish_at
+	`
+
+	repost := Post{
+		UserID:     userID,
+		Status:     PostStatusPublished,
+		RepostOfID: &postID,
 	}
 
-	return nil
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := tx.QueryRowContext(ctx, query, userID, postID).Scan(
+			&repost.ID,
+			&repost.CreatedAt,
+			&repost.UpdatedAt,
+			&repost.PublishAt,
+		); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrDuplicatedKey
+			default:
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE posts SET repost_count = repost_count + 1 WHERE id = $1`, postID); err != nil {
+			return err
+		}
+
+		return addPostEvent(ctx, tx, OutboxPostPublished, repost.ID, userID)
+	})
+	if err != nil {
+		return Post{}, err
+	}
+
+	return repost, nil
+}
+
+func (s *PostStore) Unrepost(ctx context.Context, postID, userID int64) error {
+	query := `DELETE FROM posts WHERE user_id = $1 AND repost_of_id = $2 AND deleted_at IS NULL RETURNING id`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var repostID int64
+		if err := tx.QueryRowContext(ctx, query, userID, postID).Scan(&repostID); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE posts SET repost_count = GREATEST(repost_count - 1, 0) WHERE id = $1`, postID); err != nil {
+			return err
+		}
+
+		return addPostRemovedEvent(ctx, tx, repostID, postID, userID)
+	})
 }
 
 func (s *PostStore) GetById(ctx context.Context, postID int64) (Post, error) {
-	query := fmt.Sprintf("SELECT content, title, user_id, tags, created_at, updated_at, version FROM posts WHERE id = '%d'", postID)
+	query := fmt.Sprintf("SELECT content, title, user_id, tags, created_at, updated_at, version, status, publish_at, repost_of_id, quote_of_id, repost_count, quote_count, pinned_at, search_language::text, hidden_at, deleted_at, deleted_by FROM posts WHERE id = '%d'", postID)
 	var p Post
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -77,6 +225,17 @@ func (s *PostStore) GetById(ctx context.Context, postID int64) (Post, error) {
 		&p.CreatedAt,
 		&p.UpdatedAt,
 		&p.Version,
+		&p.Status,
+		&p.PublishAt,
+		&p.RepostOfID,
+		&p.QuoteOfID,
+		&p.RepostCount,
+		&p.QuoteCount,
+		&p.PinnedAt,
+		&p.Language,
+		&p.HiddenAt,
+		&p.DeletedAt,
+		&p.DeletedBy,
 	); err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -87,51 +246,36 @@ func (s *PostStore) GetById(ctx context.Context, postID int64) (Post, error) {
 	}
 	p.ID = postID
 
+	p.Entities = entities.Parse(p.Content)
+
 	return p, nil
 }
 
-func (s *PostStore) Delete(ctx context.Context, id int64) (int64, error) {
-	query := "DELETE FROM posts WHERE id = $1"
-
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+// Delete soft-deletes a post, which disappears everywhere until it is
+// restored or purged. Its comments stay attached so a restore brings them
+// back.
+func (s *PostStore) Delete(ctx context.Context, id, deletedBy int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
 
-	result, err := s.db.ExecContext(ctx, query, id)
-	if err != nil {
-		return 0, err
-	}
-
-	return result.RowsAffected()
+		return deletePost(ctx, tx, id, deletedBy)
+	})
 }
 
-func (s *PostStore) Update(ctx context.Context, newPost *Post) error {
+// deletePost soft-deletes a post within tx.
+func deletePost(ctx context.Context, tx *sql.Tx, id, deletedBy int64) error {
 	query := `
-		UPDATE posts 
-		SET title = $2,
-		content = $3,
-		tags = $4,
-		version = version + 1
-		WHERE id = $1 AND version = $5
-		RETURNING title, content, tags, version;
+		UPDATE posts SET deleted_at = NOW(), deleted_by = $2
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING user_id, repost_of_id, quote_of_id
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
-	if err := s.db.QueryRowContext(
-		ctx,
-		query,
-		newPost.ID,
-		newPost.Title,
-		newPost.Content,
-		pq.Array(newPost.Tags),
-		newPost.Version,
-	).Scan(
-		&newPost.Title,
-		&newPost.Content,
-		pq.Array(&newPost.Tags),
-		&newPost.Version,
-	); err != nil {
+	var (
+		userID            int64
+		repostOf, quoteOf *int64
+	)
+	if err := tx.QueryRowContext(ctx, query, id, deletedBy).Scan(&userID, &repostOf, &quoteOf); err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrNotFound
@@ -140,29 +284,261 @@ func (s *PostStore) Update(ctx context.Context, newPost *Post) error {
 		}
 	}
 
+	if err := adjustShareCounts(ctx, tx, repostOf, quoteOf, -1); err != nil {
+		return err
+	}
+
+	sharedID := id
+	if repostOf != nil {
+		sharedID = *repostOf
+	}
+
+	return addPostRemovedEvent(ctx, tx, id, sharedID, userID)
+}
+
+// Restore undoes the soft-deletion of a post.
+func (s *PostStore) Restore(ctx context.Context, id int64) error {
+	query := `
+		UPDATE posts SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING user_id, status, hidden_at IS NOT NULL, repost_of_id, quote_of_id
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var (
+			userID            int64
+			status            string
+			hidden            bool
+			repostOf, quoteOf *int64
+		)
+		if err := tx.QueryRowContext(ctx, query, id).Scan(&userID, &status, &hidden, &repostOf, &quoteOf); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			case strings.Contains(err.Error(), DuplicateRepostErrMsg):
+				return ErrDuplicatedKey
+			default:
+				return err
+			}
+		}
+
+		if err := adjustShareCounts(ctx, tx, repostOf, quoteOf, 1); err != nil {
+			return err
+		}
+
+		if status != PostStatusPublished || hidden {
+			return nil
+		}
+
+		return addPostEvent(ctx, tx, OutboxPostPublished, id, userID)
+	})
+}
+
+// adjustShareCounts moves the repost and quote counts of the posts a post
+// shares by delta.
+func adjustShareCounts(ctx context.Context, tx *sql.Tx, repostOf, quoteOf *int64, delta int) error {
+	if repostOf != nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE posts SET repost_count = GREATEST(repost_count + $2, 0) WHERE id = $1`, *repostOf, delta); err != nil {
+			return err
+		}
+	}
+
+	if quoteOf != nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE posts SET quote_count = GREATEST(quote_count + $2, 0) WHERE id = $1`, *quoteOf, delta); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Purge permanently removes up to limit posts deleted before the given time,
+// along with their comments, and returns how many posts it removed.
+func (s *PostStore) Purge(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		SELECT id FROM posts
+		WHERE deleted_at < $1
+		ORDER BY deleted_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+
+	var purged int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, query, before, limit)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE post_id = ANY($1)`, pq.Array(ids)); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE id = ANY($1)`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		purged, err = result.RowsAffected()
+
+		return err
+	})
+
+	return purged, err
+}
+
+// Update saves an edit of the post when its version still matches, holding
+// it for review in the same transaction when hold is set. A post that
+// becomes published through the edit is announced like a new one.
+func (s *PostStore) Update(ctx context.Context, newPost *Post, hold *ContentHold) error {
+	query := `
+		UPDATE posts p
+		SET title = $2,
+		content = $3,
+		tags = $4,
+		status = $6,
+		publish_at = COALESCE($7::timestamptz, CASE WHEN $6 = 'published' THEN NOW() END),
+		search_language = $8::regconfig,
+		updated_at = NOW(),
+		version = p.version + 1
+		FROM posts old
+		WHERE p.id = $1 AND p.version = $5 AND old.id = p.id
+		RETURNING p.title, p.content, p.tags, p.version, p.status, p.publish_at,
+		old.status <> 'published' AND p.status = 'published' AND p.hidden_at IS NULL AND p.deleted_at IS NULL;
+	`
+
+	if newPost.Language == "" {
+		newPost.Language = DefaultSearchLanguage
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var published bool
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			newPost.ID,
+			newPost.Title,
+			newPost.Content,
+			pq.Array(newPost.Tags),
+			newPost.Version,
+			newPost.Status,
+			newPost.PublishAt,
+			newPost.Language,
+		).Scan(
+			&newPost.Title,
+			&newPost.Content,
+			pq.Array(&newPost.Tags),
+			&newPost.Version,
+			&newPost.Status,
+			&newPost.PublishAt,
+			&published,
+		); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		newPost.Entities = entities.Parse(newPost.Content)
+
+		if hold != nil {
+			hiddenAt, err := holdContent(ctx, tx, ReportTargetPost, newPost.ID, newPost.UserID, hold.Reason)
+			if err != nil {
+				return err
+			}
+
+			newPost.HiddenAt = &hiddenAt
+			return nil
+		}
+
+		if !published {
+			return nil
+		}
+
+		return addPostEvent(ctx, tx, OutboxPostPublished, newPost.ID, newPost.UserID)
+	})
+}
+
+// feedColumns selects a feed item from an activity CTE made of post_id,
+// activity_id, actor_id, is_repost and activity_at. The viewer is $1.
+const feedColumns = `
+		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.tags, p.status, p.publish_at,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comments_count, u.username,
+		(
+			SELECT jsonb_object_agg(rc.kind, rc.count) FROM post_reaction_counts rc
+			WHERE rc.post_id = p.id AND rc.count > 0
+		) AS reactions,
+		COALESCE((SELECT pr.kind FROM post_reactions pr WHERE pr.post_id = p.id AND pr.user_id = $1), '') AS viewer_reaction,
+		p.quote_of_id, p.repost_count, p.quote_count,
+		EXISTS (SELECT 1 FROM bookmarks b WHERE b.post_id = p.id AND b.user_id = $1) AS bookmarked,
+		act.is_repost, act.activity_id, act.actor_id, ru.username, act.activity_at
+		FROM activity act
+		JOIN posts p ON p.id = act.post_id
+		LEFT JOIN users u ON u.id = p.user_id
+		LEFT JOIN users ru ON ru.id = act.actor_id
+`
+
+// GetUserFeed returns the published posts and reposts of the user, of the
+// users they follow and of the tags they follow. A post reposted several
+// times, or both posted and reposted by followed users, shows up once at its
+// latest activity.
 func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
 	query := `
-		select p.id, p.user_id, p.title, p.content, p.created_at, p.tags, 
-		COUNT(c.id) as comments_count, u.username
-		from posts p
-		left join comments c on c.post_id = p.id
-		left join users u on u.id = p.user_id
-		join followers f on f.follower_id = p.user_id or p.user_id = $1
-		where 
-			f.follower_id = $1 or p.user_id = $1 AND
+		WITH activity AS (
+			SELECT DISTINCT ON (COALESCE(a.repost_of_id, a.id))
+				COALESCE(a.repost_of_id, a.id) AS post_id,
+				a.id AS activity_id,
+				a.user_id AS actor_id,
+				a.repost_of_id IS NOT NULL AS is_repost,
+				a.publish_at AS activity_at
+			FROM posts a
+			WHERE
+				a.status = 'published' AND a.hidden_at IS NULL AND a.deleted_at IS NULL AND
+				(
+					a.user_id = $1 OR
+					a.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1) OR
+					(a.repost_of_id IS NULL AND a.tags && ARRAY(SELECT tag FROM tag_follows WHERE user_id = $1)::varchar(100)[])
+				)
+			ORDER BY COALESCE(a.repost_of_id, a.id), a.publish_at DESC
+		)` + feedColumns + `
+		WHERE
+			p.status = 'published' AND p.hidden_at IS NULL AND p.deleted_at IS NULL AND
 			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
 			(p.tags @> $5 OR $5 = '{}')
-		group by p.id, u.id
-		order by p.created_at ` + fq.Sort + `
-		limit $2 offset $3;
+		ORDER BY act.activity_at ` + fq.Sort + `
+		LIMIT $2 OFFSET $3;
 	`
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
 
-	rows, err := s.db.QueryContext(
+	return s.queryFeed(
 		ctx,
 		query,
 		userId,
@@ -171,17 +547,55 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedF
 		fq.Search,
 		pq.Array(fq.Tags),
 	)
+}
+
+// GetFeedByIDs loads feed items from post and repost ids, keeping their
+// order. Ids of posts that were deleted or unpublished are skipped.
+func (s *PostStore) GetFeedByIDs(ctx context.Context, viewerID int64, ids []int64) ([]PostWithMetadata, error) {
+	query := `
+		WITH activity AS (
+			SELECT
+				COALESCE(a.repost_of_id, a.id) AS post_id,
+				a.id AS activity_id,
+				a.user_id AS actor_id,
+				a.repost_of_id IS NOT NULL AS is_repost,
+				a.publish_at AS activity_at,
+				t.ord
+			FROM unnest($2::bigint[]) WITH ORDINALITY AS t(id, ord)
+			JOIN posts a ON a.id = t.id
+			WHERE a.status = 'published' AND a.hidden_at IS NULL AND a.deleted_at IS NULL
+		)` + feedColumns + `
+		WHERE p.status = 'published' AND p.hidden_at IS NULL AND p.deleted_at IS NULL
+		ORDER BY act.ord;
+	`
+
+	if len(ids) == 0 {
+		return make([]PostWithMetadata, 0), nil
+	}
+
+	return s.queryFeed(ctx, query, viewerID, pq.Array(ids))
+}
+
+func (s *PostStore) queryFeed(ctx context.Context, query string, args ...any) ([]PostWithMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var (
-		feed = make([]PostWithMetadata, 0)
-		p    = PostWithMetadata{}
-	)
+	feed := make([]PostWithMetadata, 0)
 
 	for rows.Next() {
+		var (
+			p            PostWithMetadata
+			isRepost     bool
+			attribution  RepostAttribution
+			repostedName sql.NullString
+		)
+
 		if err := rows.Scan(
 			&p.ID,
 			&p.UserID,
@@ -189,14 +603,495 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedF
 			&p.Content,
 			&p.CreatedAt,
 			pq.Array(&p.Tags),
+			&p.Status,
+			&p.PublishAt,
 			&p.CommentCount,
 			&p.Username,
+			&p.Reactions,
+			&p.ViewerReaction,
+			&p.QuoteOfID,
+			&p.RepostCount,
+			&p.QuoteCount,
+			&p.Bookmarked,
+			&isRepost,
+			&attribution.RepostID,
+			&attribution.UserID,
+			&repostedName,
+			&attribution.RepostedAt,
 		); err != nil {
 			return nil, err
 		}
 
+		p.Entities = entities.Parse(p.Content)
+
+		if isRepost {
+			attribution.Username = repostedName.String
+			p.RepostedBy = &attribution
+		}
+
 		feed = append(feed, p)
 	}
 
-	return feed, nil
+	return feed, rows.Err()
+}
+
+// TimelineEntry is a post or repost id placed on a timeline at the Unix
+// time of its activity. SharedID is the post a repost shares, or the post
+// itself; a timeline lists each shared post once, at its latest activity.
+type TimelineEntry struct {
+	PostID   int64
+	SharedID int64
+	Score    float64
+}
+
+// Timeline sources. Pushed entries come from the user and the followed
+// authors with fewer than the fan-out threshold of followers, and are
+// written to the cached timelines when posted. Pulled entries come from the
+// larger followed authors and from followed tags, and are read at request
+// time.
+const (
+	TimelinePushed = "pushed"
+	TimelinePulled = "pulled"
+)
+
+// GetTimelineEntries returns the latest entries of one timeline source, one
+// per shared post.
+func (s *PostStore) GetTimelineEntries(ctx context.Context, userID int64, source string, threshold, limit int) ([]TimelineEntry, error) {
+	authors := `
+		a.user_id = $1 OR a.user_id IN (
+			SELECT f.user_id FROM followers f JOIN users u ON u.id = f.user_id
+			WHERE f.follower_id = $1 AND u.follower_count < $2
+		)
+	`
+	if source == TimelinePulled {
+		authors = `
+			a.user_id IN (
+				SELECT f.user_id FROM followers f JOIN users u ON u.id = f.user_id
+				WHERE f.follower_id = $1 AND u.follower_count >= $2
+			) OR (
+				a.repost_of_id IS NULL AND a.user_id <> $1 AND
+				a.tags && ARRAY(SELECT tag FROM tag_follows WHERE user_id = $1)::varchar(100)[]
+			)
+		`
+	}
+
+	query := `
+		SELECT id, shared_id, score FROM (
+			SELECT DISTINCT ON (p.id) a.id, p.id AS shared_id, EXTRACT(EPOCH FROM a.publish_at)::float8 AS score
+			FROM posts a
+			JOIN posts p ON p.id = COALESCE(a.repost_of_id, a.id)
+			WHERE
+				a.status = 'published' AND a.hidden_at IS NULL AND a.deleted_at IS NULL AND
+				p.status = 'published' AND p.hidden_at IS NULL AND p.deleted_at IS NULL AND
+				(` + authors + `)
+			ORDER BY p.id, a.publish_at DESC, a.id DESC
+		) latest
+		ORDER BY score DESC, id DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, threshold, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timeline := make([]TimelineEntry, 0)
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.SharedID, &e.Score); err != nil {
+			return nil, err
+		}
+
+		timeline = append(timeline, e)
+	}
+
+	return timeline, rows.Err()
+}
+
+// PublishScheduled flips due scheduled posts to published. Rows are claimed
+// with SKIP LOCKED so several API instances can run the scheduler at once
+// without publishing the same post twice.
+func (s *PostStore) PublishScheduled(ctx context.Context, limit int) ([]Post, error) {
+	query := `
+		UPDATE posts
+		SET status = 'published', updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM posts
+			WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+			ORDER BY publish_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, title, content, publish_at, hidden_at;
+	`
+
+	published := make([]Post, 0)
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, query, limit)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			p := Post{Status: PostStatusPublished}
+			if err := rows.Scan(
+				&p.ID,
+				&p.UserID,
+				&p.Title,
+				&p.Content,
+				&p.PublishAt,
+				&p.HiddenAt,
+			); err != nil {
+				rows.Close()
+				return err
+			}
+
+			published = append(published, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, p := range published {
+			if p.HiddenAt != nil {
+				continue
+			}
+
+			if err := addPostEvent(ctx, tx, OutboxPostPublished, p.ID, p.UserID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return published, nil
+}
+
+// GetByUser returns the author's timeline with pinned posts first. Viewers
+// other than the author only see published posts.
+func (s *PostStore) GetByUser(ctx context.Context, authorID, viewerID int64, page PaginatedQuery) ([]PostWithMetadata, error) {
+	query := `
+		SELECT p.id, p.user_id, u.username, p.title, p.content, p.created_at, p.updated_at, p.tags,
+		p.status, p.publish_at, p.pinned_at, p.repost_of_id, p.quote_of_id, p.repost_count, p.quote_count,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comments_count,
+		(
+			SELECT jsonb_object_agg(rc.kind, rc.count) FROM post_reaction_counts rc
+			WHERE rc.post_id = p.id AND rc.count > 0
+		) AS reactions,
+		COALESCE((SELECT pr.kind FROM post_reactions pr WHERE pr.post_id = p.id AND pr.user_id = $2), '') AS viewer_reaction,
+		EXISTS (SELECT 1 FROM bookmarks b WHERE b.post_id = p.id AND b.user_id = $2) AS bookmarked
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.user_id = $1 AND (p.status = 'published' OR p.user_id = $2) AND (p.hidden_at IS NULL OR p.user_id = $2) AND p.deleted_at IS NULL
+		ORDER BY p.pinned_at DESC NULLS LAST, COALESCE(p.publish_at, p.created_at) DESC
+		LIMIT $3 OFFSET $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, authorID, viewerID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]PostWithMetadata, 0)
+	for rows.Next() {
+		var p PostWithMetadata
+		if err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Username,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.PublishAt,
+			&p.PinnedAt,
+			&p.RepostOfID,
+			&p.QuoteOfID,
+			&p.RepostCount,
+			&p.QuoteCount,
+			&p.CommentCount,
+			&p.Reactions,
+			&p.ViewerReaction,
+			&p.Bookmarked,
+		); err != nil {
+			return nil, err
+		}
+
+		p.Entities = entities.Parse(p.Content)
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetByTag returns the published posts carrying the tag, newest first.
+func (s *PostStore) GetByTag(ctx context.Context, tag string, viewerID int64, page PaginatedQuery) ([]PostWithMetadata, error) {
+	query := `
+		SELECT p.id, p.user_id, u.username, p.title, p.content, p.created_at, p.updated_at, p.tags,
+		p.status, p.publish_at, p.pinned_at, p.repost_of_id, p.quote_of_id, p.repost_count, p.quote_count,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comments_count,
+		(
+			SELECT jsonb_object_agg(rc.kind, rc.count) FROM post_reaction_counts rc
+			WHERE rc.post_id = p.id AND rc.count > 0
+		) AS reactions,
+		COALESCE((SELECT pr.kind FROM post_reactions pr WHERE pr.post_id = p.id AND pr.user_id = $2), '') AS viewer_reaction,
+		EXISTS (SELECT 1 FROM bookmarks b WHERE b.post_id = p.id AND b.user_id = $2) AS bookmarked
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.tags @> ARRAY[$1]::varchar(100)[] AND p.status = 'published' AND p.hidden_at IS NULL AND p.deleted_at IS NULL
+		ORDER BY p.publish_at DESC, p.id DESC
+		LIMIT $3 OFFSET $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, tag, viewerID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]PostWithMetadata, 0)
+	for rows.Next() {
+		var p PostWithMetadata
+		if err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Username,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.PublishAt,
+			&p.PinnedAt,
+			&p.RepostOfID,
+			&p.QuoteOfID,
+			&p.RepostCount,
+			&p.QuoteCount,
+			&p.CommentCount,
+			&p.Reactions,
+			&p.ViewerReaction,
+			&p.Bookmarked,
+		); err != nil {
+			return nil, err
+		}
+
+		p.Entities = entities.Parse(p.Content)
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// Pin pins one of the user's posts to their timeline, allowing at most limit
+// pinned posts. The user row is locked so concurrent pins cannot exceed it.
+func (s *PostStore) Pin(ctx context.Context, postID, userID int64, limit int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			return err
+		}
+
+		var pinned bool
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT pinned_at IS NOT NULL FROM posts WHERE id = $1 AND user_id = $2`,
+			postID,
+			userID,
+		).Scan(&pinned)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if pinned {
+			return nil
+		}
+
+		var count int
+		if err := tx.QueryRowContext(
+			ctx,
+			`SELECT COUNT(*) FROM posts WHERE user_id = $1 AND pinned_at IS NOT NULL`,
+			userID,
+		).Scan(&count); err != nil {
+			return err
+		}
+
+		if count >= limit {
+			return ErrPinLimitReached
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET pinned_at = NOW() WHERE id = $1`, postID)
+
+		return err
+	})
+}
+
+func (s *PostStore) Unpin(ctx context.Context, postID, userID int64) error {
+	query := `
+		UPDATE posts SET pinned_at = NULL
+		WHERE id = $1 AND user_id = $2 AND pinned_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, postID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetAuthorAffinity counts the viewer's interactions with each of the
+// authors since the given time: reactions to and comments on their posts,
+// likes on their comments, and reposts or quotes of their posts.
+func (s *PostStore) GetAuthorAffinity(ctx context.Context, viewerID int64, authorIDs []int64, since time.Time) (map[int64]int64, error) {
+	query := `
+		SELECT author_id, COUNT(*) FROM (
+			SELECT p.user_id AS author_id FROM post_reactions pr
+			JOIN posts p ON p.id = pr.post_id
+			WHERE pr.user_id = $1 AND p.user_id = ANY($2) AND pr.created_at >= $3
+			UNION ALL
+			SELECT p.user_id FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			WHERE c.user_id = $1 AND p.user_id = ANY($2) AND c.created_at >= $3
+			UNION ALL
+			SELECT c.user_id FROM comment_likes cl
+			JOIN comments c ON c.id = cl.comment_id
+			WHERE cl.user_id = $1 AND c.user_id = ANY($2) AND cl.created_at >= $3
+			UNION ALL
+			SELECT o.user_id FROM posts r
+			JOIN posts o ON o.id = COALESCE(r.repost_of_id, r.quote_of_id)
+			WHERE r.user_id = $1 AND o.user_id = ANY($2) AND r.created_at >= $3
+		) interactions
+		WHERE author_id <> $1
+		GROUP BY author_id
+	`
+
+	affinity := make(map[int64]int64)
+	if len(authorIDs) == 0 {
+		return affinity, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, pq.Array(authorIDs), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var authorID, count int64
+		if err := rows.Scan(&authorID, &count); err != nil {
+			return nil, err
+		}
+
+		affinity[authorID] = count
+	}
+
+	return affinity, rows.Err()
+}
+
+// SetHidden hides a post from everyone but its author, or shows it again.
+func (s *PostStore) SetHidden(ctx context.Context, postID int64, hidden bool) error {
+	query := `
+		UPDATE posts SET hidden_at = CASE WHEN $2 THEN COALESCE(hidden_at, NOW()) END
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, postID, hidden)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetRecentByAuthor returns the content of the posts and comments the
+// author created since the given time, hidden ones included. The post or
+// comment of the given type and ID is left out, so an edit is not counted
+// against itself.
+func (s *PostStore) GetRecentByAuthor(ctx context.Context, authorID int64, since time.Time, excludeType string, excludeID int64) ([]string, error) {
+	query := `
+		SELECT content FROM posts
+		WHERE user_id = $1 AND created_at >= $2 AND repost_of_id IS NULL AND NOT ($3 = 'post' AND id = $4)
+		UNION ALL
+		SELECT content FROM comments
+		WHERE user_id = $1 AND created_at >= $2 AND NOT ($3 = 'comment' AND id = $4)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, authorID, since, excludeType, excludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []string
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, err
+		}
+
+		contents = append(contents, content)
+	}
+
+	return contents, rows.Err()
 }
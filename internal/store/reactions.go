@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ReactionKinds = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+type Reaction struct {
+	PostID    int64  `json:"post_id"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Kind      string `json:"kind"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ReactionCounts maps a reaction kind to the number of users that reacted
+// with it. It scans the jsonb aggregates built by the post queries.
+type ReactionCounts map[string]int64
+
+func (c *ReactionCounts) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*c = ReactionCounts{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported reaction counts type %T", src)
+	}
+
+	counts := ReactionCounts{}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return err
+	}
+	*c = counts
+
+	return nil
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// React sets the user's reaction on a post, replacing any previous kind. The
+// per-kind counters are kept in the same transaction so reads never have to
+// aggregate post_reactions.
+func (s *ReactionStore) React(ctx context.Context, postID, userID int64, kind string) error {
+	// an existing reaction is locked and returned unchanged, so concurrent
+	// reactions of the user are applied one after the other against the
+	// kind they replace
+	query := `
+		INSERT INTO post_reactions (post_id, user_id, kind)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id) DO UPDATE SET kind = post_reactions.kind
+		RETURNING kind, xmax = 0 AS inserted
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var (
+			previous string
+			inserted bool
+		)
+		if err := tx.QueryRowContext(ctx, query, postID, userID, kind).Scan(&previous, &inserted); err != nil {
+			return err
+		}
+
+		if inserted {
+			return s.incrementCount(ctx, tx, postID, kind, 1)
+		}
+
+		if previous == kind {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(
+			ctx,
+			`UPDATE post_reactions SET kind = $3, created_at = NOW() WHERE post_id = $1 AND user_id = $2`,
+			postID,
+			userID,
+			kind,
+		); err != nil {
+			return err
+		}
+
+		if err := s.incrementCount(ctx, tx, postID, previous, -1); err != nil {
+			return err
+		}
+
+		return s.incrementCount(ctx, tx, postID, kind, 1)
+	})
+}
+
+func (s *ReactionStore) Unreact(ctx context.Context, postID, userID int64, kind string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		result, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND kind = $3`,
+			postID,
+			userID,
+			kind,
+		)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return ErrNotFound
+		}
+
+		return s.incrementCount(ctx, tx, postID, kind, -1)
+	})
+}
+
+func (s *ReactionStore) incrementCount(ctx context.Context, tx *sql.Tx, postID int64, kind string, delta int) error {
+	query := `
+		INSERT INTO post_reaction_counts (post_id, kind, count)
+		VALUES ($1, $2, GREATEST($3, 0))
+		ON CONFLICT (post_id, kind)
+		DO UPDATE SET count = GREATEST(post_reaction_counts.count + $3, 0);
+	`
+
+	_, err := tx.ExecContext(ctx, query, postID, kind, delta)
+
+	return err
+}
+
+func (s *ReactionStore) GetCounts(ctx context.Context, postID int64) (ReactionCounts, error) {
+	query := `
+		SELECT kind, count FROM post_reaction_counts
+		WHERE post_id = $1 AND count > 0
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := ReactionCounts{}
+	for rows.Next() {
+		var (
+			kind  string
+			count int64
+		)
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+
+		counts[kind] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// GetUserReaction returns the kind the user reacted with, or an empty string.
+func (s *ReactionStore) GetUserReaction(ctx context.Context, postID, userID int64) (string, error) {
+	query := `SELECT kind FROM post_reactions WHERE post_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var kind string
+	if err := s.db.QueryRowContext(ctx, query, postID, userID).Scan(&kind); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", nil
+		default:
+			return "", err
+		}
+	}
+
+	return kind, nil
+}
+
+func (s *ReactionStore) GetByPostId(ctx context.Context, postID int64, kind string, pq PaginatedQuery) ([]Reaction, error) {
+	query := `
+		SELECT r.post_id, r.user_id, u.username, r.kind, r.created_at
+		FROM post_reactions r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.post_id = $1 AND (r.kind = $2 OR $2 = '')
+		ORDER BY r.created_at DESC
+		LIMIT $3 OFFSET $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID, kind, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := make([]Reaction, 0)
+	for rows.Next() {
+		var reaction Reaction
+		if err := rows.Scan(
+			&reaction.PostID,
+			&reaction.UserID,
+			&reaction.Username,
+			&reaction.Kind,
+			&reaction.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		reactions = append(reactions, reaction)
+	}
+
+	return reactions, rows.Err()
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"social/internal/entities"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// DefaultSearchLanguage is the text search configuration of posts that do
+// not set one. Posts and searches may use simple, english, portuguese,
+// spanish, french, german or italian.
+const DefaultSearchLanguage = "english"
+
+// searchLanguages are the text search configurations posts may use.
+var searchLanguages = []string{"simple", "english", "portuguese", "spanish", "french", "german", "italian"}
+
+// otherLanguageWeight scales the rank of posts written in another language
+// than the one searched in, so they come after equally relevant posts in it.
+const otherLanguageWeight = 0.5
+
+// anyLanguageTSQuery matches $2 stemmed in any of the search languages. It
+// only narrows posts down through the search index; each post is then
+// matched in its own language.
+var anyLanguageTSQuery = func() string {
+	queries := make([]string, len(searchLanguages))
+	for i, lang := range searchLanguages {
+		queries[i] = fmt.Sprintf("to_tsquery('%s', $2)", lang)
+	}
+
+	return "(" + strings.Join(queries, " || ") + ")"
+}()
+
+var ErrInvalidSearchQuery = errors.New("search query needs at least one term that is not excluded")
+
+// PostSearchResult is a post matching a search, with its relevance and the
+// matched words of its title and content wrapped in <mark> tags.
+type PostSearchResult struct {
+	PostWithMetadata
+	Rank             float64 `json:"rank"`
+	TitleHighlight   string  `json:"title_highlight"`
+	ContentHighlight string  `json:"content_highlight"`
+}
+
+type PostSearchQuery struct {
+	Query    string `json:"q" validate:"required,max=200"`
+	Language string `json:"lang" validate:"oneof=simple english portuguese spanish french german italian"`
+	Limit    int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset   int    `json:"offset" validate:"gte=0"`
+}
+
+func (q PostSearchQuery) Parse(r *http.Request) (PostSearchQuery, error) {
+	qs := r.URL.Query()
+
+	q.Query = strings.TrimSpace(qs.Get("q"))
+
+	if lang := qs.Get("lang"); lang != "" {
+		q.Language = lang
+	}
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+
+		q.Offset = o
+	}
+
+	return q, nil
+}
+
+// BuildTSQuery turns a search box query into to_tsquery syntax. Words must
+// all match; "quoted words" match as a phrase, a trailing * matches a
+// prefix, a leading - excludes a word or phrase and OR between two terms
+// matches either. Punctuation only separates words, so user input can never
+// produce an invalid tsquery.
+func BuildTSQuery(input string) (string, error) {
+	var (
+		terms    []string
+		positive bool
+		orNext   bool
+	)
+
+	for _, token := range tokenizeSearch(input) {
+		if token == "OR" {
+			orNext = len(terms) > 0
+			continue
+		}
+
+		negated := strings.HasPrefix(token, "-")
+		token = strings.TrimPrefix(token, "-")
+
+		phrase := strings.HasPrefix(token, `"`)
+		prefix := !phrase && strings.HasSuffix(token, "*")
+
+		words := strings.FieldsFunc(strings.Trim(token, `"*`), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) == 0 {
+			continue
+		}
+
+		for i, w := range words {
+			words[i] = "'" + w + "'"
+		}
+		if prefix {
+			words[len(words)-1] += ":*"
+		}
+
+		term := strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			term = "(" + term + ")"
+		}
+
+		if negated {
+			term = "!" + term
+		} else {
+			positive = true
+		}
+
+		if orNext {
+			terms[len(terms)-1] = "(" + terms[len(terms)-1] + " | " + term + ")"
+			orNext = false
+			continue
+		}
+
+		terms = append(terms, term)
+	}
+
+	if !positive {
+		return "", ErrInvalidSearchQuery
+	}
+
+	return strings.Join(terms, " & "), nil
+}
+
+// tokenizeSearch splits on spaces, keeping quoted phrases (and a leading -
+// before them) together. An unterminated quote runs to the end.
+func tokenizeSearch(input string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+	)
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			current.WriteRune(r)
+			if quoted {
+				flush()
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// Search returns the published posts matching the query, most relevant
+// first. Each post is matched in its own language; posts in the query's
+// language rank above equally relevant posts in others. Title matches weigh
+// more than content and tags.
+func (s *PostStore) Search(ctx context.Context, q PostSearchQuery) ([]PostSearchResult, error) {
+	tsquery, err := BuildTSQuery(q.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH matches AS (
+			SELECT p.id, ts_rank(p.search_vector, to_tsquery(p.search_language, $2)) *
+				CASE WHEN p.search_language = $1::regconfig THEN 1 ELSE $5::real END AS rank
+			FROM posts p
+			WHERE
+				p.status = 'published' AND
+				p.hidden_at IS NULL AND p.deleted_at IS NULL AND
+				p.repost_of_id IS NULL AND
+				p.search_vector @@ ` + anyLanguageTSQuery + ` AND
+				p.search_vector @@ to_tsquery(p.search_language, $2)
+			ORDER BY rank DESC, p.id DESC
+			LIMIT $3 OFFSET $4
+		)
+		SELECT p.id, p.user_id, u.username, p.title, p.content, p.created_at, p.tags, p.publish_at,
+		p.quote_of_id, p.repost_count, p.quote_count, p.search_language::text,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comments_count,
+		m.rank,
+		ts_headline(p.search_language, p.title, to_tsquery(p.search_language, $2), 'HighlightAll=true, StartSel=' || chr(2) || ', StopSel=' || chr(3)),
+		ts_headline(p.search_language, p.content, to_tsquery(p.search_language, $2), 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MinWords=15, MaxWords=35, MaxFragments=2')
+		FROM matches m
+		JOIN posts p ON p.id = m.id
+		JOIN users u ON u.id = p.user_id
+		ORDER BY m.rank DESC, p.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.Language, tsquery, q.Limit, q.Offset, otherLanguageWeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]PostSearchResult, 0)
+	for rows.Next() {
+		r := PostSearchResult{}
+		r.Status = PostStatusPublished
+
+		if err := rows.Scan(
+			&r.ID,
+			&r.UserID,
+			&r.Username,
+			&r.Title,
+			&r.Content,
+			&r.CreatedAt,
+			pq.Array(&r.Tags),
+			&r.PublishAt,
+			&r.QuoteOfID,
+			&r.RepostCount,
+			&r.QuoteCount,
+			&r.Language,
+			&r.CommentCount,
+			&r.Rank,
+			&r.TitleHighlight,
+			&r.ContentHighlight,
+		); err != nil {
+			return nil, err
+		}
+
+		r.Entities = entities.Parse(r.Content)
+		r.TitleHighlight = markHighlight(r.TitleHighlight)
+		r.ContentHighlight = markHighlight(r.ContentHighlight)
+
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// highlightMarker swaps the control characters ts_headline is told to put
+// around matches for <mark> tags once the rest of the text is escaped, so
+// highlights are safe to render as HTML.
+var highlightMarker = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+func markHighlight(headline string) string {
+	return highlightMarker.Replace(html.EscapeString(headline))
+}
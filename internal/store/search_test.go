@@ -0,0 +1,54 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuildTSQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "gopher", want: "'gopher'"},
+		{input: "fast  gophers", want: "'fast' & 'gophers'"},
+		{input: `"error handling" go`, want: "('error' <-> 'handling') & 'go'"},
+		{input: "concurren*", want: "'concurren':*"},
+		{input: "go -java", want: "'go' & !'java'"},
+		{input: `go -"null pointer"`, want: "'go' & !('null' <-> 'pointer')"},
+		{input: "rust OR zig compilers", want: "('rust' | 'zig') & 'compilers'"},
+		{input: "it's o'clock", want: "('it' <-> 's') & ('o' <-> 'clock')"},
+		{input: `"unterminated phrase`, want: "('unterminated' <-> 'phrase')"},
+		{input: "OR go", want: "'go'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := BuildTSQuery(tt.input)
+			if err != nil {
+				t.Fatalf("BuildTSQuery(%q) returned error: %v", tt.input, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("BuildTSQuery(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTSQueryRejectsQueriesWithoutPositiveTerms(t *testing.T) {
+	for _, input := range []string{"", "   ", "-java", `-"null pointer"`, "!!! ???"} {
+		if _, err := BuildTSQuery(input); !errors.Is(err, ErrInvalidSearchQuery) {
+			t.Errorf("BuildTSQuery(%q) error = %v, want ErrInvalidSearchQuery", input, err)
+		}
+	}
+}
+
+func TestMarkHighlightEscapesContent(t *testing.T) {
+	got := markHighlight("<script>x</script> \x02gopher\x03 & co")
+	want := "&lt;script&gt;x&lt;/script&gt; <mark>gopher</mark> &amp; co"
+
+	if got != want {
+		t.Errorf("markHighlight() = %q, want %q", got, want)
+	}
+}
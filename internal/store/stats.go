@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MonthlyActiveWindow is how many days, ending on the last day of a stats
+// range, count towards the monthly active users.
+const MonthlyActiveWindow = 30
+
+// DailyCount is a count for one UTC day, formatted as YYYY-MM-DD.
+type DailyCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+type TopPoster struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Posts    int64  `json:"posts"`
+}
+
+type TopTag struct {
+	Tag  string `json:"tag"`
+	Uses int64  `json:"uses"`
+}
+
+// PlatformStats summarizes the platform between two UTC days, both
+// included. Daily series have an entry for every day of the range.
+type PlatformStats struct {
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Signups     []DailyCount `json:"signups"`
+	Activations []DailyCount `json:"activations"`
+	DailyActive []DailyCount `json:"daily_active_users"`
+	// MonthlyActive counts the users active in the MonthlyActiveWindow days
+	// ending on To.
+	MonthlyActive int64        `json:"monthly_active_users"`
+	Posts         []DailyCount `json:"posts"`
+	Comments      []DailyCount `json:"comments"`
+	TopPosters    []TopPoster  `json:"top_posters"`
+	TopTags       []TopTag     `json:"top_tags"`
+	GeneratedAt   string       `json:"generated_at"`
+}
+
+type StatsStore struct {
+	db *sql.DB
+}
+
+// Get computes the platform stats between from and to, listing the top
+// posters and tags of the range up to top entries each.
+func (s *StatsStore) Get(ctx context.Context, from, to time.Time, top int) (PlatformStats, error) {
+	stats := PlatformStats{
+		From:        from.Format(time.DateOnly),
+		To:          to.Format(time.DateOnly),
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	series := []struct {
+		dest   *[]DailyCount
+		table  string
+		column string
+		where  string
+	}{
+		{&stats.Signups, "users", "created_at", "true"},
+		{&stats.Activations, "users", "activated_at", "true"},
+		{&stats.Posts, "posts", "created_at", "repost_of_id IS NULL"},
+		{&stats.Comments, "comments", "created_at", "true"},
+	}
+
+	for _, sr := range series {
+		counts, err := s.dailyCounts(ctx, sr.table, sr.column, sr.where, stats.From, stats.To)
+		if err != nil {
+			return PlatformStats{}, err
+		}
+		*sr.dest = counts
+	}
+
+	var err error
+	if stats.DailyActive, err = s.dailyActive(ctx, stats.From, stats.To); err != nil {
+		return PlatformStats{}, err
+	}
+
+	if stats.MonthlyActive, err = s.monthlyActive(ctx, stats.To); err != nil {
+		return PlatformStats{}, err
+	}
+
+	if stats.TopPosters, err = s.topPosters(ctx, stats.From, stats.To, top); err != nil {
+		return PlatformStats{}, err
+	}
+
+	if stats.TopTags, err = s.topTags(ctx, stats.From, stats.To, top); err != nil {
+		return PlatformStats{}, err
+	}
+
+	return stats, nil
+}
+
+// dailyCounts counts the rows of table whose column falls on each day of
+// the range. table, column and where are never user input.
+func (s *StatsStore) dailyCounts(ctx context.Context, table, column, where, from, to string) ([]DailyCount, error) {
+	query := fmt.Sprintf(`
+		SELECT d::date::text, COALESCE(c.count, 0)
+		FROM generate_series($1::date, $2::date, interval '1 day') d
+		LEFT JOIN (
+			SELECT (%[2]s AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count
+			FROM %[1]s
+			WHERE %[2]s >= $1::date AT TIME ZONE 'UTC'
+			AND %[2]s < ($2::date + 1) AT TIME ZONE 'UTC'
+			AND %[3]s
+			GROUP BY day
+		) c ON c.day = d::date
+		ORDER BY d
+	`, table, column, where)
+
+	return s.queryDailyCounts(ctx, query, from, to)
+}
+
+func (s *StatsStore) dailyActive(ctx context.Context, from, to string) ([]DailyCount, error) {
+	query := `
+		SELECT d::date::text, COUNT(a.user_id)
+		FROM generate_series($1::date, $2::date, interval '1 day') d
+		LEFT JOIN user_activity a ON a.day = d::date
+		GROUP BY d
+		ORDER BY d
+	`
+
+	return s.queryDailyCounts(ctx, query, from, to)
+}
+
+func (s *StatsStore) queryDailyCounts(ctx context.Context, query string, args ...any) ([]DailyCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []DailyCount{}
+	for rows.Next() {
+		var c DailyCount
+		if err := rows.Scan(&c.Day, &c.Count); err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *StatsStore) monthlyActive(ctx context.Context, to string) (int64, error) {
+	query := `
+		SELECT COUNT(DISTINCT user_id) FROM user_activity
+		WHERE day > $1::date - $2::int AND day <= $1::date
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, to, MonthlyActiveWindow).Scan(&count)
+
+	return count, err
+}
+
+func (s *StatsStore) topPosters(ctx context.Context, from, to string, limit int) ([]TopPoster, error) {
+	query := `
+		SELECT u.id, u.username, COUNT(*) AS posts
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.created_at >= $1::date AT TIME ZONE 'UTC' AND p.created_at < ($2::date + 1) AT TIME ZONE 'UTC'
+		AND p.repost_of_id IS NULL AND p.deleted_at IS NULL
+		GROUP BY u.id, u.username
+		ORDER BY posts DESC, u.id
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posters := []TopPoster{}
+	for rows.Next() {
+		var p TopPoster
+		if err := rows.Scan(&p.UserID, &p.Username, &p.Posts); err != nil {
+			return nil, err
+		}
+
+		posters = append(posters, p)
+	}
+
+	return posters, rows.Err()
+}
+
+func (s *StatsStore) topTags(ctx context.Context, from, to string, limit int) ([]TopTag, error) {
+	query := `
+		SELECT lower(t) AS tag, COUNT(*) AS uses
+		FROM posts p, unnest(p.tags) t
+		WHERE p.created_at >= $1::date AT TIME ZONE 'UTC' AND p.created_at < ($2::date + 1) AT TIME ZONE 'UTC'
+		AND p.repost_of_id IS NULL AND p.deleted_at IS NULL
+		GROUP BY tag
+		ORDER BY uses DESC, tag
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TopTag{}
+	for rows.Next() {
+		var t TopTag
+		if err := rows.Scan(&t.Tag, &t.Uses); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
@@ -16,39 +16,154 @@ type Storage struct {
 	Post interface {
 		Create(context.Context, *Post) error
 		GetById(context.Context, int64) (Post, error)
-		Delete(ctx context.Context, id int64) (int64, error)
-		Update(context.Context, *Post) error
+		Delete(ctx context.Context, id, deletedBy int64) error
+		Restore(context.Context, int64) error
+		Purge(ctx context.Context, before time.Time, limit int) (int64, error)
+		Update(ctx context.Context, post *Post, hold *ContentHold) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		PublishScheduled(context.Context, int) ([]Post, error)
+		Repost(ctx context.Context, postID, userID int64) (Post, error)
+		Unrepost(ctx context.Context, postID, userID int64) error
+		GetByUser(ctx context.Context, authorID, viewerID int64, page PaginatedQuery) ([]PostWithMetadata, error)
+		Pin(ctx context.Context, postID, userID int64, limit int) error
+		Unpin(ctx context.Context, postID, userID int64) error
+		GetByTag(ctx context.Context, tag string, viewerID int64, page PaginatedQuery) ([]PostWithMetadata, error)
+		GetAuthorAffinity(ctx context.Context, viewerID int64, authorIDs []int64, since time.Time) (map[int64]int64, error)
+		GetFeedByIDs(ctx context.Context, viewerID int64, ids []int64) ([]PostWithMetadata, error)
+		GetTimelineEntries(ctx context.Context, userID int64, source string, threshold, limit int) ([]TimelineEntry, error)
+		Search(context.Context, PostSearchQuery) ([]PostSearchResult, error)
+		SetHidden(ctx context.Context, postID int64, hidden bool) error
+		GetRecentByAuthor(ctx context.Context, authorID int64, since time.Time, excludeType string, excludeID int64) ([]string, error)
 	}
 	User interface {
 		GetById(context.Context, int64) (User, error)
 		GetByEmail(context.Context, string) (User, error)
 		create(context.Context, *User, *sql.Tx) error
-		CreateAndInvite(ctx context.Context, user *User, token string, tokenExp time.Duration) error
+		CreateAndInvite(ctx context.Context, user *User, token string, tokenExp time.Duration, events ...*OutboxEvent) error
+		Invite(ctx context.Context, userID int64, token string, exp time.Duration) error
 		Activate(context.Context, string) error
 		Delete(context.Context, int64) error
+		RecordActivity(ctx context.Context, userID int64, at time.Time) error
+		List(context.Context, UserListQuery) ([]User, error)
+		GetAny(context.Context, int64) (User, error)
+		ActivateById(context.Context, int64) error
+		SetRole(ctx context.Context, userID int64, role string) error
+		ForcePasswordReset(ctx context.Context, user *User, token string, exp time.Duration) error
+		ResetPassword(ctx context.Context, token string, user *User) error
 	}
 	Comment interface {
 		Create(context.Context, *Comment) error
-		GetByPostId(context.Context, int64) ([]Comment, error)
-		DeleteByPostId(context.Context, int64) (int64, error)
+		GetById(context.Context, int64) (Comment, error)
+		ListByPost(ctx context.Context, postID, viewerID int64, depth int, q CursorQuery) ([]Comment, string, error)
+		GetReplies(ctx context.Context, commentID, viewerID int64, depth int, page PaginatedQuery) ([]Comment, error)
+		Update(ctx context.Context, comment *Comment, hold *ContentHold) error
+		Delete(ctx context.Context, commentID, deletedBy int64) error
+		Restore(context.Context, int64) error
+		Purge(ctx context.Context, before time.Time, limit int) (int64, error)
+		Like(ctx context.Context, commentID, userID int64) (int64, error)
+		Unlike(ctx context.Context, commentID, userID int64) (int64, error)
+		SetHidden(ctx context.Context, commentID int64, hidden bool) error
 	}
 	Follower interface {
-		Follow(ctx context.Context, followerId, UserId int64) error
-		Unfollow(ctx context.Context, followerId, UserId int64) error
+		Follow(ctx context.Context, followerId, UserId int64, events ...*OutboxEvent) error
+		Unfollow(ctx context.Context, followerId, UserId int64, events ...*OutboxEvent) error
+		GetFollowerIDs(ctx context.Context, userId int64, limit int) ([]int64, int, error)
 	}
 	Role interface {
 		GetByName(context.Context, string) (Role, error)
 	}
+	Reaction interface {
+		React(ctx context.Context, postID, userID int64, kind string) error
+		Unreact(ctx context.Context, postID, userID int64, kind string) error
+		GetCounts(context.Context, int64) (ReactionCounts, error)
+		GetUserReaction(ctx context.Context, postID, userID int64) (string, error)
+		GetByPostId(ctx context.Context, postID int64, kind string, pq PaginatedQuery) ([]Reaction, error)
+	}
+	Bookmark interface {
+		Save(ctx context.Context, userID, postID int64, collectionID *int64) error
+		Remove(ctx context.Context, userID, postID int64) error
+		IsBookmarked(ctx context.Context, userID, postID int64) (bool, error)
+		GetByUser(ctx context.Context, userID int64, collectionID *int64, page PaginatedQuery) ([]Bookmark, error)
+		CreateCollection(context.Context, *BookmarkCollection) error
+		GetCollections(context.Context, int64) ([]BookmarkCollection, error)
+		DeleteCollection(ctx context.Context, userID, collectionID int64) error
+	}
+	Tag interface {
+		GetTrending(ctx context.Context, window, baseline time.Duration, limit int) ([]TrendingTag, error)
+		Follow(ctx context.Context, userID int64, tag string) error
+		Unfollow(ctx context.Context, userID int64, tag string) error
+		GetFollowed(context.Context, int64) ([]string, error)
+	}
+	Moderation interface {
+		Report(context.Context, *Report) error
+		GetCases(ctx context.Context, status string, page PaginatedQuery) ([]ModerationCase, error)
+		GetCase(context.Context, int64) (ModerationCase, error)
+		Hold(ctx context.Context, targetType string, targetID, targetUserID int64, reason string) (string, error)
+		Claim(ctx context.Context, caseID, moderatorID int64) error
+		Resolve(ctx context.Context, caseID, moderatorID int64, resolution, note string, suspension *Suspension) error
+	}
+	Suspension interface {
+		Create(context.Context, *Suspension) error
+		GetByUser(context.Context, int64) ([]Suspension, error)
+		Lift(ctx context.Context, userID, moderatorID int64) error
+		Appeal(ctx context.Context, userID int64, note string) (Suspension, error)
+	}
+	Mention interface {
+		Create(ctx context.Context, authorID, postID int64, commentID *int64, usernames []string) ([]User, error)
+	}
+	Notification interface {
+		Create(context.Context, *Notification) error
+		Remove(ctx context.Context, userID int64, notificationType string, actorID int64, groupKey string) error
+		GetGroups(ctx context.Context, userID int64, unreadOnly bool, page PaginatedQuery) ([]NotificationGroup, error)
+		GetUnreadCounts(context.Context, int64) (map[string]int64, error)
+		MarkRead(ctx context.Context, userID, notificationID int64) error
+		MarkAllRead(context.Context, int64) (int64, error)
+		GetPreferences(context.Context, int64) (map[string]bool, error)
+		SetPreferences(ctx context.Context, userID int64, prefs map[string]bool) error
+	}
+	Stats interface {
+		Get(ctx context.Context, from, to time.Time, top int) (PlatformStats, error)
+	}
+	Outbox interface {
+		ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OutboxEvent, error)
+		GetConsumers(ctx context.Context, key string) (map[string]bool, error)
+		MarkConsumed(ctx context.Context, key, consumer string) error
+		Complete(context.Context, int64) error
+		Fail(ctx context.Context, id int64, reason string, retryAt *time.Time) error
+		Purge(ctx context.Context, before time.Time, limit int) (int64, error)
+	}
+	Digest interface {
+		Get(context.Context, int64) (DigestSubscription, error)
+		Subscribe(ctx context.Context, userID int64, frequency string) (DigestSubscription, error)
+		Unsubscribe(context.Context, int64) error
+		ClaimDue(ctx context.Context, now time.Time, limit int) ([]DueDigest, error)
+		GetNewFollowers(ctx context.Context, userID int64, since time.Time, limit int) ([]DigestFollower, int64, error)
+		GetTopPosts(ctx context.Context, userID int64, since time.Time, limit int) ([]DigestPost, error)
+	}
+	StreamTicket interface {
+		Create(ctx context.Context, userID int64, token string, exp time.Duration) error
+		Consume(context.Context, string) (int64, error)
+	}
 }
 
 func NewPostgresStorage(db *sql.DB) *Storage {
 	return &Storage{
-		Post:     &PostStore{db: db},
-		User:     &UserStore{db: db},
-		Comment:  &CommentStore{db: db},
-		Follower: &FollowerStore{db: db},
-		Role:     &RoleStore{db: db},
+		Post:         &PostStore{db: db},
+		User:         &UserStore{db: db},
+		Comment:      &CommentStore{db: db},
+		Follower:     &FollowerStore{db: db},
+		Role:         &RoleStore{db: db},
+		Reaction:     &ReactionStore{db: db},
+		Bookmark:     &BookmarkStore{db: db},
+		Mention:      &MentionStore{db: db},
+		Tag:          &TagStore{db: db},
+		Moderation:   &ModerationStore{db: db},
+		Suspension:   &SuspensionStore{db: db},
+		Stats:        &StatsStore{db: db},
+		Notification: &NotificationStore{db: db},
+		Digest:       &DigestStore{db: db},
+		Outbox:       &OutboxStore{db: db},
+		StreamTicket: &StreamTicketStore{db: db},
 	}
 }
 
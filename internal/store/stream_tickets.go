@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// StreamTicketStore keeps the single-use tickets that open an event stream
+// from browsers, which cannot send the Authorization header there. Tickets
+// are stored hashed.
+type StreamTicketStore struct {
+	db *sql.DB
+}
+
+// Create issues a ticket for the user, dropping the expired ones.
+func (s *StreamTicketStore) Create(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM stream_tickets WHERE expiry < NOW()`); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO stream_tickets (token, user_id, expiry) VALUES ($1, $2, $3)`, token, userID, time.Now().Add(exp))
+
+		return err
+	})
+}
+
+// Consume redeems a ticket and returns its user. A ticket is only redeemed
+// once; expired and unknown tickets return ErrNotFound.
+func (s *StreamTicketStore) Consume(ctx context.Context, token string) (int64, error) {
+	query := `DELETE FROM stream_tickets WHERE token = $1 AND expiry > NOW() RETURNING user_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	if err := s.db.QueryRowContext(ctx, query, token).Scan(&userID); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
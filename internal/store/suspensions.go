@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrAlreadyAppealed = errors.New("suspension has already been appealed")
+
+// Suspension keeps a user from signing in until EndsAt, or for good when
+// EndsAt is nil, unless it is lifted earlier.
+type Suspension struct {
+	ID          int64   `json:"id"`
+	UserID      int64   `json:"user_id"`
+	CaseID      *int64  `json:"case_id,omitempty"`
+	ModeratorID *int64  `json:"moderator_id,omitempty"`
+	Reason      string  `json:"reason"`
+	EndsAt      *string `json:"ends_at,omitempty"`
+	LiftedAt    *string `json:"lifted_at,omitempty"`
+	LiftedBy    *int64  `json:"lifted_by,omitempty"`
+	AppealNote  *string `json:"appeal_note,omitempty"`
+	AppealedAt  *string `json:"appealed_at,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+type SuspensionStore struct {
+	db *sql.DB
+}
+
+func (s *SuspensionStore) Create(ctx context.Context, suspension *Suspension) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		return createSuspension(ctx, tx, suspension)
+	})
+}
+
+func createSuspension(ctx context.Context, tx *sql.Tx, suspension *Suspension) error {
+	query := `
+		INSERT INTO user_suspensions (user_id, case_id, moderator_id, reason, ends_at)
+		VALUES ($1, $2, $3, $4, $5::timestamptz)
+		RETURNING id, created_at
+	`
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		suspension.UserID,
+		suspension.CaseID,
+		suspension.ModeratorID,
+		suspension.Reason,
+		suspension.EndsAt,
+	).Scan(
+		&suspension.ID,
+		&suspension.CreatedAt,
+	)
+}
+
+// GetByUser lists the suspensions of a user, newest first, including the
+// expired and lifted ones.
+func (s *SuspensionStore) GetByUser(ctx context.Context, userID int64) ([]Suspension, error) {
+	query := `
+		SELECT id, user_id, case_id, moderator_id, reason, ends_at, lifted_at, lifted_by,
+		appeal_note, appealed_at, created_at
+		FROM user_suspensions
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suspensions := []Suspension{}
+	for rows.Next() {
+		var sp Suspension
+		if err := rows.Scan(
+			&sp.ID,
+			&sp.UserID,
+			&sp.CaseID,
+			&sp.ModeratorID,
+			&sp.Reason,
+			&sp.EndsAt,
+			&sp.LiftedAt,
+			&sp.LiftedBy,
+			&sp.AppealNote,
+			&sp.AppealedAt,
+			&sp.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		suspensions = append(suspensions, sp)
+	}
+
+	return suspensions, rows.Err()
+}
+
+// Lift ends every active suspension of a user. It returns ErrNotFound when
+// the user has none.
+func (s *SuspensionStore) Lift(ctx context.Context, userID, moderatorID int64) error {
+	query := `
+		UPDATE user_suspensions
+		SET lifted_at = NOW(), lifted_by = $2
+		WHERE user_id = $1 AND lifted_at IS NULL AND (ends_at IS NULL OR ends_at > NOW())
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, moderatorID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Appeal attaches the user's note to their longest active suspension. Each
+// suspension can be appealed once.
+func (s *SuspensionStore) Appeal(ctx context.Context, userID int64, note string) (Suspension, error) {
+	query := `
+		SELECT id, appealed_at IS NOT NULL
+		FROM user_suspensions
+		WHERE user_id = $1 AND lifted_at IS NULL AND (ends_at IS NULL OR ends_at > NOW())
+		ORDER BY ends_at DESC NULLS FIRST
+		LIMIT 1
+		FOR UPDATE
+	`
+
+	appealQuery := `
+		UPDATE user_suspensions
+		SET appeal_note = $2, appealed_at = NOW()
+		WHERE id = $1
+		RETURNING id, user_id, case_id, moderator_id, reason, ends_at, lifted_at, lifted_by,
+		appeal_note, appealed_at, created_at
+	`
+
+	var sp Suspension
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var appealed bool
+		if err := tx.QueryRowContext(ctx, query, userID).Scan(&sp.ID, &appealed); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if appealed {
+			return ErrAlreadyAppealed
+		}
+
+		return tx.QueryRowContext(ctx, appealQuery, sp.ID, note).Scan(
+			&sp.ID,
+			&sp.UserID,
+			&sp.CaseID,
+			&sp.ModeratorID,
+			&sp.Reason,
+			&sp.EndsAt,
+			&sp.LiftedAt,
+			&sp.LiftedBy,
+			&sp.AppealNote,
+			&sp.AppealedAt,
+			&sp.CreatedAt,
+		)
+	})
+
+	return sp, err
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TrendingTag is a tag used more often in the recent window than its
+// baseline predicts. Velocity is the ratio between the recent and baseline
+// hourly rates, smoothed so new tags need a few uses before they trend.
+type TrendingTag struct {
+	Tag          string  `json:"tag"`
+	Uses         int64   `json:"uses"`
+	BaselineUses int64   `json:"baseline_uses"`
+	Velocity     float64 `json:"velocity"`
+}
+
+type TagStore struct {
+	db *sql.DB
+}
+
+// GetTrending ranks the tags of posts published within window by velocity
+// against their usage in the baseline period that precedes it.
+func (s *TagStore) GetTrending(ctx context.Context, window, baseline time.Duration, limit int) ([]TrendingTag, error) {
+	query := `
+		WITH recent AS (
+			SELECT t AS tag, COUNT(*) AS uses
+			FROM posts p, unnest(p.tags) t
+			WHERE p.status = 'published' AND p.hidden_at IS NULL AND p.deleted_at IS NULL AND p.publish_at >= NOW() - make_interval(secs => $1)
+			GROUP BY 1
+		), previous AS (
+			SELECT t AS tag, COUNT(*) AS uses
+			FROM posts p, unnest(p.tags) t
+			WHERE p.status = 'published' AND p.hidden_at IS NULL AND p.deleted_at IS NULL
+				AND p.publish_at >= NOW() - make_interval(secs => $1 + $2)
+				AND p.publish_at < NOW() - make_interval(secs => $1)
+			GROUP BY 1
+		)
+		SELECT r.tag, r.uses, COALESCE(b.uses, 0) AS baseline_uses,
+		(r.uses / ($1 / 3600.0)) / ((COALESCE(b.uses, 0) + 1) / ($2 / 3600.0)) AS velocity
+		FROM recent r
+		LEFT JOIN previous b ON b.tag = r.tag
+		WHERE r.uses > 1
+		ORDER BY velocity DESC, r.uses DESC, r.tag
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, window.Seconds(), baseline.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]TrendingTag, 0)
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.Uses, &t.BaselineUses, &t.Velocity); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+func (s *TagStore) Follow(ctx context.Context, userID int64, tag string) error {
+	query := `
+		INSERT INTO tag_follows (user_id, tag) VALUES ($1, $2)
+		ON CONFLICT (user_id, tag) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, tag)
+
+	return err
+}
+
+func (s *TagStore) Unfollow(ctx context.Context, userID int64, tag string) error {
+	query := `DELETE FROM tag_follows WHERE user_id = $1 AND tag = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, tag)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *TagStore) GetFollowed(ctx context.Context, userID int64) ([]string, error) {
+	query := `SELECT tag FROM tag_follows WHERE user_id = $1 ORDER BY tag`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]string, 0)
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
@@ -6,6 +6,8 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,14 +22,50 @@ var (
 )
 
 type User struct {
-	ID        int64    `json:"id"`
-	Username  string   `json:"username"`
-	Email     string   `json:"email"`
-	Password  password `json:"-"`
-	CreatedAt string   `json:"create_at"`
-	IsActive  bool     `json:"is_active"`
-	RoleID    int64    `json:"role_id"`
-	Role      Role     `json:"role"`
+	ID             int64    `json:"id"`
+	Username       string   `json:"username"`
+	Email          string   `json:"email"`
+	Password       password `json:"-"`
+	CreatedAt      string   `json:"create_at"`
+	IsActive       bool     `json:"is_active"`
+	RoleID         int64    `json:"role_id"`
+	Role           Role     `json:"role"`
+	SuspendedAt    *string  `json:"suspended_at,omitempty"`
+	SuspendedUntil *string  `json:"suspended_until,omitempty"`
+	ActivatedAt    *string  `json:"activated_at,omitempty"`
+	// PasswordChangedAt is when the password was last reset, to the second;
+	// tokens issued up to it are no longer valid.
+	PasswordChangedAt *string `json:"-"`
+}
+
+// activeSuspensionJoin loads the longest active suspension of u, if any, as
+// s.created_at and s.ends_at.
+const activeSuspensionJoin = `
+	LEFT JOIN LATERAL (
+		SELECT created_at, ends_at FROM user_suspensions
+		WHERE user_id = u.id AND lifted_at IS NULL AND (ends_at IS NULL OR ends_at > NOW())
+		ORDER BY ends_at DESC NULLS FIRST
+		LIMIT 1
+	) s ON true
+`
+
+// IsSuspended reports whether the user is suspended at the given time. A
+// suspension without an end is permanent.
+func (u *User) IsSuspended(now time.Time) bool {
+	if u.SuspendedAt == nil {
+		return false
+	}
+
+	if u.SuspendedUntil == nil {
+		return true
+	}
+
+	until, err := time.Parse(time.RFC3339, *u.SuspendedUntil)
+	if err != nil {
+		return true
+	}
+
+	return now.Before(until)
 }
 
 type password struct {
@@ -102,9 +140,11 @@ func (u *UserStore) create(ctx context.Context, user *User, tx *sql.Tx) error {
 
 func (u *UserStore) GetById(ctx context.Context, userId int64) (User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.created_at, r.level, r.description, r.name, r.id		
+		SELECT u.id, u.username, u.email, u.created_at, r.level, r.description, r.name, r.id,
+		s.created_at, s.ends_at, u.password_changed_at
 		FROM users u
 		JOIN roles r on r.id = u.role_id
+		` + activeSuspensionJoin + `
 		WHERE U.id = $1 and u.is_active = true
 	`
 
@@ -126,6 +166,9 @@ func (u *UserStore) GetById(ctx context.Context, userId int64) (User, error) {
 		&user.Role.Description,
 		&user.Role.Name,
 		&user.Role.Id,
+		&user.SuspendedAt,
+		&user.SuspendedUntil,
+		&user.PasswordChangedAt,
 	); err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -138,7 +181,9 @@ func (u *UserStore) GetById(ctx context.Context, userId int64) (User, error) {
 	return user, nil
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error {
+// CreateAndInvite creates the user with its invitation, and the events
+// sending it, in one transaction.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration, events ...*OutboxEvent) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.create(ctx, user, tx); err != nil {
 			return err
@@ -148,10 +193,39 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 			return err
 		}
 
-		return nil
+		return addOutboxEvents(ctx, tx, events)
 	})
 }
 
+// Invite adds an invitation to a user who did not activate their account
+// yet, next to the ones they already have. It returns ErrNotFound when the
+// user is gone or already active.
+func (s *UserStore) Invite(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	query := `
+		INSERT INTO user_invitations (token, user_id, expiry)
+		SELECT $1, id, $3 FROM users WHERE id = $2 AND NOT is_active
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 func (s *UserStore) Activate(ctx context.Context, token string) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		user, err := s.getUserFromInvitation(ctx, tx, token)
@@ -275,7 +349,8 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token
 
 func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 	query := `
-		UPDATE users SET username = $1, email = $2, is_active = $3
+		UPDATE users SET username = $1, email = $2, is_active = $3,
+		activated_at = CASE WHEN $3 THEN COALESCE(activated_at, NOW()) END
 		WHERE id = $4
 	`
 
@@ -298,8 +373,11 @@ func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (User, error) {
 	query := `
-		SELECT id, username, email, password, created_at, is_active 
-		FROM users WHERE email = $1 AND is_active = true
+		SELECT u.id, u.username, u.email, u.password, u.created_at, u.is_active,
+		s.created_at, s.ends_at
+		FROM users u
+		` + activeSuspensionJoin + `
+		WHERE u.email = $1 AND u.is_active = true
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -312,6 +390,209 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (User, error)
 		&user.Password.text,
 		&user.CreatedAt,
 		&user.IsActive,
+		&user.SuspendedAt,
+		&user.SuspendedUntil,
+	); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return User{}, ErrNotFound
+		default:
+			return User{}, err
+		}
+	}
+
+	return user, nil
+}
+
+// RecordActivity marks the user as active on the day of the given time, in
+// UTC. Recording the same day again is a no-op.
+func (s *UserStore) RecordActivity(ctx context.Context, userID int64, at time.Time) error {
+	query := `
+		INSERT INTO user_activity (day, user_id) VALUES ($1::date, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, at.UTC().Format(time.DateOnly), userID)
+
+	return err
+}
+
+// UserListQuery filters the users listed to admins. Unset filters match
+// every user; CreatedTo includes the whole day.
+type UserListQuery struct {
+	Role        string     `json:"role" validate:"omitempty,oneof=user moderator admin"`
+	Active      *bool      `json:"active"`
+	Suspended   *bool      `json:"suspended"`
+	CreatedFrom *time.Time `json:"created_from"`
+	CreatedTo   *time.Time `json:"created_to"`
+	Search      string     `json:"q" validate:"max=100"`
+	Limit       int        `json:"limit" validate:"gte=1,lte=100"`
+	Offset      int        `json:"offset" validate:"gte=0"`
+}
+
+func (q UserListQuery) Parse(r *http.Request) (UserListQuery, error) {
+	qs := r.URL.Query()
+
+	q.Role = qs.Get("role")
+	q.Search = strings.TrimSpace(qs.Get("q"))
+
+	for name, dest := range map[string]**bool{"active": &q.Active, "suspended": &q.Suspended} {
+		if v := qs.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return q, err
+			}
+
+			*dest = &b
+		}
+	}
+
+	for name, dest := range map[string]**time.Time{"created_from": &q.CreatedFrom, "created_to": &q.CreatedTo} {
+		if v := qs.Get(name); v != "" {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				return q, err
+			}
+
+			*dest = &t
+		}
+	}
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+
+		q.Offset = o
+	}
+
+	return q, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// List fetches the users matching the query, newest first, whether they
+// activated their account or not. The search matches part of the username
+// or email.
+func (s *UserStore) List(ctx context.Context, q UserListQuery) ([]User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active, u.activated_at,
+		r.level, r.description, r.name, r.id, s.created_at, s.ends_at
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		` + activeSuspensionJoin + `
+		WHERE ($1 = '' OR r.name = $1)
+		AND ($2::boolean IS NULL OR u.is_active = $2)
+		AND ($3::boolean IS NULL OR (s.created_at IS NOT NULL) = $3)
+		AND ($4::date IS NULL OR u.created_at >= $4::date AT TIME ZONE 'UTC')
+		AND ($5::date IS NULL OR u.created_at < ($5::date + 1) AT TIME ZONE 'UTC')
+		AND ($6 = '' OR u.username ILIKE '%' || $6 || '%' OR u.email ILIKE '%' || $6 || '%')
+		ORDER BY u.created_at DESC, u.id DESC
+		LIMIT $7 OFFSET $8
+	`
+
+	var createdFrom, createdTo *string
+	if q.CreatedFrom != nil {
+		d := q.CreatedFrom.Format(time.DateOnly)
+		createdFrom = &d
+	}
+	if q.CreatedTo != nil {
+		d := q.CreatedTo.Format(time.DateOnly)
+		createdTo = &d
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		q.Role,
+		q.Active,
+		q.Suspended,
+		createdFrom,
+		createdTo,
+		likeEscaper.Replace(q.Search),
+		q.Limit,
+		q.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.CreatedAt,
+			&user.IsActive,
+			&user.ActivatedAt,
+			&user.Role.Level,
+			&user.Role.Description,
+			&user.Role.Name,
+			&user.Role.Id,
+			&user.SuspendedAt,
+			&user.SuspendedUntil,
+		); err != nil {
+			return nil, err
+		}
+
+		user.RoleID = user.Role.Id
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// GetAny fetches a user like GetById, but also when they did not activate
+// their account yet.
+func (s *UserStore) GetAny(ctx context.Context, userID int64) (User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active, u.activated_at,
+		r.level, r.description, r.name, r.id, s.created_at, s.ends_at, u.password_changed_at
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		` + activeSuspensionJoin + `
+		WHERE u.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+	if err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.ActivatedAt,
+		&user.Role.Level,
+		&user.Role.Description,
+		&user.Role.Name,
+		&user.Role.Id,
+		&user.SuspendedAt,
+		&user.SuspendedUntil,
+		&user.PasswordChangedAt,
 	); err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -321,5 +602,157 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (User, error)
 		}
 	}
 
+	user.RoleID = user.Role.Id
+
 	return user, nil
 }
+
+// ActivateById activates a user without an invitation token, dropping
+// their pending invitations.
+func (s *UserStore) ActivateById(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users SET is_active = true, activated_at = COALESCE(activated_at, NOW())
+			WHERE id = $1
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		return s.deleteUserInvitations(ctx, tx, userID)
+	})
+}
+
+// SetRole gives the user the role with the given name.
+func (s *UserStore) SetRole(ctx context.Context, userID int64, role string) error {
+	query := `
+		UPDATE users SET role_id = r.id
+		FROM roles r
+		WHERE users.id = $1 AND r.name = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, role)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ForcePasswordReset replaces the password of the user with user.Password,
+// which they are not meant to know, and stores the hashed reset token they
+// can set a new one with. Tokens issued before the reset stop working.
+func (s *UserStore) ForcePasswordReset(ctx context.Context, user *User, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.setPassword(ctx, tx, user); err != nil {
+			return err
+		}
+
+		if err := s.deletePasswordResets(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO password_resets (token, user_id, expiry)
+			VALUES ($1, $2, $3)
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, token, user.ID, time.Now().Add(exp))
+
+		return err
+	})
+}
+
+// ResetPassword sets user.Password as the password of the user owning the
+// plain reset token, and fills user.ID. The token can only be used once.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT user_id FROM password_resets
+			WHERE token = $1 AND expiry > $2
+		`
+
+		hash := sha256.Sum256([]byte(token))
+		hashToken := hex.EncodeToString(hash[:])
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&user.ID); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := s.setPassword(ctx, tx, user); err != nil {
+			return err
+		}
+
+		return s.deletePasswordResets(ctx, tx, user.ID)
+	})
+}
+
+func (s *UserStore) setPassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `
+		UPDATE users SET password = $1, password_changed_at = date_trunc('second', NOW())
+		WHERE id = $2
+		RETURNING password_changed_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if err := tx.QueryRowContext(ctx, query, user.Password.hash, user.ID).Scan(&user.PasswordChangedAt); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+
+	return err
+}
@@ -0,0 +1,96 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LocalBackend keeps events in memory and only reaches the users of this
+// instance. It is meant for single instance setups without Redis.
+type LocalBackend struct {
+	history int
+
+	mu      sync.Mutex
+	events  map[int64][]Event
+	lastMS  uint64
+	lastSeq uint64
+	deliver chan localDelivery
+}
+
+type localDelivery struct {
+	userIDs []int64
+	event   Event
+}
+
+// NewLocalBackend keeps the last history events of each user.
+func NewLocalBackend(history int) *LocalBackend {
+	return &LocalBackend{
+		history: history,
+		events:  make(map[int64][]Event),
+		deliver: make(chan localDelivery, subscriptionBuffer),
+	}
+}
+
+func (b *LocalBackend) Append(ctx context.Context, userID int64, e *Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.ID = b.nextID()
+
+	events := append(b.events[userID], *e)
+	if len(events) > b.history {
+		events = events[len(events)-b.history:]
+	}
+	b.events[userID] = events
+
+	return nil
+}
+
+// nextID generates increasing IDs in the format of Redis stream IDs. It
+// must be called with the lock held.
+func (b *LocalBackend) nextID() string {
+	ms := uint64(time.Now().UnixMilli())
+	if ms > b.lastMS {
+		b.lastMS, b.lastSeq = ms, 0
+	} else {
+		b.lastSeq++
+	}
+
+	return fmt.Sprintf("%d-%d", b.lastMS, b.lastSeq)
+}
+
+func (b *LocalBackend) Since(ctx context.Context, userID int64, lastID string) ([]Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []Event
+	for _, e := range b.events[userID] {
+		if After(e.ID, lastID) {
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
+
+func (b *LocalBackend) Broadcast(ctx context.Context, userIDs []int64, e Event) error {
+	select {
+	case b.deliver <- localDelivery{userIDs: userIDs, event: e}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *LocalBackend) Listen(ctx context.Context, deliver func(userIDs []int64, e Event)) error {
+	for {
+		select {
+		case d := <-b.deliver:
+			deliver(d.userIDs, d.event)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
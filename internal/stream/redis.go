@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// redisChannel carries the events of every user; instances keep the
+	// ones of their connected users.
+	redisChannel = "stream-events"
+	// redisHistoryExp drops the history of users that got no event for a
+	// while.
+	redisHistoryExp = time.Hour * 24
+)
+
+// RedisBackend keeps the history of each user in a Redis stream and fans
+// events out to every instance through Redis pub/sub.
+type RedisBackend struct {
+	client  *redis.Client
+	history int64
+}
+
+// NewRedisBackend keeps roughly the last history events of each user.
+func NewRedisBackend(client *redis.Client, history int) *RedisBackend {
+	return &RedisBackend{client: client, history: int64(history)}
+}
+
+type redisMessage struct {
+	UserIDs []int64 `json:"user_ids"`
+	Event   Event   `json:"event"`
+}
+
+func historyKey(userID int64) string {
+	return fmt.Sprintf("stream-user-%d", userID)
+}
+
+func (b *RedisBackend) Append(ctx context.Context, userID int64, e *Event) error {
+	key := historyKey(userID)
+
+	id, err := b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: b.history,
+		Approx: true,
+		Values: map[string]any{"type": e.Type, "data": string(e.Data)},
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	e.ID = id
+
+	return b.client.Expire(ctx, key, redisHistoryExp).Err()
+}
+
+func (b *RedisBackend) Since(ctx context.Context, userID int64, lastID string) ([]Event, error) {
+	start := "-"
+	if _, _, ok := parseID(lastID); ok {
+		start = lastID
+	}
+
+	msgs, err := b.client.XRangeN(ctx, historyKey(userID), start, "+", b.history+1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, msg := range msgs {
+		// the range includes lastID itself
+		if !After(msg.ID, lastID) {
+			continue
+		}
+
+		eventType, _ := msg.Values["type"].(string)
+		data, _ := msg.Values["data"].(string)
+		events = append(events, Event{ID: msg.ID, Type: eventType, Data: json.RawMessage(data)})
+	}
+
+	return events, nil
+}
+
+func (b *RedisBackend) Broadcast(ctx context.Context, userIDs []int64, e Event) error {
+	msg, err := json.Marshal(redisMessage{UserIDs: userIDs, Event: e})
+	if err != nil {
+		return err
+	}
+
+	return b.client.Publish(ctx, redisChannel, msg).Err()
+}
+
+func (b *RedisBackend) Listen(ctx context.Context, deliver func(userIDs []int64, e Event)) error {
+	sub := b.client.Subscribe(ctx, redisChannel)
+	defer sub.Close()
+
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			var m redisMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				continue
+			}
+
+			deliver(m.UserIDs, m.Event)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
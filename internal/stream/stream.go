@@ -0,0 +1,252 @@
+// Package stream pushes events to connected users. Events published for a
+// user are kept for a while so a client that reconnects can resume after
+// the last event it received; signals are only delivered to the users
+// connected at the time.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	EventNotification = "notification"
+	EventNewPosts     = "new_posts"
+)
+
+// subscriptionBuffer is how many events a subscriber may lag behind before
+// it is dropped; its client then resumes from its last event.
+const subscriptionBuffer = 64
+
+// Event is pushed to a user. Signals have no ID since they cannot be
+// resumed from.
+type Event struct {
+	ID   string          `json:"id,omitempty"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Backend stores events for replay and carries them to every instance.
+type Backend interface {
+	// Append stores the event of the user, filling its ID.
+	Append(ctx context.Context, userID int64, e *Event) error
+	// Since returns the stored events of the user after lastID, oldest
+	// first.
+	Since(ctx context.Context, userID int64, lastID string) ([]Event, error)
+	// Broadcast delivers the event to the users on every instance.
+	Broadcast(ctx context.Context, userIDs []int64, e Event) error
+	// Listen calls deliver with the events broadcast by any instance until
+	// ctx is done.
+	Listen(ctx context.Context, deliver func(userIDs []int64, e Event)) error
+}
+
+// Hub delivers the events of the backend to the users connected to this
+// instance.
+type Hub struct {
+	backend Backend
+
+	mu     sync.Mutex
+	subs   map[int64]map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub(backend Backend) *Hub {
+	return &Hub{
+		backend: backend,
+		subs:    make(map[int64]map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events of a user on C, which is closed when
+// the subscription is closed or falls too far behind.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	userID int64
+	hub    *Hub
+	closed bool
+}
+
+func (h *Hub) Subscribe(userID int64) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, userID: userID, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		s.closed = true
+		close(c)
+		return s
+	}
+
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][s] = struct{}{}
+
+	return s
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s)
+}
+
+// Close ends every subscription, and the ones made afterwards, so the
+// streams of this instance end on shutdown.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.subs {
+		for s := range subs {
+			h.remove(s)
+		}
+	}
+}
+
+// remove must be called with the lock held.
+func (h *Hub) remove(s *Subscription) {
+	if s.closed {
+		return
+	}
+
+	s.closed = true
+	close(s.c)
+
+	delete(h.subs[s.userID], s)
+	if len(h.subs[s.userID]) == 0 {
+		delete(h.subs, s.userID)
+	}
+}
+
+// Publish stores an event for the user and delivers it.
+func (h *Hub) Publish(ctx context.Context, userID int64, eventType string, data any) error {
+	e, err := newEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	if err := h.backend.Append(ctx, userID, &e); err != nil {
+		return err
+	}
+
+	return h.backend.Broadcast(ctx, []int64{userID}, e)
+}
+
+// Signal delivers an event to the users connected right now, without
+// storing it.
+func (h *Hub) Signal(ctx context.Context, userIDs []int64, eventType string, data any) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	e, err := newEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	return h.backend.Broadcast(ctx, userIDs, e)
+}
+
+// Replay returns the stored events of the user after lastID.
+func (h *Hub) Replay(ctx context.Context, userID int64, lastID string) ([]Event, error) {
+	return h.backend.Since(ctx, userID, lastID)
+}
+
+// Run delivers the events of the backend until ctx is done.
+func (h *Hub) Run(ctx context.Context) error {
+	return h.backend.Listen(ctx, h.deliver)
+}
+
+func (h *Hub) deliver(userIDs []int64, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, userID := range userIDs {
+		for s := range h.subs[userID] {
+			select {
+			case s.c <- e:
+			default:
+				// the client resumes from its last event when it reconnects
+				h.remove(s)
+			}
+		}
+	}
+}
+
+func newEvent(eventType string, data any) (Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Type: eventType, Data: b}, nil
+}
+
+// WriteSSE writes the event in the Server-Sent Events format.
+func WriteSSE(w io.Writer, e Event) error {
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	fmt.Fprintf(&b, "event: %s\n", e.Type)
+
+	// data lines cannot hold newlines, which json only has as whitespace
+	for line := range strings.SplitSeq(string(e.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// After reports whether the event ID a comes after b. IDs are Redis stream
+// IDs, milliseconds and a sequence number separated by a dash; an invalid
+// b is before every ID.
+func After(a, b string) bool {
+	ams, aseq, aok := parseID(a)
+	bms, bseq, bok := parseID(b)
+
+	switch {
+	case !aok:
+		return false
+	case !bok:
+		return true
+	case ams != bms:
+		return ams > bms
+	default:
+		return aseq > bseq
+	}
+}
+
+func parseID(id string) (ms, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return ms, seq, true
+}
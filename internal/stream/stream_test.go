@@ -0,0 +1,177 @@
+package stream
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runHub(t *testing.T, history int) *Hub {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	hub := NewHub(NewLocalBackend(history))
+	go hub.Run(ctx)
+
+	return hub
+}
+
+func receive(t *testing.T, s *Subscription) Event {
+	t.Helper()
+
+	select {
+	case e, ok := <-s.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+
+	return Event{}
+}
+
+func TestHubPublishAndReplay(t *testing.T) {
+	hub := runHub(t, 2)
+	ctx := context.Background()
+
+	sub := hub.Subscribe(1)
+	defer sub.Close()
+
+	other := hub.Subscribe(2)
+	defer other.Close()
+
+	for i := range 3 {
+		if err := hub.Publish(ctx, 1, EventNotification, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []string
+	for range 3 {
+		e := receive(t, sub)
+		if e.Type != EventNotification || e.ID == "" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		ids = append(ids, e.ID)
+	}
+
+	if !After(ids[1], ids[0]) || !After(ids[2], ids[1]) {
+		t.Errorf("ids are not increasing: %v", ids)
+	}
+
+	select {
+	case e := <-other.C:
+		t.Errorf("other user received %+v", e)
+	default:
+	}
+
+	// only the last two events are kept
+	replayed, err := hub.Replay(ctx, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 2 || replayed[0].ID != ids[1] {
+		t.Errorf("Replay from the start = %+v, want the last 2 events", replayed)
+	}
+
+	replayed, err = hub.Replay(ctx, 1, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 1 || replayed[0].ID != ids[2] || string(replayed[0].Data) != `{"n":2}` {
+		t.Errorf("Replay after %s = %+v, want the last event", ids[1], replayed)
+	}
+}
+
+func TestHubSignal(t *testing.T) {
+	hub := runHub(t, 10)
+	ctx := context.Background()
+
+	a, b := hub.Subscribe(1), hub.Subscribe(2)
+	defer a.Close()
+	defer b.Close()
+
+	if err := hub.Signal(ctx, []int64{1, 2}, EventNewPosts, map[string]int64{"post_id": 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []*Subscription{a, b} {
+		if e := receive(t, s); e.Type != EventNewPosts || e.ID != "" {
+			t.Errorf("unexpected signal %+v", e)
+		}
+	}
+
+	if replayed, _ := hub.Replay(ctx, 1, ""); len(replayed) != 0 {
+		t.Errorf("signals were stored: %+v", replayed)
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(NewLocalBackend(1))
+	sub := hub.Subscribe(1)
+
+	for range subscriptionBuffer + 1 {
+		hub.deliver([]int64{1}, Event{Type: EventNewPosts})
+	}
+
+	for range subscriptionBuffer {
+		<-sub.C
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("slow subscription was not closed")
+	}
+
+	// closing again is harmless
+	sub.Close()
+}
+
+func TestWriteSSE(t *testing.T) {
+	var b strings.Builder
+	if err := WriteSSE(&b, Event{ID: "5-0", Type: EventNotification, Data: []byte(`{"a":1}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id: 5-0\nevent: notification\ndata: {\"a\":1}\n\n"
+	if b.String() != want {
+		t.Errorf("WriteSSE = %q, want %q", b.String(), want)
+	}
+}
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"2-0", "1-5", true},
+		{"1-5", "1-4", true},
+		{"1-4", "1-4", false},
+		{"10-0", "9-0", true},
+		{"1-0", "", true},
+		{"", "1-0", false},
+	}
+
+	for _, tt := range tests {
+		if got := After(tt.a, tt.b); got != tt.want {
+			t.Errorf("After(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub(NewLocalBackend(1))
+	sub := hub.Subscribe(1)
+
+	hub.Close()
+
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription was not closed")
+	}
+	if _, ok := <-hub.Subscribe(2).C; ok {
+		t.Error("subscription made after Close is open")
+	}
+}
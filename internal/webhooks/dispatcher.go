@@ -0,0 +1,166 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// claimLease hides a claimed delivery from other instances while it is
+	// sent; it is retried after the lease if its instance stopped.
+	claimLease = time.Minute * 2
+	// concurrency bounds the deliveries sent at once by one instance.
+	concurrency = 8
+	// maxErrorLength bounds the response body kept as the error of a
+	// failed attempt.
+	maxErrorLength = 512
+)
+
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// Dispatcher enqueues events and sends the deliveries that are due.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+}
+
+func NewDispatcher(store Store, client *http.Client) *Dispatcher {
+	return &Dispatcher{store: store, client: client}
+}
+
+// NewHTTPClient returns a client for deliveries. Unless allowPrivate is
+// set, it refuses to connect to loopback, private and link-local
+// addresses, so endpoints cannot reach the internal network.
+func NewHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// a redirect would send the signed payload elsewhere
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Publish enqueues the event for the endpoints subscribed to it and
+// returns how many deliveries were created.
+func (d *Dispatcher) Publish(ctx context.Context, e Event) (int64, error) {
+	return d.store.Enqueue(ctx, e)
+}
+
+// DeliverDue sends up to limit due deliveries and returns how many were
+// attempted.
+func (d *Dispatcher) DeliverDue(ctx context.Context, limit int) (int, error) {
+	attempts, err := d.store.ClaimDue(ctx, time.Now(), limit, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, concurrency)
+	)
+	for _, a := range attempts {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := d.Deliver(ctx, a, time.Now())
+			if err := d.store.Record(ctx, a.DeliveryID, result); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("delivery %d: %w", a.DeliveryID, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return len(attempts), errors.Join(errs...)
+}
+
+// Deliver sends one attempt and tells what became of the delivery: sent
+// on a 2xx response, scheduled again after a failure, or dead once
+// MaxAttempts attempts failed.
+func (d *Dispatcher) Deliver(ctx context.Context, a Attempt, now time.Time) Result {
+	status, err := d.send(ctx, a, now)
+	if err == nil {
+		return Result{Status: StatusSucceeded, ResponseStatus: status}
+	}
+
+	result := Result{Status: StatusPending, ResponseStatus: status, Error: err.Error()}
+
+	attempts := a.Attempts + 1
+	if attempts >= MaxAttempts {
+		result.Status = StatusDead
+		return result
+	}
+
+	next := now.Add(Backoff(attempts))
+	result.NextAttemptAt = &next
+
+	return result
+}
+
+func (d *Dispatcher) send(ctx context.Context, a Attempt, now time.Time) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(a.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GopherSocial-Webhooks")
+	req.Header.Set(EventHeader, a.EventType)
+	// the same on every attempt, for receivers to drop duplicates
+	req.Header.Set(DeliveryHeader, a.EventID)
+	req.Header.Set(SignatureHeader, Sign(a.Secret, now, a.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	status := res.StatusCode
+	if status >= 200 && status < 300 {
+		io.Copy(io.Discard, io.LimitReader(res.Body, maxErrorLength))
+		return &status, nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+
+	return &status, fmt.Errorf("unexpected status %d: %s", status, bytes.TrimSpace(body))
+}
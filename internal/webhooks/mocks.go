@@ -0,0 +1,49 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+)
+
+type MockStore struct {
+}
+
+func NewMockStore() *MockStore {
+	return &MockStore{}
+}
+
+func (s *MockStore) CreateEndpoint(context.Context, *Endpoint) error {
+	return nil
+}
+
+func (s *MockStore) GetEndpoint(context.Context, int64) (Endpoint, error) {
+	return Endpoint{}, ErrNotFound
+}
+
+func (s *MockStore) ListEndpoints(context.Context, int64) ([]Endpoint, error) {
+	return []Endpoint{}, nil
+}
+
+func (s *MockStore) DeleteEndpoint(context.Context, int64) error {
+	return nil
+}
+
+func (s *MockStore) Enqueue(context.Context, Event) (int64, error) {
+	return 0, nil
+}
+
+func (s *MockStore) ClaimDue(context.Context, time.Time, int, time.Duration) ([]Attempt, error) {
+	return nil, nil
+}
+
+func (s *MockStore) Record(context.Context, int64, Result) error {
+	return nil
+}
+
+func (s *MockStore) ListDeliveries(context.Context, int64, DeliveryQuery) ([]Delivery, error) {
+	return []Delivery{}, nil
+}
+
+func (s *MockStore) Redeliver(context.Context, int64, int64) error {
+	return nil
+}
@@ -0,0 +1,318 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const queryTimeout = time.Second * 5
+
+// DeliveryQuery filters the deliveries of an endpoint. An empty Status
+// matches every delivery.
+type DeliveryQuery struct {
+	Status string `json:"status" validate:"omitempty,oneof=pending succeeded dead"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (q DeliveryQuery) Parse(r *http.Request) (DeliveryQuery, error) {
+	qs := r.URL.Query()
+
+	q.Status = qs.Get("status")
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+
+		q.Offset = o
+	}
+
+	return q, nil
+}
+
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// CreateEndpoint inserts the endpoint with a new secret, filling its ID,
+// Secret, Active and CreatedAt.
+func (s *PostgresStore) CreateEndpoint(ctx context.Context, e *Endpoint) error {
+	query := `
+		INSERT INTO webhook_endpoints (user_id, url, secret, events, all_users)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, active, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	e.Secret = NewID() + NewID()
+
+	return s.db.QueryRowContext(ctx, query, e.UserID, e.URL, e.Secret, pq.Array(e.Events), e.AllUsers).
+		Scan(&e.ID, &e.Active, &e.CreatedAt)
+}
+
+func (s *PostgresStore) GetEndpoint(ctx context.Context, id int64) (Endpoint, error) {
+	query := `
+		SELECT id, user_id, url, events, all_users, active, created_at
+		FROM webhook_endpoints
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var e Endpoint
+	err := s.db.QueryRowContext(ctx, query, id).
+		Scan(&e.ID, &e.UserID, &e.URL, pq.Array(&e.Events), &e.AllUsers, &e.Active, &e.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return e, ErrNotFound
+		default:
+			return e, err
+		}
+	}
+
+	return e, nil
+}
+
+func (s *PostgresStore) ListEndpoints(ctx context.Context, userID int64) ([]Endpoint, error) {
+	query := `
+		SELECT id, user_id, url, events, all_users, active, created_at
+		FROM webhook_endpoints
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []Endpoint{}
+	for rows.Next() {
+		var e Endpoint
+		if err := rows.Scan(&e.ID, &e.UserID, &e.URL, pq.Array(&e.Events), &e.AllUsers, &e.Active, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		endpoints = append(endpoints, e)
+	}
+
+	return endpoints, rows.Err()
+}
+
+func (s *PostgresStore) DeleteEndpoint(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Enqueue adds a delivery of the event to the active endpoints subscribed
+// to it. Endpoints covering every user only get it while their owner is
+// still an admin, so a demotion stops them without touching the endpoint.
+func (s *PostgresStore) Enqueue(ctx context.Context, e Event) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT we.id, $1, $2, $3
+		FROM webhook_endpoints we
+		JOIN users u ON u.id = we.user_id
+		JOIN roles r ON r.id = u.role_id
+		WHERE we.active AND $2 = ANY(we.events) AND (
+			we.user_id = ANY($4) OR
+			(we.all_users AND r.level >= (SELECT level FROM roles WHERE name = 'admin'))
+		)
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+	`
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, e.ID, e.Type, payload, pq.Array(e.UserIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *PostgresStore) ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Attempt, error) {
+	query := `
+		WITH due AS (
+			SELECT d.id
+			FROM webhook_deliveries d
+			JOIN webhook_endpoints e ON e.id = d.endpoint_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND e.active
+			ORDER BY d.next_attempt_at
+			LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = $3
+		FROM due, webhook_endpoints e
+		WHERE d.id = due.id AND e.id = d.endpoint_id
+		RETURNING d.id, d.event_id, d.event_type, d.payload, d.attempts, e.url, e.secret
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, now, limit, now.Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var a Attempt
+		if err := rows.Scan(&a.DeliveryID, &a.EventID, &a.EventType, &a.Payload, &a.Attempts, &a.URL, &a.Secret); err != nil {
+			return nil, err
+		}
+
+		attempts = append(attempts, a)
+	}
+
+	return attempts, rows.Err()
+}
+
+func (s *PostgresStore) Record(ctx context.Context, deliveryID int64, r Result) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, response_status = $3, last_error = $4,
+		next_attempt_at = $5, delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() END
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, deliveryID, r.Status, r.ResponseStatus, r.Error, r.NextAttemptAt)
+
+	return err
+}
+
+func (s *PostgresStore) ListDeliveries(ctx context.Context, endpointID int64, q DeliveryQuery) ([]Delivery, error) {
+	query := `
+		SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+		response_status, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, endpointID, q.Status, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var (
+			d       Delivery
+			payload []byte
+		)
+		if err := rows.Scan(
+			&d.ID,
+			&d.EndpointID,
+			&d.EventID,
+			&d.EventType,
+			&payload,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.ResponseStatus,
+			&d.LastError,
+			&d.CreatedAt,
+			&d.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (s *PostgresStore) Redeliver(ctx context.Context, endpointID, deliveryID int64) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = '', delivered_at = NULL
+		WHERE id = $1 AND endpoint_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, deliveryID, endpointID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+// Package webhooks delivers platform events to the HTTP endpoints registered
+// by users and admins. Every delivery is signed with the secret of its
+// endpoint, retried with exponential backoff and, after MaxAttempts failed
+// attempts, left dead until it is redelivered by hand.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EventPostCreated    = "post.created"
+	EventPostDeleted    = "post.deleted"
+	EventCommentCreated = "comment.created"
+	EventUserFollowed   = "user.followed"
+	EventUserUnfollowed = "user.unfollowed"
+	EventUserRegistered = "user.registered"
+)
+
+// EventTypes lists every event endpoints may subscribe to.
+var EventTypes = []string{
+	EventPostCreated,
+	EventPostDeleted,
+	EventCommentCreated,
+	EventUserFollowed,
+	EventUserUnfollowed,
+	EventUserRegistered,
+}
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is dead.
+	MaxAttempts = 8
+	// baseBackoff is the wait after the first failed attempt, doubled after
+	// each of the next ones up to maxBackoff.
+	baseBackoff = time.Second * 30
+	maxBackoff  = time.Hour * 6
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+var (
+	ErrNotFound         = errors.New("webhook not found")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnknownEvent     = errors.New("unknown webhook event type")
+)
+
+// Event happened on the platform. UserIDs are the users it concerns, whose
+// endpoints receive it; endpoints of admins covering all users receive
+// every event.
+type Event struct {
+	// ID identifies the event across retries so receivers can drop the
+	// duplicates.
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+	UserIDs   []int64         `json:"-"`
+}
+
+// NewEvent builds an event with a random ID.
+func NewEvent(eventType string, userIDs []int64, data any) (Event, error) {
+	if !slices.Contains(EventTypes, eventType) {
+		return Event{}, fmt.Errorf("%w: %s", ErrUnknownEvent, eventType)
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:        NewID(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      b,
+		UserIDs:   userIDs,
+	}, nil
+}
+
+// NewID returns a random identifier, also used for endpoint secrets.
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Endpoint receives the events of the types it subscribed to. The secret
+// is only shown when the endpoint is created.
+type Endpoint struct {
+	ID        int64    `json:"id"`
+	UserID    int64    `json:"user_id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events"`
+	AllUsers  bool     `json:"all_users"`
+	Active    bool     `json:"active"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// Delivery is an event to send to an endpoint, and the outcome of its
+// last attempt.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	EndpointID     int64           `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *string         `json:"next_attempt_at,omitempty"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    *string         `json:"delivered_at,omitempty"`
+}
+
+// Attempt is a claimed delivery with what is needed to send it.
+type Attempt struct {
+	DeliveryID int64
+	EventID    string
+	EventType  string
+	Payload    []byte
+	Attempts   int
+	URL        string
+	Secret     string
+}
+
+// Result is the outcome of an attempt.
+type Result struct {
+	Status         string
+	ResponseStatus *int
+	Error          string
+	NextAttemptAt  *time.Time
+}
+
+// Store keeps the endpoints and their deliveries.
+type Store interface {
+	CreateEndpoint(context.Context, *Endpoint) error
+	GetEndpoint(context.Context, int64) (Endpoint, error)
+	ListEndpoints(ctx context.Context, userID int64) ([]Endpoint, error)
+	DeleteEndpoint(context.Context, int64) error
+	// Enqueue creates a delivery of the event for every active endpoint
+	// subscribed to it. Enqueuing an event twice creates no duplicates.
+	Enqueue(context.Context, Event) (int64, error)
+	// ClaimDue returns up to limit due deliveries, hiding them from other
+	// claims for lease.
+	ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Attempt, error)
+	Record(ctx context.Context, deliveryID int64, r Result) error
+	ListDeliveries(ctx context.Context, endpointID int64, q DeliveryQuery) ([]Delivery, error)
+	// Redeliver schedules a delivery of the endpoint again, resetting its
+	// attempts.
+	Redeliver(ctx context.Context, endpointID, deliveryID int64) error
+}
+
+// Backoff is the wait before retrying a delivery that failed attempts
+// times.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+
+	wait := baseBackoff
+	for range attempts - 1 {
+		wait *= 2
+		if wait >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return wait
+}
+
+// Sign computes the signature header of a payload sent at t. Receivers
+// recompute the HMAC-SHA256 of the timestamp, a dot and the body with the
+// endpoint secret.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+
+	return "t=" + ts + ",v1=" + signature(secret, ts, body)
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header made by Sign, rejecting the ones older
+// than tolerance to prevent replays.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, sig string
+	for part := range strings.SplitSeq(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
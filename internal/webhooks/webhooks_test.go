@@ -0,0 +1,261 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint answering with the queued statuses, then
+// with 200.
+type receiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	got      []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rc.t.Error(err)
+	}
+
+	if err := Verify(rc.secret, r.Header.Get(SignatureHeader), body, time.Now(), time.Minute); err != nil {
+		rc.t.Errorf("receiver: %v", err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.got = append(rc.got, r)
+	rc.bodies = append(rc.bodies, body)
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, http.StatusText(status))
+}
+
+// memoryStore claims its attempts once and keeps the recorded results.
+type memoryStore struct {
+	MockStore
+
+	mu       sync.Mutex
+	attempts []Attempt
+	results  map[int64]Result
+}
+
+func (s *memoryStore) ClaimDue(_ context.Context, _ time.Time, limit int, _ time.Duration) ([]Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := min(limit, len(s.attempts))
+	claimed := s.attempts[:n]
+	s.attempts = s.attempts[n:]
+
+	return claimed, nil
+}
+
+func (s *memoryStore) Record(_ context.Context, deliveryID int64, r Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results[deliveryID] = r
+
+	return nil
+}
+
+func newAttempt(t *testing.T, url, secret string, attempts int) Attempt {
+	t.Helper()
+
+	e, err := NewEvent(EventPostCreated, []int64{1}, map[string]int64{"post_id": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Attempt{DeliveryID: 1, EventID: e.ID, EventType: e.Type, Payload: payload, Attempts: attempts, URL: url, Secret: secret}
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	rc := &receiver{t: t, secret: "s3cret"}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := NewDispatcher(NewMockStore(), NewHTTPClient(time.Second, true))
+	a := newAttempt(t, srv.URL, rc.secret, 0)
+
+	result := d.Deliver(context.Background(), a, time.Now())
+	if result.Status != StatusSucceeded || result.ResponseStatus == nil || *result.ResponseStatus != http.StatusOK {
+		t.Fatalf("Deliver = %+v, want success", result)
+	}
+
+	if len(rc.got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(rc.got))
+	}
+
+	req := rc.got[0]
+	if req.Header.Get(EventHeader) != EventPostCreated || req.Header.Get(DeliveryHeader) != a.EventID {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	var e Event
+	if err := json.Unmarshal(rc.bodies[0], &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != a.EventID || e.Type != EventPostCreated || string(e.Data) != `{"post_id":7}` {
+		t.Errorf("unexpected payload %s", rc.bodies[0])
+	}
+}
+
+func TestDeliverRetriesThenDies(t *testing.T) {
+	rc := &receiver{t: t, secret: "s3cret", statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := NewDispatcher(NewMockStore(), NewHTTPClient(time.Second, true))
+	now := time.Now()
+
+	result := d.Deliver(context.Background(), newAttempt(t, srv.URL, rc.secret, 0), now)
+	if result.Status != StatusPending || result.NextAttemptAt == nil || !result.NextAttemptAt.Equal(now.Add(Backoff(1))) {
+		t.Fatalf("first failure = %+v, want a retry after %v", result, Backoff(1))
+	}
+	if *result.ResponseStatus != http.StatusInternalServerError || result.Error == "" {
+		t.Errorf("first failure = %+v, want the response status and error", result)
+	}
+
+	result = d.Deliver(context.Background(), newAttempt(t, srv.URL, rc.secret, MaxAttempts-1), now)
+	if result.Status != StatusDead || result.NextAttemptAt != nil {
+		t.Fatalf("last failure = %+v, want dead", result)
+	}
+}
+
+func TestDeliverUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	d := NewDispatcher(NewMockStore(), NewHTTPClient(time.Second, true))
+
+	result := d.Deliver(context.Background(), newAttempt(t, url, "s", 2), time.Now())
+	if result.Status != StatusPending || result.ResponseStatus != nil || result.Error == "" {
+		t.Errorf("Deliver = %+v, want a retry without response", result)
+	}
+}
+
+func TestDeliverRefusesPrivateAddresses(t *testing.T) {
+	rc := &receiver{t: t, secret: "s"}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := NewDispatcher(NewMockStore(), NewHTTPClient(time.Second, false))
+
+	result := d.Deliver(context.Background(), newAttempt(t, srv.URL, rc.secret, 0), time.Now())
+	if result.Status != StatusPending || len(rc.got) != 0 {
+		t.Errorf("Deliver = %+v, want the loopback receiver not to be reached", result)
+	}
+}
+
+func TestDeliverDue(t *testing.T) {
+	rc := &receiver{t: t, secret: "s3cret", statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	store := &memoryStore{results: make(map[int64]Result)}
+	for i := range 3 {
+		a := newAttempt(t, srv.URL, rc.secret, 0)
+		a.DeliveryID = int64(i + 1)
+		store.attempts = append(store.attempts, a)
+	}
+
+	d := NewDispatcher(store, NewHTTPClient(time.Second, true))
+
+	n, err := d.DeliverDue(context.Background(), 10)
+	if err != nil || n != 3 {
+		t.Fatalf("DeliverDue = %d, %v, want 3 attempts", n, err)
+	}
+
+	var succeeded, pending int
+	for _, r := range store.results {
+		switch r.Status {
+		case StatusSucceeded:
+			succeeded++
+		case StatusPending:
+			pending++
+		}
+	}
+	if succeeded != 2 || pending != 1 {
+		t.Errorf("results = %+v, want 2 succeeded and 1 pending", store.results)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{MaxAttempts - 1, 32 * time.Minute},
+		{20, maxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Now()
+	header := Sign("secret", now, body)
+
+	if err := Verify("secret", header, body, now, time.Minute); err != nil {
+		t.Errorf("Verify of a valid signature = %v", err)
+	}
+
+	tests := map[string]struct {
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+	}{
+		"wrong secret":   {"other", header, body, now},
+		"altered body":   {"secret", header, []byte(`{"id":"2"}`), now},
+		"too old":        {"secret", header, body, now.Add(2 * time.Minute)},
+		"missing header": {"secret", "", body, now},
+		"malformed":      {"secret", "t=abc,v1=00", body, now},
+	}
+
+	for name, tt := range tests {
+		if err := Verify(tt.secret, tt.header, tt.body, tt.now, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: Verify = %v, want %v", name, err, ErrInvalidSignature)
+		}
+	}
+}
+
+func TestNewEventRejectsUnknownTypes(t *testing.T) {
+	if _, err := NewEvent("post.exploded", nil, nil); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("NewEvent error = %v, want %v", err, ErrUnknownEvent)
+	}
+}